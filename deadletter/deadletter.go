@@ -0,0 +1,36 @@
+// Contract of the dead letter queue shared by NTA, which moves there the messages it cannot
+// write, and GAN, which lists and re-drives them
+
+package deadletter
+
+import "strings"
+
+// Headers which NTA adds to the dead letters
+const (
+	REASON_HEADER   = "Dead-Letter-Reason"
+	SUBJECT_HEADER  = "Dead-Letter-Subject"
+	ATTEMPTS_HEADER = "Dead-Letter-Attempts"
+	STREAM_HEADER   = "Dead-Letter-Stream"
+	SEQUENCE_HEADER = "Dead-Letter-Sequence"
+)
+
+// Default settings of the dead letter stream
+const (
+	DEFAULT_STREAM = "SENSORS_DLQ"
+	DEFAULT_PREFIX = "dlq"
+)
+
+// This function returns the subject of the dead letter of a message
+func Subject(prefix string, original string) string {
+	return prefix + "." + original
+}
+
+// This function returns the original subject of a dead letter
+func OriginalSubject(prefix string, subject string) string {
+	return strings.TrimPrefix(subject, prefix+".")
+}
+
+// This function returns the subjects of the dead letter stream
+func Subjects(prefix string) string {
+	return prefix + ".>"
+}
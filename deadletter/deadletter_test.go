@@ -0,0 +1,24 @@
+package deadletter
+
+import "testing"
+
+func TestSubject(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		original string
+		want     string
+	}{
+		{prefix: DEFAULT_PREFIX, original: "sensors.temperature.8cf3030f", want: "dlq.sensors.temperature.8cf3030f"},
+		{prefix: "dead.letters", original: "sensors.humidity.1", want: "dead.letters.sensors.humidity.1"},
+	}
+
+	for _, tt := range tests {
+		subject := Subject(tt.prefix, tt.original)
+		if subject != tt.want {
+			t.Errorf("Subject(%q, %q) = %q, want %q", tt.prefix, tt.original, subject, tt.want)
+		}
+		if got := OriginalSubject(tt.prefix, subject); got != tt.original {
+			t.Errorf("OriginalSubject(%q, %q) = %q, want %q", tt.prefix, subject, got, tt.original)
+		}
+	}
+}
@@ -2,11 +2,14 @@ package api
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humamux"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
 
 	errutil "github.com/AntonioBR9998/go-common/errors"
@@ -14,20 +17,36 @@ import (
 	"github.com/AntonioBR9998/go-nats-simulator/gan/api/dtos"
 	"github.com/AntonioBR9998/go-nats-simulator/gan/config"
 	"github.com/AntonioBR9998/go-nats-simulator/gan/domain"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
 )
 
 const (
-	API_CONTEXT      = "/api"
-	API_V1           = "/v1"
-	API_V1_BASE      = API_CONTEXT + API_V1
-	SENSORS_ENDPOINT = "/sensors"
-	METRICS_ENDPOINT = "/metrics"
-	UUID_REGEX       = "[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}"
+	API_CONTEXT           = "/api"
+	API_V1                = "/v1"
+	API_V1_BASE           = API_CONTEXT + API_V1
+	SENSORS_ENDPOINT      = "/sensors"
+	METRICS_ENDPOINT      = "/metrics"
+	FAULTS_ENDPOINT       = "/faults"
+	DATASETS_ENDPOINT     = "/datasets"
+	DEAD_LETTERS_ENDPOINT = "/dead-letters"
+	REDRIVE_ENDPOINT      = "/redrive"
+	RETENTION_ENDPOINT    = "/retention"
+	AGGREGATE_ENDPOINT    = "/aggregate"
+	LATEST_ENDPOINT       = "/latest"
+	STREAM_ENDPOINT       = "/stream"
+	WEBSOCKET_ENDPOINT    = "/ws"
+	EXPORT_ENDPOINT       = "/export"
+	UUID_REGEX            = "[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}"
+	SEQUENCE_REGEX        = "[0-9]+"
+
+	// Max size of uploaded datasets
+	MAX_DATASET_BYTES = 64 * 1024 * 1024
 )
 
 type api struct {
-	router  http.Handler
-	service domain.Service
+	router    http.Handler
+	service   domain.Service
+	wsUpgrade *websocket.Upgrader
 }
 
 type Server interface {
@@ -40,8 +59,30 @@ type APIResponse[T any] struct {
 
 type APIResponseWithoutBody struct{}
 
+// Responses of a single sensor carry its ETag, which is sent back in If-Match to update it
+type SensorResponse struct {
+	ETag string                   `header:"ETag"`
+	Body *dtos.SensorResponseBody `contentType:"application/json"`
+}
+
+// Responses of the fault profile of a sensor carry the ETag of the sensor after updating it
+type FaultsResponse struct {
+	ETag string           `header:"ETag"`
+	Body *dtos.FaultsBody `contentType:"application/json"`
+}
+
+func toSensorResponse(res *entity.Sensor) *SensorResponse {
+	return &SensorResponse{
+		ETag: dtos.ToETag(res.Version),
+		Body: dtos.ToSensorResponseDto(res),
+	}
+}
+
 func NewAPI(cfg config.Config, service domain.Service) Server {
-	a := &api{service: service}
+	a := &api{
+		service:   service,
+		wsUpgrade: newWebSocketUpgrader(cfg.WebSocket.AllowedOrigins),
+	}
 
 	log.Traceln("creating new *mux.Router")
 	r := mux.NewRouter()
@@ -77,7 +118,44 @@ func NewAPI(cfg config.Config, service domain.Service) Server {
 			[]string{"id", "type", "alias", "updatedAt"},
 		),
 	))
+	huma.Get(ganApi, SENSORS_ENDPOINT+LATEST_ENDPOINT, a.getLatestMetrics)
+	huma.Get(ganApi, SENSORS_ENDPOINT+"/{id:"+UUID_REGEX+"}"+LATEST_ENDPOINT, a.getLatestMetric)
+	huma.Get(ganApi, SENSORS_ENDPOINT+"/{id:"+UUID_REGEX+"}", a.getSensor)
+	huma.Patch(ganApi, SENSORS_ENDPOINT+"/{id:"+UUID_REGEX+"}", a.patchSensor)
 	huma.Delete(ganApi, SENSORS_ENDPOINT+"/{id:"+UUID_REGEX+"}", a.deleteSensor)
+	huma.Put(ganApi, SENSORS_ENDPOINT+"/{id:"+UUID_REGEX+"}"+FAULTS_ENDPOINT, a.setSensorFaults)
+
+	// Datasets endpoints
+	huma.Post(ganApi, DATASETS_ENDPOINT, a.createDataset, func(o *huma.Operation) {
+		o.MaxBodyBytes = MAX_DATASET_BYTES
+	})
+	huma.Get(ganApi, DATASETS_ENDPOINT, a.getDatasetList, humamw.UseMiddlewares(
+		humamw.UsePagination(humamw.PaginationOptions(humamw.SetMaxLimit(3000))),
+		humamw.SetHeaderUsingCallback("Total"),
+		humamw.UseFilter(
+			ganApi,
+			map[string]humamw.FilterDefinition{
+				"id":     {Type: humamw.STRING},
+				"name":   {Type: humamw.STRING},
+				"format": {Type: humamw.STRING},
+			},
+			[]string{"name", "createdAt"},
+		),
+	))
+	huma.Delete(ganApi, DATASETS_ENDPOINT+"/{id:"+UUID_REGEX+"}", a.deleteDataset)
+
+	// Dead letters endpoints
+	huma.Get(ganApi, DEAD_LETTERS_ENDPOINT, a.getDeadLetterList, humamw.UseMiddlewares(
+		humamw.UsePagination(humamw.PaginationOptions(humamw.SetMaxLimit(3000))),
+		humamw.SetHeaderUsingCallback("Total"),
+	))
+	huma.Get(ganApi, DEAD_LETTERS_ENDPOINT+"/{seq:"+SEQUENCE_REGEX+"}", a.getDeadLetter)
+	huma.Post(ganApi, DEAD_LETTERS_ENDPOINT+"/{seq:"+SEQUENCE_REGEX+"}"+REDRIVE_ENDPOINT, a.redriveDeadLetter)
+	huma.Delete(ganApi, DEAD_LETTERS_ENDPOINT+"/{seq:"+SEQUENCE_REGEX+"}", a.deleteDeadLetter)
+
+	// Retention endpoints
+	huma.Get(ganApi, RETENTION_ENDPOINT, a.getRetentionPolicy)
+	huma.Put(ganApi, RETENTION_ENDPOINT, a.setRetentionPolicy)
 
 	// Metrics endpoints
 	huma.Get(ganApi, METRICS_ENDPOINT, a.getMetricsData, humamw.UseMiddlewares(
@@ -93,6 +171,12 @@ func NewAPI(cfg config.Config, service domain.Service) Server {
 		),
 	))
 
+	huma.Get(ganApi, METRICS_ENDPOINT+AGGREGATE_ENDPOINT, a.getMetricAggregates)
+	huma.Get(ganApi, METRICS_ENDPOINT+EXPORT_ENDPOINT, a.exportMetrics)
+	huma.Get(ganApi, METRICS_ENDPOINT+STREAM_ENDPOINT, a.streamMetrics)
+	// WebSocket upgrades take over the connection, so they are served outside huma
+	apiV1.HandleFunc(METRICS_ENDPOINT+STREAM_ENDPOINT+WEBSOCKET_ENDPOINT, a.streamMetricsWebSocket).Methods(http.MethodGet)
+
 	a.router = r
 	return a
 }
@@ -101,38 +185,70 @@ func (a *api) Router() http.Handler {
 	return a.router
 }
 
+// This function translates service errors into API errors
+func toHumaError(err error) error {
+	if errors.Is(err, domain.ErrInvalidSimulation) {
+		return huma.NewError(400, "validation error: "+err.Error())
+	}
+	if errors.Is(err, domain.ErrInvalidDataset) {
+		return huma.NewError(400, "validation error: "+err.Error())
+	}
+	if errors.Is(err, domain.ErrInvalidRetention) || errors.Is(err, domain.ErrInvalidQuery) {
+		return huma.NewError(400, "validation error: "+err.Error())
+	}
+	if errors.Is(err, domain.ErrSensorNotFound) || errors.Is(err, domain.ErrDatasetNotFound) ||
+		errors.Is(err, domain.ErrDeadLetterNotFound) || errors.Is(err, domain.ErrMetricNotFound) {
+		return huma.NewError(404, err.Error())
+	}
+	if errors.Is(err, domain.ErrDatasetInUse) {
+		return huma.NewError(409, err.Error())
+	}
+	if errors.Is(err, domain.ErrVersionConflict) || errors.Is(err, dtos.ErrInvalidETag) {
+		return huma.NewError(412, err.Error())
+	}
+	if errors.Is(err, dtos.ErrMissingIfMatch) {
+		return huma.NewError(428, err.Error())
+	}
+
+	apiErr := errutil.APIErrorHandler(err)
+	return huma.NewError(apiErr.GetStatus(), apiErr.Error())
+}
+
 // Sensors handlers
-func (a *api) createSensor(ctx context.Context, req *dtos.SensorBaseRequest) (*APIResponse[*dtos.SensorResponseBody], error) {
+func (a *api) createSensor(ctx context.Context, req *dtos.SensorBaseRequest) (*SensorResponse, error) {
 	// Validating type of sensor
 	if !dtos.ValidateSensorType(req.Body.Type) {
 		return nil, huma.NewError(400, "validation error: type must be one of temperature, humidity or pressure")
 	}
 
-	res, err := a.service.CreateSensor(ctx, req.Body.ID, req.Body.Type, req.Body.Alias, req.Body.Rate, req.Body.MaxThreshold, req.Body.MinThreshold)
+	res, err := a.service.CreateSensor(ctx, req.Body.ID, req.Body.Type, req.Body.Alias, time.Duration(req.Body.Rate), dtos.ToJitter(req.Body.Jitter), req.Body.MaxThreshold, req.Body.MinThreshold,
+		dtos.ToGeneratorEntity(req.Body.Generator), req.Body.ThresholdCrossingRate, req.Body.Seed, dtos.ToFaultsEntity(req.Body.Faults),
+		dtos.ToReplayEntity(req.Body.Replay))
 
 	if err != nil {
 		log.Errorf("error in createSensor endpoint: %v", err)
-		apiErr := errutil.APIErrorHandler(err)
-		return nil, huma.NewError(apiErr.GetStatus(), apiErr.Error())
+		return nil, toHumaError(err)
 	}
 
-	return &APIResponse[*dtos.SensorResponseBody]{
-		Body: dtos.ToSensorResponseDto(res),
-	}, nil
+	return toSensorResponse(res), nil
 }
 
-func (a *api) modifySensor(ctx context.Context, req *dtos.SensorBaseRequest) (*APIResponse[*dtos.SensorResponseBody], error) {
-	res, err := a.service.ModifySensor(ctx, req.Body.ID, req.Body.Type, req.Body.Alias, req.Body.Rate, req.Body.MaxThreshold, req.Body.MinThreshold)
+func (a *api) modifySensor(ctx context.Context, req *dtos.SensorBaseRequest) (*SensorResponse, error) {
+	version, err := dtos.ParseIfMatch(req.IfMatch)
+	if err != nil {
+		return nil, toHumaError(err)
+	}
+
+	res, err := a.service.ModifySensor(ctx, req.Body.ID, req.Body.Type, req.Body.Alias, time.Duration(req.Body.Rate), dtos.ToJitter(req.Body.Jitter), req.Body.MaxThreshold, req.Body.MinThreshold,
+		dtos.ToGeneratorEntity(req.Body.Generator), req.Body.ThresholdCrossingRate, req.Body.Seed, dtos.ToFaultsEntity(req.Body.Faults),
+		dtos.ToReplayEntity(req.Body.Replay), version)
 
 	if err != nil {
 		log.Errorf("error in modifySensor endpoint: %v", err)
-		apiErr := errutil.APIErrorHandler(err)
-		return nil, huma.NewError(apiErr.GetStatus(), apiErr.Error())
+		return nil, toHumaError(err)
 	}
 
-	return &APIResponse[*dtos.SensorResponseBody]{
-		Body: dtos.ToSensorResponseDto(res),
-	}, nil
+	return toSensorResponse(res), nil
 }
 
 func (a *api) getSensorList(ctx context.Context, req *struct{}) (*APIResponse[[]*dtos.SensorResponseBody], error) {
@@ -140,8 +256,7 @@ func (a *api) getSensorList(ctx context.Context, req *struct{}) (*APIResponse[[]
 
 	if err != nil {
 		log.Errorf("error in getSensorList endpoint: %v", err)
-		apiErr := errutil.APIErrorHandler(err)
-		return nil, huma.NewError(apiErr.GetStatus(), apiErr.Error())
+		return nil, toHumaError(err)
 	}
 
 	var sensorDtoList []*dtos.SensorResponseBody
@@ -155,26 +270,215 @@ func (a *api) getSensorList(ctx context.Context, req *struct{}) (*APIResponse[[]
 	}, nil
 }
 
+func (a *api) getSensor(ctx context.Context, request *dtos.SensorRequestById) (*SensorResponse, error) {
+	res, err := a.service.GetSensor(ctx, request.Id)
+
+	if err != nil {
+		log.Errorf("error in getSensor endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	return toSensorResponse(res), nil
+}
+
+func (a *api) patchSensor(ctx context.Context, req *dtos.SensorPatchRequest) (*SensorResponse, error) {
+	version, err := dtos.ParseIfMatch(req.IfMatch)
+	if err != nil {
+		return nil, toHumaError(err)
+	}
+
+	res, err := a.service.PatchSensor(ctx, req.Id, version, func(sensor *entity.Sensor) error {
+		return dtos.PatchSensorEntity(sensor, req.RawBody)
+	})
+
+	if err != nil {
+		log.Errorf("error in patchSensor endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	return toSensorResponse(res), nil
+}
+
 func (a *api) deleteSensor(ctx context.Context, request *dtos.SensorRequestById) (*APIResponseWithoutBody, error) {
 	err := a.service.DeleteSensor(ctx, request.Id)
 
 	if err != nil {
 		log.Errorf("error in deleteSensor endpoint: %v", err)
-		apiErr := errutil.APIErrorHandler(err)
-		return nil, huma.NewError(apiErr.GetStatus(), apiErr.Error())
+		return nil, toHumaError(err)
+	}
+
+	return &APIResponseWithoutBody{}, nil
+}
+
+func (a *api) setSensorFaults(ctx context.Context, req *dtos.SensorFaultsRequest) (*FaultsResponse, error) {
+	version, err := dtos.ParseIfMatch(req.IfMatch)
+	if err != nil {
+		return nil, toHumaError(err)
+	}
+
+	faults := dtos.ToFaultsEntity(&req.Body)
+	version, err = a.service.SetSensorFaults(ctx, req.Id, version, faults)
+
+	if err != nil {
+		log.Errorf("error in setSensorFaults endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	return &FaultsResponse{
+		ETag: dtos.ToETag(version),
+		Body: dtos.ToFaultsDto(faults),
+	}, nil
+}
+
+// Datasets handlers
+func (a *api) createDataset(ctx context.Context, req *dtos.DatasetUploadRequest) (*APIResponse[*dtos.DatasetResponseBody], error) {
+	res, err := a.service.CreateDataset(ctx, req.Name, req.Format, req.RawBody)
+
+	if err != nil {
+		log.Errorf("error in createDataset endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	return &APIResponse[*dtos.DatasetResponseBody]{
+		Body: dtos.ToDatasetResponseDto(res),
+	}, nil
+}
+
+func (a *api) getDatasetList(ctx context.Context, req *struct{}) (*APIResponse[[]*dtos.DatasetResponseBody], error) {
+	res, err := a.service.GetDatasets(ctx)
+
+	if err != nil {
+		log.Errorf("error in getDatasetList endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	var datasetDtoList []*dtos.DatasetResponseBody
+	for _, dataset := range res {
+		datasetDto := dtos.ToDatasetResponseDto(dataset)
+		datasetDtoList = append(datasetDtoList, datasetDto)
+	}
+
+	return &APIResponse[[]*dtos.DatasetResponseBody]{
+		Body: datasetDtoList,
+	}, nil
+}
+
+func (a *api) deleteDataset(ctx context.Context, request *dtos.DatasetRequestById) (*APIResponseWithoutBody, error) {
+	err := a.service.DeleteDataset(ctx, request.Id)
+
+	if err != nil {
+		log.Errorf("error in deleteDataset endpoint: %v", err)
+		return nil, toHumaError(err)
 	}
 
 	return &APIResponseWithoutBody{}, nil
 }
 
+// Dead letters handlers
+func (a *api) getDeadLetterList(ctx context.Context, req *struct{}) (*APIResponse[[]*dtos.DeadLetterResponseBody], error) {
+	res, err := a.service.GetDeadLetters(ctx)
+
+	if err != nil {
+		log.Errorf("error in getDeadLetterList endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	var deadLetterDtoList []*dtos.DeadLetterResponseBody
+	for _, deadLetter := range res {
+		deadLetterDto := dtos.ToDeadLetterResponseDto(deadLetter)
+		deadLetterDtoList = append(deadLetterDtoList, deadLetterDto)
+	}
+
+	return &APIResponse[[]*dtos.DeadLetterResponseBody]{
+		Body: deadLetterDtoList,
+	}, nil
+}
+
+func (a *api) getDeadLetter(ctx context.Context, request *dtos.DeadLetterRequestBySequence) (*APIResponse[*dtos.DeadLetterResponseBody], error) {
+	res, err := a.service.GetDeadLetter(ctx, request.Sequence)
+
+	if err != nil {
+		log.Errorf("error in getDeadLetter endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	return &APIResponse[*dtos.DeadLetterResponseBody]{
+		Body: dtos.ToDeadLetterResponseDto(res),
+	}, nil
+}
+
+func (a *api) redriveDeadLetter(ctx context.Context, request *dtos.DeadLetterRequestBySequence) (*APIResponseWithoutBody, error) {
+	err := a.service.RedriveDeadLetter(ctx, request.Sequence)
+
+	if err != nil {
+		log.Errorf("error in redriveDeadLetter endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	return &APIResponseWithoutBody{}, nil
+}
+
+func (a *api) deleteDeadLetter(ctx context.Context, request *dtos.DeadLetterRequestBySequence) (*APIResponseWithoutBody, error) {
+	err := a.service.DeleteDeadLetter(ctx, request.Sequence)
+
+	if err != nil {
+		log.Errorf("error in deleteDeadLetter endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	return &APIResponseWithoutBody{}, nil
+}
+
+// Retention handlers
+func (a *api) getRetentionPolicy(ctx context.Context, req *struct{}) (*APIResponse[*dtos.RetentionResponseBody], error) {
+	res, err := a.service.GetRetentionPolicy(ctx)
+
+	if err != nil {
+		log.Errorf("error in getRetentionPolicy endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	return &APIResponse[*dtos.RetentionResponseBody]{
+		Body: dtos.ToRetentionResponseDto(res),
+	}, nil
+}
+
+func (a *api) setRetentionPolicy(ctx context.Context, req *dtos.RetentionRequest) (*APIResponse[*dtos.RetentionResponseBody], error) {
+	var def *time.Duration
+	if req.Body.Default != nil {
+		d := time.Duration(*req.Body.Default)
+		def = &d
+	}
+
+	res, err := a.service.SetRetentionPolicy(ctx, def, dtos.ToRetentionTypes(req.Body.Types))
+
+	if err != nil {
+		log.Errorf("error in setRetentionPolicy endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	return &APIResponse[*dtos.RetentionResponseBody]{
+		Body: dtos.ToRetentionResponseDto(res),
+	}, nil
+}
+
 // Metrics handlers
-func (a *api) getMetricsData(ctx context.Context, req *struct{}) (*APIResponse[[]*dtos.MetricResponse], error) {
-	res, err := a.service.GetMetricsData(ctx)
+func (a *api) getMetricsData(ctx context.Context, req *dtos.MetricsRequest) (*APIResponse[[]*dtos.MetricResponse], error) {
+	now := time.Now()
+	from, err := dtos.ParseOptionalTime(req.From, now)
+	if err != nil {
+		return nil, huma.NewError(400, "validation error: from: "+err.Error())
+	}
+	to, err := dtos.ParseOptionalTime(req.To, now)
+	if err != nil {
+		return nil, huma.NewError(400, "validation error: to: "+err.Error())
+	}
+
+	res, err := a.service.GetMetricsData(ctx, from, to)
 
 	if err != nil {
 		log.Errorf("error in getMetricsData endpoint: %v", err)
-		apiErr := errutil.APIErrorHandler(err)
-		return nil, huma.NewError(apiErr.GetStatus(), apiErr.Error())
+		return nil, toHumaError(err)
 	}
 
 	var metricsDtoList []*dtos.MetricResponse
@@ -187,3 +491,169 @@ func (a *api) getMetricsData(ctx context.Context, req *struct{}) (*APIResponse[[
 		Body: metricsDtoList,
 	}, nil
 }
+
+func (a *api) getLatestMetrics(ctx context.Context, req *struct{}) (*APIResponse[[]*dtos.LatestMetricResponse], error) {
+	res, err := a.service.GetLatestMetrics(ctx)
+
+	if err != nil {
+		log.Errorf("error in getLatestMetrics endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	latestDtoList := make([]*dtos.LatestMetricResponse, 0, len(res))
+	for _, latest := range res {
+		latestDtoList = append(latestDtoList, dtos.ToLatestMetricResponseDto(latest))
+	}
+
+	return &APIResponse[[]*dtos.LatestMetricResponse]{
+		Body: latestDtoList,
+	}, nil
+}
+
+func (a *api) getLatestMetric(ctx context.Context, request *dtos.SensorRequestById) (*APIResponse[*dtos.LatestMetricResponse], error) {
+	res, err := a.service.GetLatestMetric(ctx, request.Id)
+
+	if err != nil {
+		log.Errorf("error in getLatestMetric endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	return &APIResponse[*dtos.LatestMetricResponse]{
+		Body: dtos.ToLatestMetricResponseDto(res),
+	}, nil
+}
+
+func (a *api) getMetricAggregates(ctx context.Context, req *dtos.MetricAggregateRequest) (*APIResponse[[]*dtos.MetricAggregateResponse], error) {
+	var bucket time.Duration
+	if req.Bucket != "" {
+		var err error
+		bucket, err = dtos.ParseDuration(req.Bucket)
+		if err != nil || bucket <= 0 || bucket%time.Millisecond != 0 {
+			return nil, huma.NewError(400, "validation error: bucket must be a positive duration of whole milliseconds")
+		}
+	}
+
+	query, err := dtos.ToMetricAggregateQuery(req, bucket, time.Now())
+	if err != nil {
+		return nil, huma.NewError(400, "validation error: "+err.Error())
+	}
+
+	res, err := a.service.GetMetricAggregates(ctx, query)
+
+	if err != nil {
+		log.Errorf("error in getMetricAggregates endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	aggregateDtoList := make([]*dtos.MetricAggregateResponse, 0, len(res))
+	for _, aggregate := range res {
+		aggregateDtoList = append(aggregateDtoList, dtos.ToMetricAggregateResponseDto(aggregate))
+	}
+
+	return &APIResponse[[]*dtos.MetricAggregateResponse]{
+		Body: aggregateDtoList,
+	}, nil
+}
+
+// This function streams the metrics of a time range as CSV, NDJSON or Parquet
+func (a *api) exportMetrics(ctx context.Context, req *dtos.MetricExportRequest) (*huma.StreamResponse, error) {
+	format, ok := dtos.NegotiateExportFormat(req.Format, req.Accept)
+	if !ok {
+		return nil, huma.NewError(406, "exports are available as text/csv, application/x-ndjson or application/vnd.apache.parquet")
+	}
+
+	query, err := dtos.ToMetricExportQuery(req, time.Now())
+	if err != nil {
+		return nil, huma.NewError(400, "validation error: "+err.Error())
+	}
+
+	cursor, err := a.service.ExportMetrics(ctx, query)
+
+	if err != nil {
+		log.Errorf("error in exportMetrics endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	return &huma.StreamResponse{
+		Body: func(hctx huma.Context) {
+			defer cursor.Close()
+
+			hctx.SetHeader("Content-Type", dtos.ExportContentType(format))
+			hctx.SetHeader("Content-Disposition", `attachment; filename="metrics.`+format+`"`)
+			if err := writeMetricExport(hctx.Context(), cursor, format, hctx.BodyWriter()); err != nil {
+				log.Errorf("error in exportMetrics endpoint: %v", err)
+				// The status is already sent. Aborting the response tells the client that it is
+				// incomplete
+				panic(http.ErrAbortHandler)
+			}
+		},
+	}, nil
+}
+
+// This function streams the live metrics as Server-Sent Events
+func (a *api) streamMetrics(ctx context.Context, req *dtos.MetricStreamRequest) (*huma.StreamResponse, error) {
+	stream, err := a.service.StreamMetrics(ctx, dtos.ToMetricStreamFilter(req))
+
+	if err != nil {
+		log.Errorf("error in streamMetrics endpoint: %v", err)
+		return nil, toHumaError(err)
+	}
+
+	return &huma.StreamResponse{
+		Body: func(hctx huma.Context) {
+			defer stream.Close()
+
+			hctx.SetHeader("Content-Type", "text/event-stream")
+			hctx.SetHeader("Cache-Control", "no-cache")
+			writer := newEventStreamWriter(hctx.BodyWriter())
+			// Clients wait for the headers until the first event otherwise
+			err := writer.Flush()
+			if err == nil {
+				err = serveMetricStream(hctx.Context(), stream, writer)
+			}
+			if err != nil {
+				log.Debugf("metric stream closed: %v", err)
+			}
+		},
+	}, nil
+}
+
+// This function streams the live metrics through a WebSocket. It takes the same query as
+// streamMetrics
+func (a *api) streamMetricsWebSocket(w http.ResponseWriter, r *http.Request) {
+	filter, err := dtos.ParseMetricStreamQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, huma.NewError(400, "validation error: "+err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	stream, err := a.service.StreamMetrics(ctx, filter)
+	if err != nil {
+		log.Errorf("error in streamMetricsWebSocket endpoint: %v", err)
+		writeError(w, toHumaError(err))
+		return
+	}
+	defer stream.Close()
+
+	conn, err := upgradeWebSocket(a.wsUpgrade, w, r)
+	if err != nil {
+		log.Errorf("error in streamMetricsWebSocket endpoint: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// The client leaves when it closes the WebSocket or the connection is lost
+	go func() {
+		defer cancel()
+		if err := conn.ReadUntilClose(); err != nil {
+			log.Debugf("metric stream closed by the client: %v", err)
+		}
+	}()
+
+	if err := serveMetricStream(ctx, stream, conn); err != nil {
+		log.Debugf("metric stream closed: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/api/dtos"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+func TestToHumaError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: fmt.Errorf("%w: rate must be positive", domain.ErrInvalidSimulation), want: 400},
+		{err: domain.ErrSensorNotFound, want: 404},
+		{err: domain.ErrDatasetInUse, want: 409},
+		{err: domain.ErrVersionConflict, want: 412},
+		{err: dtos.ErrInvalidETag, want: 412},
+		{err: dtos.ErrMissingIfMatch, want: 428},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			var statusErr huma.StatusError
+			if !errors.As(toHumaError(tt.err), &statusErr) || statusErr.GetStatus() != tt.want {
+				t.Errorf("toHumaError(%v) = %v, want status %d", tt.err, statusErr, tt.want)
+			}
+		})
+	}
+}
+
+// fakeLatestService returns the latest metric of a single sensor. The rest of the service is not
+// implemented
+type fakeLatestService struct {
+	domain.Service
+	latest *entity.LatestMetric
+}
+
+func (s *fakeLatestService) GetLatestMetric(ctx context.Context, sensorID string) (*entity.LatestMetric, error) {
+	switch sensorID {
+	case s.latest.SensorID:
+		return s.latest, nil
+	case "2a1d7b55-93a4-4c1e-9d0f-3c8f4a6e5b21":
+		return nil, domain.ErrMetricNotFound
+	default:
+		return nil, domain.ErrSensorNotFound
+	}
+}
+
+func (s *fakeLatestService) GetLatestMetrics(ctx context.Context) ([]*entity.LatestMetric, error) {
+	return []*entity.LatestMetric{s.latest}, nil
+}
+
+func TestLatestMetricEndpoints(t *testing.T) {
+	latest := &entity.LatestMetric{
+		Metric: entity.Metric{SensorID: "8cf3030f-2206-4fcb-8c42-d0eb70e197ab", Value: 21.5, Unit: "ºC",
+			Timestamp: 1714521600000, OutOfRange: true},
+		Age: 90 * time.Second,
+	}
+	a := &api{service: &fakeLatestService{latest: latest}}
+	want := `{"sensorId":"8cf3030f-2206-4fcb-8c42-d0eb70e197ab","value":21.5,"unit":"ºC","timestamp":1714521600000,"outOfRange":true,"age":"1m30s"}`
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "latest metric", id: latest.SensorID, wantBody: want},
+		{name: "sensor without metrics", id: "2a1d7b55-93a4-4c1e-9d0f-3c8f4a6e5b21", wantStatus: 404},
+		{name: "unknown sensor", id: "d1e4b0a6-5f43-4c7e-8a39-7b2c6f0e9d14", wantStatus: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := a.getLatestMetric(context.Background(), &dtos.SensorRequestById{Id: tt.id})
+			if tt.wantStatus != 0 {
+				var statusErr huma.StatusError
+				if !errors.As(err, &statusErr) || statusErr.GetStatus() != tt.wantStatus {
+					t.Errorf("getLatestMetric() error = %v, want status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, err := json.Marshal(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("getLatestMetric() = %s, want %s", body, tt.wantBody)
+			}
+		})
+	}
+
+	res, err := a.getLatestMetrics(context.Background(), &struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "["+want+"]" {
+		t.Errorf("getLatestMetrics() = %s, want [%s]", body, want)
+	}
+}
@@ -0,0 +1,33 @@
+package dtos
+
+import (
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+type DatasetUploadRequest struct {
+	Name    string `query:"name" required:"true"`
+	Format  string `query:"format" required:"true" enum:"csv,ndjson"`
+	RawBody []byte `contentType:"text/csv"`
+}
+
+type DatasetRequestById struct {
+	Id string `path:"id"`
+}
+
+type DatasetResponseBody struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Format    string `json:"format"`
+	Samples   int    `json:"samples"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+func ToDatasetResponseDto(res *entity.Dataset) *DatasetResponseBody {
+	return &DatasetResponseBody{
+		ID:        res.ID,
+		Name:      res.Name,
+		Format:    res.Format,
+		Samples:   res.Samples,
+		CreatedAt: res.CreatedAt,
+	}
+}
@@ -0,0 +1,44 @@
+package dtos
+
+import (
+	"unicode/utf8"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+type DeadLetterRequestBySequence struct {
+	Sequence uint64 `path:"seq"`
+}
+
+type DeadLetterResponseBody struct {
+	Sequence       uint64 `json:"sequence"`
+	Subject        string `json:"subject"`
+	Reason         string `json:"reason"`
+	Attempts       int    `json:"attempts"`
+	Stream         string `json:"stream,omitempty"`
+	StreamSequence uint64 `json:"streamSequence,omitempty"`
+	// Text payloads are returned as they are and binary ones in base64
+	Payload       string `json:"payload,omitempty"`
+	PayloadBase64 []byte `json:"payloadBase64,omitempty"`
+	FailedAt      int64  `json:"failedAt"`
+}
+
+func ToDeadLetterResponseDto(res *entity.DeadLetter) *DeadLetterResponseBody {
+	body := &DeadLetterResponseBody{
+		Sequence:       res.Sequence,
+		Subject:        res.Subject,
+		Reason:         res.Reason,
+		Attempts:       res.Attempts,
+		Stream:         res.Stream,
+		StreamSequence: res.StreamSequence,
+		FailedAt:       res.FailedAt,
+	}
+
+	if utf8.Valid(res.Payload) {
+		body.Payload = string(res.Payload)
+	} else {
+		body.PayloadBase64 = res.Payload
+	}
+
+	return body
+}
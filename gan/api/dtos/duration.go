@@ -0,0 +1,62 @@
+package dtos
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// Duration is a time span given as a Go duration string ("100ms", "1m30s") or as a number of
+// seconds, which was the original format of sensor rates
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string or a number of seconds")
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// This function parses a Go duration string or a number of seconds, for durations given in
+// query parameters
+func ParseDuration(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// Schema implements huma.SchemaProvider
+func (d Duration) Schema(r huma.Registry) *huma.Schema {
+	return &huma.Schema{
+		Description: "Go duration string, e.g. 100ms or 1m30s, or number of seconds",
+		OneOf: []*huma.Schema{
+			{Type: huma.TypeString, Examples: []any{"100ms"}},
+			{Type: huma.TypeNumber},
+		},
+	}
+}
@@ -0,0 +1,43 @@
+package dtos
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidETag is returned when an If-Match header is not an ETag of a sensor
+var ErrInvalidETag = errors.New("If-Match must be an ETag returned by the API or *")
+
+// ErrMissingIfMatch is returned when a sensor is updated without an If-Match header
+var ErrMissingIfMatch = errors.New("If-Match is required to update a sensor, send the ETag returned by the API or *")
+
+// This function returns the ETag of a version of a sensor
+func ToETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// This function returns the version of a sensor required by an If-Match header. 0 means any
+// version, when the header is *. The header is required, so blind updates must be explicit
+func ParseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, ErrMissingIfMatch
+	}
+	if header == "*" {
+		return 0, nil
+	}
+
+	// Weak ETags are accepted too, versions are never reused
+	unquoted, err := strconv.Unquote(strings.TrimPrefix(header, "W/"))
+	if err != nil {
+		return 0, ErrInvalidETag
+	}
+
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, ErrInvalidETag
+	}
+
+	return version, nil
+}
@@ -0,0 +1,41 @@
+package dtos
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    int64
+		wantErr error
+	}{
+		{header: "", wantErr: ErrMissingIfMatch},
+		{header: "  ", wantErr: ErrMissingIfMatch},
+		{header: "*", want: 0},
+		{header: ` "3" `, want: 3},
+		{header: ToETag(42), want: 42},
+		{header: `W/"7"`, want: 7},
+		{header: "3", wantErr: ErrInvalidETag},
+		{header: `"abc"`, wantErr: ErrInvalidETag},
+		{header: `"0"`, wantErr: ErrInvalidETag},
+		{header: `"-1"`, wantErr: ErrInvalidETag},
+		{header: `"1", "2"`, wantErr: ErrInvalidETag},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, err := ParseIfMatch(tt.header)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseIfMatch(%q) error = %v, want %v", tt.header, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseIfMatch(%q) = %d, %v, want %d", tt.header, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package dtos
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+// Formats of the metric exports
+const (
+	CSV_FORMAT     = "csv"
+	NDJSON_FORMAT  = "ndjson"
+	PARQUET_FORMAT = "parquet"
+)
+
+// Content type of every export format
+var exportContentTypes = map[string]string{
+	CSV_FORMAT:     "text/csv",
+	NDJSON_FORMAT:  "application/x-ndjson",
+	PARQUET_FORMAT: "application/vnd.apache.parquet",
+}
+
+// Media types accepted for every export format, including the usual aliases
+var exportMediaTypes = map[string]string{
+	"text/csv":                       CSV_FORMAT,
+	"application/x-ndjson":           NDJSON_FORMAT,
+	"application/ndjson":             NDJSON_FORMAT,
+	"application/jsonl":              NDJSON_FORMAT,
+	"application/vnd.apache.parquet": PARQUET_FORMAT,
+	"application/x-parquet":          PARQUET_FORMAT,
+	"*/*":                            CSV_FORMAT,
+	"text/*":                         CSV_FORMAT,
+}
+
+type MetricExportRequest struct {
+	// Comma separated sensor IDs. Every sensor by default
+	SensorID []string `query:"sensorId"`
+	// RFC3339, UNIX milliseconds, now or relative to now like -1h. Included
+	From string `query:"from"`
+	// RFC3339, UNIX milliseconds, now or relative to now like -1h. Not included
+	To string `query:"to"`
+	// It takes precedence over the Accept header
+	Format string `query:"format" enum:"csv,ndjson,parquet"`
+	Accept string `header:"Accept"`
+}
+
+func ToMetricExportQuery(req *MetricExportRequest, now time.Time) (entity.MetricExportQuery, error) {
+	query := entity.MetricExportQuery{SensorIDs: req.SensorID}
+
+	var err error
+	if query.From, err = ParseOptionalTime(req.From, now); err != nil {
+		return query, err
+	}
+	if query.To, err = ParseOptionalTime(req.To, now); err != nil {
+		return query, err
+	}
+
+	return query, nil
+}
+
+// This function chooses the format of an export from the format parameter or, if it is not given,
+// from the media type with the highest quality in the Accept header. CSV is the default. It
+// returns false if none of the accepted media types can be exported
+func NegotiateExportFormat(format string, accept string) (string, bool) {
+	if format != "" {
+		_, ok := exportContentTypes[format]
+		return format, ok
+	}
+	if strings.TrimSpace(accept) == "" {
+		return CSV_FORMAT, true
+	}
+
+	best, bestQuality := "", 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		candidate, ok := exportMediaTypes[mediaType]
+		if !ok {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = candidate, quality
+		}
+	}
+
+	return best, best != ""
+}
+
+func ExportContentType(format string) string {
+	return exportContentTypes[format]
+}
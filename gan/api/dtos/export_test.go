@@ -0,0 +1,36 @@
+package dtos
+
+import "testing"
+
+func TestNegotiateExportFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		accept string
+		want   string
+		ok     bool
+	}{
+		{name: "default", want: CSV_FORMAT, ok: true},
+		{name: "format parameter", format: PARQUET_FORMAT, accept: "text/csv", want: PARQUET_FORMAT, ok: true},
+		{name: "unknown format parameter", format: "xml", want: "xml", ok: false},
+		{name: "accept", accept: "application/x-ndjson", want: NDJSON_FORMAT, ok: true},
+		{name: "alias", accept: "application/x-parquet", want: PARQUET_FORMAT, ok: true},
+		{name: "media type parameters", accept: "text/csv; charset=utf-8", want: CSV_FORMAT, ok: true},
+		{name: "highest quality", accept: "text/csv;q=0.5, application/vnd.apache.parquet;q=0.9", want: PARQUET_FORMAT, ok: true},
+		{name: "first of equal quality", accept: "application/jsonl, text/csv", want: NDJSON_FORMAT, ok: true},
+		{name: "wildcard", accept: "*/*", want: CSV_FORMAT, ok: true},
+		{name: "unsupported media types are skipped", accept: "application/xml, application/ndjson;q=0.1", want: NDJSON_FORMAT, ok: true},
+		{name: "zero quality", accept: "text/csv;q=0", ok: false},
+		{name: "invalid quality", accept: "text/csv;q=high", ok: false},
+		{name: "unsupported", accept: "application/json", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NegotiateExportFormat(tt.format, tt.accept)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("NegotiateExportFormat(%q, %q) = %q, %v, want %q, %v", tt.format, tt.accept, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package dtos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// This function applies a JSON Merge Patch (RFC 7386) to a JSON document. Null members of the
+// patch delete the members of the document and objects are merged recursively
+func ApplyMergePatch(doc []byte, patch []byte) ([]byte, error) {
+	var target any
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+
+	var changes any
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, fmt.Errorf("patch is not valid JSON: %v", err)
+	}
+
+	return json.Marshal(mergePatch(target, changes))
+}
+
+func mergePatch(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+
+	return targetObject
+}
+
+// This function decodes a patched document rejecting unknown members, which are usually typos
+func decodeStrict(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	return decoder.Decode(v)
+}
@@ -1,6 +1,12 @@
 package dtos
 
 import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
 )
 
@@ -9,13 +15,152 @@ type MetricResponse struct {
 	Value     float32 `json:"value"`
 	Unit      string  `json:"unit"`
 	Timestamp int64   `json:"timestamp"`
+	// The value is out of the thresholds of the sensor
+	OutOfRange bool `json:"outOfRange"`
 }
 
 func ToMetricResponseDto(res *entity.Metric) *MetricResponse {
 	return &MetricResponse{
-		SensorID:  res.SensorID,
-		Value:     res.Value,
-		Unit:      res.Unit,
+		SensorID:   res.SensorID,
+		Value:      res.Value,
+		Unit:       res.Unit,
+		Timestamp:  res.Timestamp,
+		OutOfRange: res.OutOfRange,
+	}
+}
+
+type MetricsRequest struct {
+	// RFC3339, UNIX milliseconds, now or relative to now like -1h. Included
+	From string `query:"from"`
+	// RFC3339, UNIX milliseconds, now or relative to now like -1h. Not included
+	To string `query:"to"`
+}
+
+type MetricAggregateRequest struct {
+	SensorID string `query:"sensorId" required:"true"`
+	// Width of the buckets, as a Go duration string or a number of seconds
+	Bucket string `query:"bucket"`
+	// RFC3339, UNIX milliseconds, now or relative to now like -1h. 24 hours before to by default
+	From string `query:"from"`
+	// RFC3339, UNIX milliseconds, now or relative to now like -1h. Now by default
+	To string `query:"to"`
+	Fn string `query:"fn" enum:"avg,min,max,count" default:"avg"`
+}
+
+type MetricAggregateResponse struct {
+	// UNIX milliseconds where the bucket starts
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+func ToMetricAggregateQuery(req *MetricAggregateRequest, bucket time.Duration, now time.Time) (entity.MetricAggregateQuery, error) {
+	query := entity.MetricAggregateQuery{
+		SensorID: req.SensorID,
+		Bucket:   bucket.Milliseconds(),
+		Fn:       req.Fn,
+	}
+
+	to, err := ParseOptionalTime(req.To, now)
+	if err != nil {
+		return query, err
+	}
+	from, err := ParseOptionalTime(req.From, now)
+	if err != nil {
+		return query, err
+	}
+
+	query.To = now.UnixMilli()
+	if to != nil {
+		query.To = *to
+	}
+	query.From = query.To - (24 * time.Hour).Milliseconds()
+	if from != nil {
+		query.From = *from
+	}
+
+	return query, nil
+}
+
+func ToMetricAggregateResponseDto(res *entity.MetricAggregate) *MetricAggregateResponse {
+	return &MetricAggregateResponse{
 		Timestamp: res.Timestamp,
+		Value:     res.Value,
+	}
+}
+
+type LatestMetricResponse struct {
+	MetricResponse
+	// Time since the metric was generated
+	Age Duration `json:"age"`
+}
+
+func ToLatestMetricResponseDto(res *entity.LatestMetric) *LatestMetricResponse {
+	return &LatestMetricResponse{
+		MetricResponse: *ToMetricResponseDto(&res.Metric),
+		Age:            Duration(res.Age),
+	}
+}
+
+type MetricStreamRequest struct {
+	// Comma separated sensor IDs. Every sensor by default
+	SensorID []string `query:"sensorId"`
+	// Comma separated sensor types. Every type by default
+	Type []string `query:"type"`
+	// Only metrics out of the thresholds of their sensor
+	OutOfRange bool `query:"outOfRange"`
+}
+
+// Metrics not sent since the previous event because the client was too slow
+type MetricStreamLossResponse struct {
+	// Discarded because the buffer of the client was full
+	Dropped uint64 `json:"dropped"`
+	// Replaced by a newer metric of the same sensor
+	Coalesced uint64 `json:"coalesced"`
+}
+
+func ToMetricStreamFilter(req *MetricStreamRequest) entity.MetricStreamFilter {
+	return entity.MetricStreamFilter{
+		SensorIDs:  req.SensorID,
+		Types:      req.Type,
+		OutOfRange: req.OutOfRange,
+	}
+}
+
+// This function reads the filter of a metric stream from the query of a request which does not
+// go through huma, like WebSocket upgrades. Lists are comma separated as in MetricStreamRequest
+func ParseMetricStreamQuery(query url.Values) (entity.MetricStreamFilter, error) {
+	req := &MetricStreamRequest{
+		SensorID: splitQueryList(query["sensorId"]),
+		Type:     splitQueryList(query["type"]),
+	}
+
+	if value := query.Get("outOfRange"); value != "" {
+		outOfRange, err := strconv.ParseBool(value)
+		if err != nil {
+			return entity.MetricStreamFilter{}, errors.New("outOfRange must be true or false")
+		}
+		req.OutOfRange = outOfRange
+	}
+
+	return ToMetricStreamFilter(req), nil
+}
+
+func splitQueryList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+
+	return list
+}
+
+func ToMetricStreamLossDto(loss entity.MetricStreamLoss) *MetricStreamLossResponse {
+	return &MetricStreamLossResponse{
+		Dropped:   loss.Dropped,
+		Coalesced: loss.Coalesced,
 	}
 }
@@ -0,0 +1,49 @@
+package dtos
+
+import (
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+type RetentionRequest struct {
+	Body RetentionRequestBody `contentType:"application/json"`
+}
+
+type RetentionRequestBody struct {
+	// Retention of the sensor types without their own one. Missing applies the configured default
+	Default *Duration `json:"default,omitempty"`
+	// Retention of every sensor type
+	Types map[string]Duration `json:"types,omitempty"`
+}
+
+type RetentionResponseBody struct {
+	Default   *Duration           `json:"default,omitempty"`
+	Types     map[string]Duration `json:"types"`
+	UpdatedAt int64               `json:"updatedAt,omitempty"`
+}
+
+func ToRetentionTypes(req map[string]Duration) map[string]time.Duration {
+	types := make(map[string]time.Duration, len(req))
+	for typ, retention := range req {
+		types[typ] = time.Duration(retention)
+	}
+
+	return types
+}
+
+func ToRetentionResponseDto(res *entity.RetentionPolicy) *RetentionResponseBody {
+	body := &RetentionResponseBody{
+		Types:     make(map[string]Duration, len(res.Types)),
+		UpdatedAt: res.UpdatedAt,
+	}
+	if res.Default != nil {
+		def := Duration(*res.Default)
+		body.Default = &def
+	}
+	for typ, retention := range res.Types {
+		body.Types[typ] = Duration(retention)
+	}
+
+	return body
+}
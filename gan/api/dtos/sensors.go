@@ -1,34 +1,71 @@
 package dtos
 
 import (
+	"encoding/json"
+	"time"
+
 	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
 )
 
 type SensorBaseRequest struct {
-	Body SensorRequestBody `contentType:"application/json"`
+	// ETag of the sensor read by the client. The sensor is not updated if it has changed since then
+	IfMatch string            `header:"If-Match"`
+	Body    SensorRequestBody `contentType:"application/json"`
 }
 
 type SensorRequestById struct {
 	Id string `path:"id"`
 }
 
+type SensorPatchRequest struct {
+	Id      string `path:"id"`
+	IfMatch string `header:"If-Match"`
+	// JSON Merge Patch (RFC 7386) of the sensor settings
+	RawBody []byte `contentType:"application/merge-patch+json"`
+}
+
+type SensorFaultsRequest struct {
+	Id string `path:"id"`
+	// ETag of the sensor read by the client. The faults are not updated if it has changed since then
+	IfMatch string     `header:"If-Match"`
+	Body    FaultsBody `contentType:"application/json"`
+}
+
 type SensorRequestBody struct {
-	ID           string  `json:"id"`
-	Type         string  `json:"type"`
-	Alias        string  `json:"alias"`
-	Rate         int     `json:"rate"`
-	MaxThreshold float32 `json:"maxThreshold"`
-	MinThreshold float32 `json:"minThreshold"`
+	ID                    string         `json:"id"`
+	Type                  string         `json:"type"`
+	Alias                 string         `json:"alias"`
+	Rate                  Duration       `json:"rate"`
+	Jitter                *Duration      `json:"jitter,omitempty"`
+	MaxThreshold          float32        `json:"maxThreshold"`
+	MinThreshold          float32        `json:"minThreshold"`
+	Generator             *GeneratorBody `json:"generator,omitempty"`
+	Seed                  *int64         `json:"seed,omitempty"`
+	ThresholdCrossingRate *float64       `json:"thresholdCrossingRate,omitempty" minimum:"0" maximum:"1"`
+	Faults                *FaultsBody    `json:"faults,omitempty"`
+	Replay                *ReplayBody    `json:"replay,omitempty"`
 }
 
 type SensorResponseBody struct {
-	ID           string  `json:"id"`
-	Type         string  `json:"type"`
-	Alias        string  `json:"alias"`
-	Rate         int     `json:"rate"`
-	MaxThreshold float32 `json:"maxThreshold"`
-	MinThreshold float32 `json:"minThreshold"`
-	UpdatedAt    int64   `json:"updatedAt"`
+	ID                    string        `json:"id"`
+	Type                  string        `json:"type"`
+	Alias                 string        `json:"alias"`
+	Rate                  Duration      `json:"rate"`
+	Jitter                Duration      `json:"jitter"`
+	MaxThreshold          float32       `json:"maxThreshold"`
+	MinThreshold          float32       `json:"minThreshold"`
+	Generator             GeneratorBody `json:"generator"`
+	Seed                  *int64        `json:"seed,omitempty"`
+	ThresholdCrossingRate *float64      `json:"thresholdCrossingRate,omitempty"`
+	Faults                FaultsBody    `json:"faults"`
+	Replay                *ReplayBody   `json:"replay,omitempty"`
+	UpdatedAt             int64         `json:"updatedAt"`
+	Version               int64         `json:"version"`
+}
+
+type GeneratorBody struct {
+	Type   string             `json:"type" enum:"uniform,random-walk,sine,gaussian,constant,step"`
+	Params map[string]float64 `json:"params,omitempty"`
 }
 
 func ToSensorResponseDto(res *entity.Sensor) *SensorResponseBody {
@@ -36,13 +73,199 @@ func ToSensorResponseDto(res *entity.Sensor) *SensorResponseBody {
 		ID:           res.ID,
 		Type:         res.Type,
 		Alias:        res.Alias,
-		Rate:         res.Rate,
+		Rate:         Duration(res.Rate),
+		Jitter:       Duration(res.Jitter),
 		MaxThreshold: res.MaxThreshold,
 		MinThreshold: res.MinThreshold,
-		UpdatedAt:    res.UpdatedAt,
+		Generator: GeneratorBody{
+			Type:   res.Generator.Type,
+			Params: res.Generator.Params,
+		},
+		ThresholdCrossingRate: res.ThresholdCrossingRate,
+		Seed:                  res.Seed,
+		Faults:                *ToFaultsDto(res.Faults),
+		Replay:                toReplayDto(res.Replay),
+		UpdatedAt:             res.UpdatedAt,
+		Version:               res.Version,
+	}
+}
+
+// This function returns the settings of a sensor as they are given in requests
+func ToSensorRequestDto(res *entity.Sensor) *SensorRequestBody {
+	jitter := Duration(res.Jitter)
+	return &SensorRequestBody{
+		ID:           res.ID,
+		Type:         res.Type,
+		Alias:        res.Alias,
+		Rate:         Duration(res.Rate),
+		Jitter:       &jitter,
+		MaxThreshold: res.MaxThreshold,
+		MinThreshold: res.MinThreshold,
+		Generator: &GeneratorBody{
+			Type:   res.Generator.Type,
+			Params: res.Generator.Params,
+		},
+		ThresholdCrossingRate: res.ThresholdCrossingRate,
+		Seed:                  res.Seed,
+		Faults:                ToFaultsDto(res.Faults),
+		Replay:                toReplayDto(res.Replay),
+	}
+}
+
+// This function applies a JSON Merge Patch to the settings of a sensor
+func PatchSensorEntity(sensor *entity.Sensor, patch []byte) error {
+	doc, err := json.Marshal(ToSensorRequestDto(sensor))
+	if err != nil {
+		return err
+	}
+
+	patched, err := ApplyMergePatch(doc, patch)
+	if err != nil {
+		return err
+	}
+
+	var body SensorRequestBody
+	if err := decodeStrict(patched, &body); err != nil {
+		return err
+	}
+
+	sensor.ID = body.ID
+	sensor.Type = body.Type
+	sensor.Alias = body.Alias
+	sensor.Rate = time.Duration(body.Rate)
+	sensor.Jitter = ToJitter(body.Jitter)
+	sensor.MaxThreshold = body.MaxThreshold
+	sensor.MinThreshold = body.MinThreshold
+	sensor.Generator = ToGeneratorEntity(body.Generator)
+	sensor.ThresholdCrossingRate = body.ThresholdCrossingRate
+	sensor.Seed = body.Seed
+	sensor.Faults = ToFaultsEntity(body.Faults)
+	sensor.Replay = ToReplayEntity(body.Replay)
+
+	return nil
+}
+
+// The generator is optional in requests, the uniform generator is used by default
+func ToGeneratorEntity(req *GeneratorBody) entity.Generator {
+	if req == nil {
+		return entity.Generator{}
+	}
+
+	return entity.Generator{
+		Type:   req.Type,
+		Params: req.Params,
+	}
+}
+
+type FaultsBody struct {
+	Dropout   *FaultBody `json:"dropout,omitempty"`
+	StuckAt   *FaultBody `json:"stuckAt,omitempty"`
+	Spike     *FaultBody `json:"spike,omitempty"`
+	Drift     *FaultBody `json:"drift,omitempty"`
+	Garbage   *FaultBody `json:"garbage,omitempty"`
+	Duplicate *FaultBody `json:"duplicate,omitempty"`
+}
+
+type FaultBody struct {
+	Enabled     bool    `json:"enabled"`
+	Probability float64 `json:"probability" minimum:"0" maximum:"1"`
+	Duration    float64 `json:"duration,omitempty" minimum:"0"`
+	Magnitude   float64 `json:"magnitude,omitempty"`
+}
+
+func ToFaultsDto(res entity.FaultProfile) *FaultsBody {
+	return &FaultsBody{
+		Dropout:   toFaultDto(res.Dropout),
+		StuckAt:   toFaultDto(res.StuckAt),
+		Spike:     toFaultDto(res.Spike),
+		Drift:     toFaultDto(res.Drift),
+		Garbage:   toFaultDto(res.Garbage),
+		Duplicate: toFaultDto(res.Duplicate),
+	}
+}
+
+func toFaultDto(res *entity.Fault) *FaultBody {
+	if res == nil {
+		return nil
+	}
+
+	return &FaultBody{
+		Enabled:     res.Enabled,
+		Probability: res.Probability,
+		Duration:    res.Duration,
+		Magnitude:   res.Magnitude,
+	}
+}
+
+// The faults are optional in requests, no faults are injected by default
+func ToFaultsEntity(req *FaultsBody) entity.FaultProfile {
+	if req == nil {
+		return entity.FaultProfile{}
+	}
+
+	return entity.FaultProfile{
+		Dropout:   toFaultEntity(req.Dropout),
+		StuckAt:   toFaultEntity(req.StuckAt),
+		Spike:     toFaultEntity(req.Spike),
+		Drift:     toFaultEntity(req.Drift),
+		Garbage:   toFaultEntity(req.Garbage),
+		Duplicate: toFaultEntity(req.Duplicate),
+	}
+}
+
+func toFaultEntity(req *FaultBody) *entity.Fault {
+	if req == nil {
+		return nil
+	}
+
+	return &entity.Fault{
+		Enabled:     req.Enabled,
+		Probability: req.Probability,
+		Duration:    req.Duration,
+		Magnitude:   req.Magnitude,
 	}
 }
 
+type ReplayBody struct {
+	DatasetID string  `json:"datasetId"`
+	Scale     float64 `json:"scale,omitempty" minimum:"0"`
+	Loop      bool    `json:"loop,omitempty"`
+}
+
+func toReplayDto(res *entity.Replay) *ReplayBody {
+	if res == nil {
+		return nil
+	}
+
+	return &ReplayBody{
+		DatasetID: res.DatasetID,
+		Scale:     res.Scale,
+		Loop:      res.Loop,
+	}
+}
+
+// The replay is optional in requests, sensors use their generator by default
+func ToReplayEntity(req *ReplayBody) *entity.Replay {
+	if req == nil {
+		return nil
+	}
+
+	return &entity.Replay{
+		DatasetID: req.DatasetID,
+		Scale:     req.Scale,
+		Loop:      req.Loop,
+	}
+}
+
+// The jitter is optional in requests, sensors publish at their exact rate by default
+func ToJitter(req *Duration) time.Duration {
+	if req == nil {
+		return 0
+	}
+
+	return time.Duration(*req)
+}
+
 func ValidateSensorType(typ string) bool {
 	switch typ {
 	case "humidity", "temperature", "pressure":
@@ -0,0 +1,48 @@
+package dtos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This function parses an instant given in a query parameter as an RFC3339 string, as UNIX
+// milliseconds, as "now" or as a duration relative to now, such as -1h or -30m
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if s == "now" {
+		return now, nil
+	}
+
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		if d, err := time.ParseDuration(s); err == nil {
+			return now.Add(d), nil
+		}
+	}
+
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC3339 instant, UNIX milliseconds, now or a relative duration like -1h", s)
+	}
+
+	return t, nil
+}
+
+// This function parses an optional instant of a query parameter into UNIX milliseconds
+func ParseOptionalTime(s string, now time.Time) (*int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	t, err := ParseTime(s, now)
+	if err != nil {
+		return nil, err
+	}
+	ms := t.UnixMilli()
+
+	return &ms, nil
+}
@@ -0,0 +1,58 @@
+package dtos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{s: "now", want: now},
+		{s: "-1h", want: now.Add(-time.Hour)},
+		{s: "+30m", want: now.Add(30 * time.Minute)},
+		{s: "-1h30m", want: now.Add(-90 * time.Minute)},
+		{s: "1714564800000", want: now},
+		{s: "-1000", want: time.UnixMilli(-1000)},
+		{s: "2024-05-01T12:00:00Z", want: now},
+		{s: "2024-05-01T14:00:00.5+02:00", want: now.Add(500 * time.Millisecond)},
+		{s: "", wantErr: true},
+		{s: "yesterday", wantErr: true},
+		{s: "-1d", wantErr: true},
+		{s: "2024-05-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseTime(tt.s, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseTime(%q) = %v, want an error", tt.s, got)
+				}
+				return
+			}
+			if err != nil || !got.Equal(tt.want) {
+				t.Errorf("ParseTime(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOptionalTime(t *testing.T) {
+	now := time.UnixMilli(1714564800000)
+
+	if got, err := ParseOptionalTime("", now); got != nil || err != nil {
+		t.Errorf("ParseOptionalTime(\"\") = %v, %v, want nil", got, err)
+	}
+	if got, err := ParseOptionalTime("-1s", now); err != nil || got == nil || *got != 1714564799000 {
+		t.Errorf("ParseOptionalTime(\"-1s\") = %v, %v, want 1714564799000", got, err)
+	}
+	if _, err := ParseOptionalTime("soon", now); err == nil {
+		t.Error("ParseOptionalTime(\"soon\") accepted an invalid instant")
+	}
+}
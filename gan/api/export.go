@@ -0,0 +1,187 @@
+// Bulk exports of metrics, streamed from a database cursor
+
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/api/dtos"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+// Size of the buffer between the encoders and the response
+const EXPORT_BUFFER_SIZE = 64 * 1024
+
+// Rows of every row group of the Parquet exports. Row groups are kept in memory until they are
+// complete, so it bounds the memory of the Parquet encoder
+const PARQUET_ROW_GROUP_SIZE = 65536
+
+// Rows passed to the Parquet writer at once
+const PARQUET_WRITE_BATCH = 1024
+
+// metricEncoder writes the metrics of an export in a format
+type metricEncoder interface {
+	Encode(metric *entity.Metric) error
+	// It writes what the format needs after the last metric
+	Close() error
+}
+
+func newMetricEncoder(format string, w io.Writer) metricEncoder {
+	switch format {
+	case dtos.NDJSON_FORMAT:
+		return &ndjsonMetricEncoder{encoder: json.NewEncoder(w)}
+	case dtos.PARQUET_FORMAT:
+		return newParquetMetricEncoder(w)
+	default:
+		return newCSVMetricEncoder(w)
+	}
+}
+
+// This function writes every metric of a cursor. The memory does not depend on the number of
+// metrics, since they are read in batches and written as they come
+func writeMetricExport(ctx context.Context, cursor domain.MetricCursor, format string, w io.Writer) error {
+	buffered := bufio.NewWriterSize(w, EXPORT_BUFFER_SIZE)
+	encoder := newMetricEncoder(format, buffered)
+
+	for {
+		metrics, err := cursor.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if len(metrics) == 0 {
+			break
+		}
+
+		for _, metric := range metrics {
+			if err := encoder.Encode(metric); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	return buffered.Flush()
+}
+
+// Columns are named like the fields of the JSON metrics
+type csvMetricEncoder struct {
+	writer *csv.Writer
+	header bool
+}
+
+func newCSVMetricEncoder(w io.Writer) *csvMetricEncoder {
+	return &csvMetricEncoder{writer: csv.NewWriter(w)}
+}
+
+func (e *csvMetricEncoder) Encode(metric *entity.Metric) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	return e.writer.Write([]string{
+		metric.SensorID,
+		strconv.FormatFloat(float64(metric.Value), 'g', -1, 32),
+		metric.Unit,
+		strconv.FormatInt(metric.Timestamp, 10),
+		strconv.FormatBool(metric.OutOfRange),
+	})
+}
+
+// Empty exports still have the header
+func (e *csvMetricEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.writer.Flush()
+
+	return e.writer.Error()
+}
+
+func (e *csvMetricEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+
+	return e.writer.Write([]string{"sensorId", "value", "unit", "timestamp", "outOfRange"})
+}
+
+type ndjsonMetricEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonMetricEncoder) Encode(metric *entity.Metric) error {
+	return e.encoder.Encode(dtos.ToMetricResponseDto(metric))
+}
+
+func (e *ndjsonMetricEncoder) Close() error {
+	return nil
+}
+
+// Row of the Parquet exports. Columns are named like the fields of the JSON metrics
+type parquetMetric struct {
+	SensorID   string  `parquet:"sensorId"`
+	Value      float32 `parquet:"value"`
+	Unit       string  `parquet:"unit,dict"`
+	Timestamp  int64   `parquet:"timestamp,timestamp(millisecond)"`
+	OutOfRange bool    `parquet:"outOfRange"`
+}
+
+type parquetMetricEncoder struct {
+	writer *parquet.GenericWriter[parquetMetric]
+	rows   []parquetMetric
+}
+
+func newParquetMetricEncoder(w io.Writer) *parquetMetricEncoder {
+	return &parquetMetricEncoder{
+		writer: parquet.NewGenericWriter[parquetMetric](w,
+			parquet.Compression(&parquet.Snappy),
+			parquet.MaxRowsPerRowGroup(PARQUET_ROW_GROUP_SIZE),
+		),
+		rows: make([]parquetMetric, 0, PARQUET_WRITE_BATCH),
+	}
+}
+
+func (e *parquetMetricEncoder) Encode(metric *entity.Metric) error {
+	e.rows = append(e.rows, parquetMetric{
+		SensorID:   metric.SensorID,
+		Value:      metric.Value,
+		Unit:       metric.Unit,
+		Timestamp:  metric.Timestamp,
+		OutOfRange: metric.OutOfRange,
+	})
+	if len(e.rows) < PARQUET_WRITE_BATCH {
+		return nil
+	}
+
+	return e.writeRows()
+}
+
+// This function writes the last rows and the footer of the file
+func (e *parquetMetricEncoder) Close() error {
+	if err := e.writeRows(); err != nil {
+		return err
+	}
+
+	return e.writer.Close()
+}
+
+func (e *parquetMetricEncoder) writeRows() error {
+	if _, err := e.writer.Write(e.rows); err != nil {
+		return err
+	}
+	e.rows = e.rows[:0]
+
+	return nil
+}
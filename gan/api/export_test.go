@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/api/dtos"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+// sliceCursor returns the metrics in batches, like the database cursor
+type sliceCursor struct {
+	metrics []*entity.Metric
+	batch   int
+}
+
+func (c *sliceCursor) Next(ctx context.Context) ([]*entity.Metric, error) {
+	n := min(c.batch, len(c.metrics))
+	batch := c.metrics[:n]
+	c.metrics = c.metrics[n:]
+	return batch, nil
+}
+
+func (c *sliceCursor) Close() error {
+	return nil
+}
+
+func testMetrics(n int) []*entity.Metric {
+	metrics := make([]*entity.Metric, 0, n)
+	for i := range n {
+		metrics = append(metrics, &entity.Metric{
+			SensorID:   fmt.Sprintf("8cf3030f-2206-4fcb-8c42-%012d", i%7),
+			Value:      float32(i) / 4,
+			Unit:       "celsius",
+			Timestamp:  1700000000000 + int64(i),
+			OutOfRange: i%3 == 0,
+		})
+	}
+	return metrics
+}
+
+func export(t *testing.T, format string, metrics []*entity.Metric) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+	cursor := &sliceCursor{metrics: metrics, batch: 5000}
+	if err := writeMetricExport(context.Background(), cursor, format, &out); err != nil {
+		t.Fatalf("writeMetricExport() error = %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestParquetExport(t *testing.T) {
+	tests := []struct {
+		name      string
+		rows      int
+		rowGroups int
+	}{
+		{name: "empty", rows: 0, rowGroups: 0},
+		{name: "single row", rows: 1, rowGroups: 1},
+		// Booleans are bit packed, so a row count which is not a multiple of 8 is checked
+		{name: "several row groups", rows: 2*PARQUET_ROW_GROUP_SIZE + 13, rowGroups: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := testMetrics(tt.rows)
+			data := export(t, dtos.PARQUET_FORMAT, metrics)
+
+			file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("OpenFile() error = %v", err)
+			}
+			if got := len(file.RowGroups()); got != tt.rowGroups {
+				t.Errorf("row groups = %d, want %d", got, tt.rowGroups)
+			}
+
+			rows, err := parquet.Read[parquetMetric](bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if len(rows) != len(metrics) {
+				t.Fatalf("rows = %d, want %d", len(rows), len(metrics))
+			}
+			for i, row := range rows {
+				metric := metrics[i]
+				if row.SensorID != metric.SensorID || row.Value != metric.Value || row.Unit != metric.Unit ||
+					row.Timestamp != metric.Timestamp || row.OutOfRange != metric.OutOfRange {
+					t.Fatalf("row %d = %+v, want %+v", i, row, *metric)
+				}
+			}
+		})
+	}
+}
+
+func TestCSVExport(t *testing.T) {
+	records, err := csv.NewReader(bytes.NewReader(export(t, dtos.CSV_FORMAT, testMetrics(4)))).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+
+	want := [][]string{
+		{"sensorId", "value", "unit", "timestamp", "outOfRange"},
+		{"8cf3030f-2206-4fcb-8c42-000000000000", "0", "celsius", "1700000000000", "true"},
+		{"8cf3030f-2206-4fcb-8c42-000000000001", "0.25", "celsius", "1700000000001", "false"},
+		{"8cf3030f-2206-4fcb-8c42-000000000002", "0.5", "celsius", "1700000000002", "false"},
+		{"8cf3030f-2206-4fcb-8c42-000000000003", "0.75", "celsius", "1700000000003", "true"},
+	}
+	if fmt.Sprint(records) != fmt.Sprint(want) {
+		t.Errorf("records = %v, want %v", records, want)
+	}
+
+	// Empty exports still have the header
+	records, err = csv.NewReader(bytes.NewReader(export(t, dtos.CSV_FORMAT, nil))).ReadAll()
+	if err != nil || len(records) != 1 {
+		t.Errorf("empty export = %v, %v, want only the header", records, err)
+	}
+}
+
+func TestNDJSONExport(t *testing.T) {
+	metrics := testMetrics(3)
+	decoder := json.NewDecoder(bytes.NewReader(export(t, dtos.NDJSON_FORMAT, metrics)))
+
+	for i, metric := range metrics {
+		var got dtos.MetricResponse
+		if err := decoder.Decode(&got); err != nil {
+			t.Fatalf("line %d: Decode() error = %v", i, err)
+		}
+		if got != *dtos.ToMetricResponseDto(metric) {
+			t.Errorf("line %d = %+v, want %+v", i, got, *metric)
+		}
+	}
+	if decoder.More() {
+		t.Error("more lines than metrics")
+	}
+}
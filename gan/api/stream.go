@@ -0,0 +1,127 @@
+// Live metrics relayed to the clients as Server-Sent Events or WebSocket messages
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/api/dtos"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain"
+)
+
+const (
+	// Events of the metric stream
+	METRIC_EVENT = "metric"
+	LOSS_EVENT   = "loss"
+
+	// Time between keepalives of idle streams, so proxies do not close them
+	STREAM_KEEPALIVE = 15 * time.Second
+	// Max time to write an event. Slower clients are disconnected
+	STREAM_WRITE_TIMEOUT = 10 * time.Second
+)
+
+// eventWriter sends the events of a metric stream through a transport
+type eventWriter interface {
+	WriteEvent(event string, data any) error
+	Keepalive() error
+}
+
+// This function sends the metrics of a stream until the client leaves or a write fails. The
+// metrics lost since the previous batch are reported before it
+func serveMetricStream(ctx context.Context, stream *domain.MetricStream, w eventWriter) error {
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, STREAM_KEEPALIVE)
+		metrics, loss, err := stream.Next(waitCtx)
+		cancel()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			if err := w.Keepalive(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if loss.Dropped > 0 || loss.Coalesced > 0 {
+			if err := w.WriteEvent(LOSS_EVENT, dtos.ToMetricStreamLossDto(loss)); err != nil {
+				return err
+			}
+		}
+		for _, metric := range metrics {
+			if err := w.WriteEvent(METRIC_EVENT, dtos.ToMetricResponseDto(metric)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// eventStreamWriter writes events in the text/event-stream format
+type eventStreamWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func newEventStreamWriter(w io.Writer) *eventStreamWriter {
+	writer := &eventStreamWriter{w: w}
+	if rw, ok := w.(http.ResponseWriter); ok {
+		writer.rc = http.NewResponseController(rw)
+	}
+
+	return writer
+}
+
+func (e *eventStreamWriter) WriteEvent(event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return e.write(fmt.Sprintf("event: %s\ndata: %s\n\n", event, payload))
+}
+
+// Comments are ignored by the clients
+func (e *eventStreamWriter) Keepalive() error {
+	return e.write(": keepalive\n\n")
+}
+
+func (e *eventStreamWriter) write(s string) error {
+	if e.rc != nil {
+		// Not every writer supports deadlines. Those clients are only disconnected if they leave
+		_ = e.rc.SetWriteDeadline(time.Now().Add(STREAM_WRITE_TIMEOUT))
+	}
+	if _, err := io.WriteString(e.w, s); err != nil {
+		return err
+	}
+
+	return e.Flush()
+}
+
+// This function sends what has been written to the client
+func (e *eventStreamWriter) Flush() error {
+	if e.rc == nil {
+		return nil
+	}
+
+	return e.rc.Flush()
+}
+
+// This function writes an API error to a request which does not go through huma
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if statusErr, ok := err.(huma.StatusError); ok {
+		status = statusErr.GetStatus()
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(err)
+}
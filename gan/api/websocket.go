@@ -0,0 +1,108 @@
+// WebSocket transport of the live metrics. Every event is a text message. Messages of the client
+// are discarded, except the control frames, which are answered by the connection
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Max size of the messages of the clients. They are discarded, so larger ones close the connection
+const WEBSOCKET_READ_LIMIT = 4096
+
+// Allows every origin in the allowed origins
+const ANY_ORIGIN = "*"
+
+type webSocketConn struct {
+	conn *websocket.Conn
+}
+
+// This function creates the upgrader of the WebSocket endpoints. Browsers may only open them from
+// the origin of the API or from the allowed origins. Requests without origin do not come from
+// browsers, so they are accepted
+func newWebSocketUpgrader(allowedOrigins []string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		HandshakeTimeout: STREAM_WRITE_TIMEOUT,
+		CheckOrigin: func(r *http.Request) bool {
+			return checkOrigin(r, allowedOrigins)
+		},
+	}
+}
+
+func checkOrigin(r *http.Request, allowedOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if slices.Contains(allowedOrigins, ANY_ORIGIN) {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	return slices.ContainsFunc(allowedOrigins, func(allowed string) bool {
+		return strings.EqualFold(strings.TrimSuffix(allowed, "/"), u.Scheme+"://"+u.Host)
+	})
+}
+
+// This function checks the opening handshake of a client and takes over the connection. Failed
+// handshakes are answered by the upgrader
+func upgradeWebSocket(upgrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request) (*webSocketConn, error) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadLimit(WEBSOCKET_READ_LIMIT)
+
+	return &webSocketConn{conn: conn}, nil
+}
+
+func (c *webSocketConn) WriteEvent(event string, data any) error {
+	payload, err := json.Marshal(map[string]any{"event": event, "data": data})
+	if err != nil {
+		return err
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(STREAM_WRITE_TIMEOUT))
+	return c.conn.WriteMessage(websocket.TextMessage, payload)
+}
+
+func (c *webSocketConn) Keepalive() error {
+	return c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(STREAM_WRITE_TIMEOUT))
+}
+
+// This function sends a close frame and closes the connection
+func (c *webSocketConn) Close() error {
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(STREAM_WRITE_TIMEOUT))
+	return c.conn.Close()
+}
+
+// This function reads the messages of the client until it closes the WebSocket. The messages are
+// discarded, while pings are answered by the connection. It returns nil if the client closed it
+// cleanly
+func (c *webSocketConn) ReadUntilClose() error {
+	for {
+		if _, _, err := c.conn.NextReader(); err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) && closeErr.Code == websocket.CloseNormalClosure {
+				return nil
+			}
+			return err
+		}
+	}
+}
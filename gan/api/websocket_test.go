@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{name: "no origin", origin: "", want: true},
+		{name: "same origin", origin: "http://gan:8080", want: true},
+		{name: "same origin ignoring case", origin: "http://GAN:8080", want: true},
+		{name: "cross origin", origin: "https://evil.example.com", want: false},
+		{name: "allowed origin", origin: "https://dashboard.example.com", allowed: []string{"https://dashboard.example.com/"}, want: true},
+		{name: "allowed origin with another scheme", origin: "http://dashboard.example.com", allowed: []string{"https://dashboard.example.com"}, want: false},
+		{name: "any origin", origin: "https://evil.example.com", allowed: []string{ANY_ORIGIN}, want: true},
+		{name: "invalid origin", origin: "null", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://gan:8080/api/v1/metrics/stream/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := checkOrigin(r, tt.allowed); got != tt.want {
+				t.Errorf("checkOrigin(%q, %v) = %v, want %v", tt.origin, tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketConn(t *testing.T) {
+	closed := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeWebSocket(newWebSocketUpgrader(nil), w, r)
+		if err != nil {
+			return
+		}
+		defer conn.conn.Close()
+
+		if err := conn.WriteEvent(METRIC_EVENT, map[string]int{"value": 1}); err != nil {
+			closed <- err
+			return
+		}
+		if err := conn.Keepalive(); err != nil {
+			closed <- err
+			return
+		}
+		closed <- conn.ReadUntilClose()
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	header := http.Header{"Origin": {"https://evil.example.com"}}
+	if _, res, err := websocket.DefaultDialer.Dial(url, header); err == nil || res.StatusCode != http.StatusForbidden {
+		t.Fatalf("cross origin Dial() = %v, want %d", err, http.StatusForbidden)
+	}
+
+	client, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	pinged := make(chan struct{}, 1)
+	client.SetPingHandler(func(string) error {
+		pinged <- struct{}{}
+		return nil
+	})
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	typ, message, err := client.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if want := `{"data":{"value":1},"event":"metric"}`; typ != websocket.TextMessage || string(message) != want {
+		t.Errorf("message = %d %s, want text %s", typ, message, want)
+	}
+
+	// Control frames are handled while reading
+	go client.ReadMessage()
+	select {
+	case <-pinged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no ping received")
+	}
+
+	// Messages of the client are discarded
+	if err := client.WriteMessage(websocket.TextMessage, []byte("ignored")); err != nil {
+		t.Fatalf("WriteMessage() error = %v", err)
+	}
+	message = websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := client.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("WriteControl() error = %v", err)
+	}
+	if err := <-closed; err != nil {
+		t.Errorf("ReadUntilClose() error = %v, want nil", err)
+	}
+}
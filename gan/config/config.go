@@ -10,10 +10,92 @@ type Config struct {
 
 	Nats        NatsConfig              `json:"nats"`
 	TimescaleDB config.PostgreSQLConfig `json:"timescaleDB"`
+	Simulator   SimulatorConfig         `json:"simulator"`
+	Retention   RetentionConfig         `json:"retention"`
+	WebSocket   WebSocketConfig         `json:"webSocket"`
 	ServerName  string                  `json:"serverName"`
 }
 
 type NatsConfig struct {
 	Host string `json:"host"`
 	Port string `json:"port"`
+	// Subject of every sensor. {type} and {id} are replaced with the values of the sensor and
+	// must be whole tokens. sensors.{type}.{id} by default
+	SubjectTemplate string `json:"subjectTemplate"`
+	// JetStream stream where sensors publish
+	Stream StreamConfig `json:"stream"`
+	// JetStream stream where NTA moves the messages it cannot write
+	DeadLetter DeadLetterConfig `json:"deadLetter"`
+}
+
+type DeadLetterConfig struct {
+	// SENSORS_DLQ by default
+	Stream string `json:"stream"`
+	// Prefix of the dead letter subjects, followed by the original subject. dlq by default.
+	// It must match the prefix configured in NTA
+	Prefix string `json:"prefix"`
+	// Seconds dead letters are kept. 0 means forever
+	MaxAge float64 `json:"maxAge"`
+}
+
+type StreamConfig struct {
+	// SENSORS by default
+	Name string `json:"name"`
+	// limits (default), interest or workqueue
+	Retention string `json:"retention"`
+	// file (default) or memory
+	Storage string `json:"storage"`
+	// Seconds messages are kept. 0 means forever
+	MaxAge float64 `json:"maxAge"`
+	// Limits of the stream. 0 means unlimited
+	MaxBytes int64 `json:"maxBytes"`
+	MaxMsgs  int64 `json:"maxMsgs"`
+	// Seconds a message ID is remembered to drop duplicates. 120 by default
+	Duplicates float64 `json:"duplicates"`
+	Replicas   int     `json:"replicas"`
+	// Seconds to wait for the acknowledgement of every message. 5 by default
+	AckTimeout float64 `json:"ackTimeout"`
+	// Attempts to publish every message. 3 by default
+	PublishRetries int `json:"publishRetries"`
+	// Messages sent without waiting for their acknowledgement. Samples wait to be sent while
+	// there are so many. 4096 by default
+	MaxPending int `json:"maxPending"`
+}
+
+type SimulatorConfig struct {
+	// Seconds between reconciliations of the running sensors with the devices table. 0 disables it
+	ReconcileInterval int `json:"reconcileInterval"`
+	// Seed of the random values of every sensor, so a fleet always produces the same values.
+	// Sensors can override it. 0 means non reproducible values
+	Seed int64 `json:"seed"`
+	// Source of time of the sensors
+	Clock ClockConfig `json:"clock"`
+	// Goroutines sending the samples of the sensors. The number of CPUs by default
+	Workers int `json:"workers"`
+}
+
+type RetentionConfig struct {
+	// Seconds between cleanups of the metrics older than their retention. 0 disables them.
+	// Retentions are set with the API. The first cleanup runs at startup
+	Interval int `json:"interval"`
+	// Seconds the metrics are kept when the policy set with the API has no default retention.
+	// 0 keeps them forever
+	Default int `json:"default"`
+}
+
+type WebSocketConfig struct {
+	// Origins of the browsers which may open WebSockets besides the origin of the API, like
+	// https://dashboard.example.com. * allows every origin
+	AllowedOrigins []string `json:"allowedOrigins"`
+}
+
+type ClockConfig struct {
+	// realtime (default), accelerated or fast (as fast as possible)
+	Mode string `json:"mode"`
+	// Speed of the accelerated mode. For example, 60 simulates one minute per second
+	Factor float64 `json:"factor"`
+	// RFC3339 instant where accelerated and fast simulations start. Now by default
+	Epoch string `json:"epoch"`
+	// RFC3339 instant where sensors stop publishing. Empty means never
+	Until string `json:"until"`
 }
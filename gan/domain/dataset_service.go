@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/AntonioBR9998/go-common/errors"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/simulator"
+	log "github.com/sirupsen/logrus"
+)
+
+type DatasetService interface {
+	CreateDataset(ctx context.Context, name string, format string, content []byte) (*entity.Dataset, error)
+	GetDatasets(ctx context.Context) ([]*entity.Dataset, error)
+	DeleteDataset(ctx context.Context, id string) error
+}
+
+func (s *service) CreateDataset(ctx context.Context, name string, format string, content []byte) (*entity.Dataset, error) {
+	errVars := map[string]any{"name": name, "format": format}
+
+	// Validating param name
+	err := s.validate.Var(name, "128_character_name")
+	if err != nil {
+		log.Errorln("validation error: ", err)
+		return nil, errors.TrackErrorVar(err, errVars)
+	}
+
+	// Validating content
+	samples, err := simulator.ParseDataset(format, content)
+	if err != nil {
+		log.Errorln("validation error: ", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDataset, err)
+	}
+
+	// Adding dataset in database
+	dataset := &entity.Dataset{
+		ID:        newUUID(),
+		Name:      name,
+		Format:    format,
+		Samples:   len(samples),
+		CreatedAt: time.Now().Unix(),
+	}
+
+	err = s.repo.CreateDataset(ctx, dataset, content)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+
+	return dataset, nil
+}
+
+func (s *service) GetDatasets(ctx context.Context) ([]*entity.Dataset, error) {
+	// Calling repository
+	datasetList, err := s.repo.GetDatasets(ctx)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+
+	return datasetList, nil
+}
+
+func (s *service) DeleteDataset(ctx context.Context, id string) error {
+	errVars := map[string]any{"id": id}
+
+	// Validating param id
+	err := s.validate.Var(id, "uuid_rfc4122")
+	if err != nil {
+		log.Errorln("validation error: ", err)
+		return errors.TrackErrorVar(err, errVars)
+	}
+
+	// Deleting dataset in database
+	return fromRepository(s.repo.DeleteDataset(ctx, id))
+}
+
+// This function generates a random (version 4) UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+type DeadLetterService interface {
+	GetDeadLetters(ctx context.Context) ([]*entity.DeadLetter, error)
+	GetDeadLetter(ctx context.Context, seq uint64) (*entity.DeadLetter, error)
+	RedriveDeadLetter(ctx context.Context, seq uint64) error
+	DeleteDeadLetter(ctx context.Context, seq uint64) error
+}
+
+func (s *service) GetDeadLetters(ctx context.Context) ([]*entity.DeadLetter, error) {
+	deadLetters, err := s.deadLetters.GetDeadLetters(ctx)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+
+	return deadLetters, nil
+}
+
+func (s *service) GetDeadLetter(ctx context.Context, seq uint64) (*entity.DeadLetter, error) {
+	deadLetter, err := s.deadLetters.GetDeadLetter(ctx, seq)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+
+	return deadLetter, nil
+}
+
+// The message is published again in its original subject, so NTA consumes it again
+func (s *service) RedriveDeadLetter(ctx context.Context, seq uint64) error {
+	return fromRepository(s.deadLetters.RedriveDeadLetter(ctx, seq))
+}
+
+func (s *service) DeleteDeadLetter(ctx context.Context, seq uint64) error {
+	return fromRepository(s.deadLetters.DeleteDeadLetter(ctx, seq))
+}
@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// Dataset is a file of samples recorded from real devices, which can be replayed by sensors
+type Dataset struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Format    string `json:"format" validate:"oneof=csv ndjson"`
+	Samples   int    `json:"samples"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// DatasetSample is a row of a dataset
+type DatasetSample struct {
+	Timestamp time.Time
+	Value     float32
+	Unit      string
+}
@@ -0,0 +1,16 @@
+package entity
+
+// DeadLetter is a message which NTA could not write in TimescaleDB
+type DeadLetter struct {
+	// Sequence of the dead letter in the dead letter stream
+	Sequence uint64 `json:"sequence"`
+	// Subject where the message was published
+	Subject  string `json:"subject"`
+	Reason   string `json:"reason"`
+	Attempts int    `json:"attempts"`
+	// Stream and sequence of the original message
+	Stream         string `json:"stream"`
+	StreamSequence uint64 `json:"streamSequence"`
+	Payload        []byte `json:"payload"`
+	FailedAt       int64  `json:"failedAt"`
+}
@@ -1,8 +1,68 @@
 package entity
 
+import "time"
+
 type Metric struct {
 	SensorID  string  `json:"sensorId"`
 	Value     float32 `json:"value"`
 	Unit      string  `json:"unit"`
 	Timestamp int64   `json:"timestamp"`
+	// Set by NTA when the value is out of the thresholds of the sensor
+	OutOfRange bool `json:"outOfRange,omitempty"`
+}
+
+// Latest metric of a sensor
+type LatestMetric struct {
+	Metric
+	// Time since the metric was generated
+	Age time.Duration
+}
+
+// Functions which summarize the metrics of a bucket
+const (
+	AVG_AGGREGATE   = "avg"
+	MIN_AGGREGATE   = "min"
+	MAX_AGGREGATE   = "max"
+	COUNT_AGGREGATE = "count"
+)
+
+type MetricAggregateQuery struct {
+	SensorID string
+	// Width of the buckets in milliseconds
+	Bucket int64
+	// UNIX milliseconds. From is included and To is not
+	From int64
+	To   int64
+	Fn   string
+}
+
+type MetricAggregate struct {
+	// UNIX milliseconds where the bucket starts
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// Metrics of a bulk export, ordered by timestamp
+type MetricExportQuery struct {
+	// Every sensor if it is empty
+	SensorIDs []string
+	// UNIX milliseconds. From is included and To is not. Nil bounds are open
+	From *int64
+	To   *int64
+}
+
+// Metrics relayed to a client of the live stream. Empty lists match every sensor
+type MetricStreamFilter struct {
+	SensorIDs []string
+	Types     []string
+	// Only metrics out of the thresholds of their sensor
+	OutOfRange bool
+}
+
+// Metrics of a live stream which were not sent because the client was too slow
+type MetricStreamLoss struct {
+	// Discarded because the buffer of the client was full
+	Dropped uint64
+	// Replaced by a newer metric of the same sensor
+	Coalesced uint64
 }
@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+type RetentionPolicy struct {
+	// Retention of the metrics of the sensor types without their own one, and of the sensors
+	// which no longer exist. Nil keeps them forever
+	Default *time.Duration
+	// Retention of the metrics of every sensor type
+	Types     map[string]time.Duration
+	UpdatedAt int64
+}
+
+// Metrics deleted by a cleanup
+type RetentionCleanup struct {
+	DroppedChunks int
+	DeletedRows   int64
+}
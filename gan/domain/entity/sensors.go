@@ -1,11 +1,129 @@
 package entity
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
 type Sensor struct {
-	ID           string  `json:"id"`
-	Type         string  `json:"type" validate:"oneof=humidity temperature pressure"`
-	Alias        string  `json:"alias"`
-	Rate         int     `json:"rate"`
-	MaxThreshold float32 `json:"maxThreshold"`
-	MinThreshold float32 `json:"minThreshold"`
-	UpdatedAt    int64   `json:"updatedAt"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type" validate:"oneof=humidity temperature pressure"`
+	Alias        string        `json:"alias"`
+	Rate         time.Duration `json:"rate"`
+	Jitter       time.Duration `json:"jitter"`
+	MaxThreshold float32       `json:"maxThreshold"`
+	MinThreshold float32       `json:"minThreshold"`
+	Generator    Generator     `json:"generator"`
+	// Fraction of the generated values which cross the thresholds. The rest of them stay within
+	// the thresholds. If it is nil, values are only bounded by the physical limits
+	ThresholdCrossingRate *float64     `json:"thresholdCrossingRate,omitempty"`
+	Seed                  *int64       `json:"seed,omitempty"`
+	Faults                FaultProfile `json:"faults"`
+	Replay                *Replay      `json:"replay,omitempty"`
+	UpdatedAt             int64        `json:"updatedAt"`
+	// Increased by every update
+	Version int64 `json:"version"`
+}
+
+// Generator describes the algorithm and the parameters used to simulate the sensor values.
+// It is stored as JSON in the devices table
+type Generator struct {
+	Type   string             `json:"type" validate:"oneof=uniform random-walk sine gaussian constant step"`
+	Params map[string]float64 `json:"params,omitempty"`
+}
+
+// Value implements driver.Valuer
+func (g Generator) Value() (driver.Value, error) {
+	return json.Marshal(g)
+}
+
+// Scan implements sql.Scanner
+func (g *Generator) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*g = Generator{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, g)
+	case string:
+		return json.Unmarshal([]byte(v), g)
+	default:
+		return fmt.Errorf("cannot scan %T into Generator", src)
+	}
+}
+
+// FaultProfile describes the faults injected in the samples of a sensor. It is stored as JSON in
+// the devices table
+type FaultProfile struct {
+	// No samples are sent
+	Dropout *Fault `json:"dropout,omitempty"`
+	// The last value is sent again and again
+	StuckAt *Fault `json:"stuckAt,omitempty"`
+	// The value is moved magnitude up or down
+	Spike *Fault `json:"spike,omitempty"`
+	// The value moves magnitude more in every sample
+	Drift *Fault `json:"drift,omitempty"`
+	// NaN values or payloads which are not valid JSON
+	Garbage *Fault `json:"garbage,omitempty"`
+	// Every sample is sent twice
+	Duplicate *Fault `json:"duplicate,omitempty"`
+}
+
+type Fault struct {
+	Enabled bool `json:"enabled"`
+	// Chance of the fault to start in every sample, from 0 to 1
+	Probability float64 `json:"probability"`
+	// Seconds the fault lasts once started. 0 means a single sample
+	Duration float64 `json:"duration"`
+	// Size of spikes and drift per sample
+	Magnitude float64 `json:"magnitude,omitempty"`
+}
+
+// Value implements driver.Valuer
+func (f FaultProfile) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+// Scan implements sql.Scanner
+func (f *FaultProfile) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*f = FaultProfile{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, f)
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	default:
+		return fmt.Errorf("cannot scan %T into FaultProfile", src)
+	}
+}
+
+// Replay makes a sensor replay a dataset instead of generating values. It is stored as JSON in
+// the devices table
+type Replay struct {
+	DatasetID string `json:"datasetId"`
+	// Time scaling of the original timing. For example, 2 replays the dataset twice as fast
+	Scale float64 `json:"scale,omitempty"`
+	// The dataset starts again once finished
+	Loop bool `json:"loop,omitempty"`
+}
+
+// Value implements driver.Valuer
+func (r Replay) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+// Scan implements sql.Scanner
+func (r *Replay) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	default:
+		return fmt.Errorf("cannot scan %T into Replay", src)
+	}
 }
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"errors"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/repository"
+)
+
+// ErrInvalidSimulation is returned when the simulation settings of a sensor are not valid
+var ErrInvalidSimulation = errors.New("invalid simulation settings")
+
+// ErrInvalidDataset is returned when an uploaded dataset cannot be parsed
+var ErrInvalidDataset = errors.New("invalid dataset")
+
+// ErrInvalidRetention is returned when a retention policy is not valid
+var ErrInvalidRetention = errors.New("invalid retention policy")
+
+// ErrInvalidQuery is returned when the parameters of a metrics query are not valid
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ErrSensorNotFound is returned when the requested sensor does not exist
+var ErrSensorNotFound = errors.New("sensor not found")
+
+// ErrVersionConflict is returned when a sensor has changed since the version the client read
+var ErrVersionConflict = errors.New("sensor has been modified by someone else")
+
+// ErrMetricNotFound is returned when the requested sensor has no metrics yet
+var ErrMetricNotFound = errors.New("sensor has no metrics")
+
+// ErrDatasetNotFound is returned when the requested dataset does not exist
+var ErrDatasetNotFound = errors.New("dataset not found")
+
+// ErrDeadLetterNotFound is returned when the requested dead letter does not exist
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// ErrDatasetInUse is returned when a dataset replayed by some sensors is deleted
+var ErrDatasetInUse = errors.New("dataset is replayed by some sensors")
+
+// Errors of the repository and the errors of the domain they mean
+var repositoryErrors = []struct{ repository, domain error }{
+	{repository: repository.ErrSensorNotFound, domain: ErrSensorNotFound},
+	{repository: repository.ErrVersionConflict, domain: ErrVersionConflict},
+	{repository: repository.ErrMetricNotFound, domain: ErrMetricNotFound},
+	{repository: repository.ErrDatasetNotFound, domain: ErrDatasetNotFound},
+	{repository: repository.ErrDeadLetterNotFound, domain: ErrDeadLetterNotFound},
+	{repository: repository.ErrDatasetInUse, domain: ErrDatasetInUse},
+}
+
+// This function translates an error of the repository into the error of the domain it means.
+// The rest of the errors are returned as they are
+func fromRepository(err error) error {
+	for _, e := range repositoryErrors {
+		if errors.Is(err, e.repository) {
+			return e.domain
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/repository"
+)
+
+func TestFromRepository(t *testing.T) {
+	unknown := errors.New("connection refused")
+
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{err: nil, want: nil},
+		{err: repository.ErrSensorNotFound, want: ErrSensorNotFound},
+		{err: repository.ErrVersionConflict, want: ErrVersionConflict},
+		{err: repository.ErrMetricNotFound, want: ErrMetricNotFound},
+		{err: repository.ErrDatasetNotFound, want: ErrDatasetNotFound},
+		{err: repository.ErrDeadLetterNotFound, want: ErrDeadLetterNotFound},
+		{err: repository.ErrDatasetInUse, want: ErrDatasetInUse},
+		{err: fmt.Errorf("deleting sensor: %w", repository.ErrSensorNotFound), want: ErrSensorNotFound},
+		{err: unknown, want: unknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.err), func(t *testing.T) {
+			if got := fromRepository(tt.err); got != tt.want {
+				t.Errorf("fromRepository() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
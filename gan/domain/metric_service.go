@@ -2,20 +2,176 @@ package domain
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	"github.com/AntonioBR9998/go-common/errors"
 	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/repository"
+	log "github.com/sirupsen/logrus"
 )
 
 type MetricService interface {
-	GetMetricsData(ctx context.Context) ([]*entity.Metric, error)
+	GetMetricsData(ctx context.Context, from *int64, to *int64) ([]*entity.Metric, error)
+	GetMetricAggregates(ctx context.Context, query entity.MetricAggregateQuery) ([]*entity.MetricAggregate, error)
+	GetLatestMetrics(ctx context.Context) ([]*entity.LatestMetric, error)
+	GetLatestMetric(ctx context.Context, sensorID string) (*entity.LatestMetric, error)
+	ExportMetrics(ctx context.Context, query entity.MetricExportQuery) (MetricCursor, error)
 }
 
-func (s *service) GetMetricsData(ctx context.Context) ([]*entity.Metric, error) {
+// MetricCursor reads the metrics of an export in batches. It must be closed
+type MetricCursor = repository.MetricCursor
+
+// This function returns the metrics between from (included) and to (not included), in UNIX
+// milliseconds. Nil bounds are open
+func (s *service) GetMetricsData(ctx context.Context, from *int64, to *int64) ([]*entity.Metric, error) {
+	if from != nil && to != nil && *from >= *to {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+
 	// Calling repository
-	metricsData, err := s.repo.GetMetrics(ctx)
+	metricsData, err := s.repo.GetMetrics(ctx, from, to)
 	if err != nil {
-		return nil, err
+		return nil, fromRepository(err)
 	}
 
 	return metricsData, nil
 }
+
+// This function returns the latest metric of every sensor with metrics
+func (s *service) GetLatestMetrics(ctx context.Context) ([]*entity.LatestMetric, error) {
+	metricsData, err := s.repo.GetLatestMetrics(ctx)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+
+	now := time.Now()
+	latest := make([]*entity.LatestMetric, 0, len(metricsData))
+	for _, metric := range metricsData {
+		latest = append(latest, toLatestMetric(metric, now))
+	}
+
+	return latest, nil
+}
+
+// This function returns the latest metric of a sensor
+func (s *service) GetLatestMetric(ctx context.Context, sensorID string) (*entity.LatestMetric, error) {
+	errVars := map[string]any{"sensorId": sensorID}
+
+	// Validating param sensorId
+	err := s.validate.Var(sensorID, "uuid_rfc4122")
+	if err != nil {
+		log.Errorln("validation error: ", err)
+		return nil, errors.TrackErrorVar(err, errVars)
+	}
+
+	// A missing sensor and a sensor without metrics are told apart
+	if _, err := s.repo.GetSensor(ctx, sensorID); err != nil {
+		return nil, fromRepository(err)
+	}
+
+	metric, err := s.repo.GetLatestMetric(ctx, sensorID)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+
+	return toLatestMetric(metric, time.Now()), nil
+}
+
+// Timestamps follow the simulated time, so the age of metrics of accelerated clocks may be negative
+func toLatestMetric(metric *entity.Metric, now time.Time) *entity.LatestMetric {
+	return &entity.LatestMetric{
+		Metric: *metric,
+		Age:    now.Sub(time.UnixMilli(metric.Timestamp)),
+	}
+}
+
+const (
+	// Max buckets returned by an aggregate query
+	MAX_AGGREGATE_BUCKETS = 10000
+	// Buckets of an aggregate query without a bucket width
+	DEFAULT_AGGREGATE_BUCKETS = 1000
+)
+
+// Bucket widths chosen for aggregate queries without a bucket width, in milliseconds
+var defaultAggregateBuckets = []int64{
+	1000, 10000, 60000, 300000, 900000, 3600000, 21600000, 86400000, 604800000,
+}
+
+// This function returns the buckets of the metrics of a sensor between from and to, in UNIX
+// milliseconds. Without a bucket width the smallest one giving at most DEFAULT_AGGREGATE_BUCKETS
+// buckets is used
+func (s *service) GetMetricAggregates(ctx context.Context, query entity.MetricAggregateQuery) ([]*entity.MetricAggregate, error) {
+	errVars := map[string]any{"sensorId": query.SensorID}
+
+	// Validating param sensorId
+	err := s.validate.Var(query.SensorID, "uuid_rfc4122")
+	if err != nil {
+		log.Errorln("validation error: ", err)
+		return nil, errors.TrackErrorVar(err, errVars)
+	}
+
+	if query.Fn == "" {
+		query.Fn = entity.AVG_AGGREGATE
+	}
+	switch query.Fn {
+	case entity.AVG_AGGREGATE, entity.MIN_AGGREGATE, entity.MAX_AGGREGATE, entity.COUNT_AGGREGATE:
+	default:
+		return nil, fmt.Errorf("%w: fn must be avg, min, max or count", ErrInvalidQuery)
+	}
+
+	if query.From >= query.To {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+
+	span := query.To - query.From
+	if query.Bucket == 0 {
+		query.Bucket = defaultAggregateBuckets[len(defaultAggregateBuckets)-1]
+		for _, bucket := range defaultAggregateBuckets {
+			if buckets(span, bucket) <= DEFAULT_AGGREGATE_BUCKETS {
+				query.Bucket = bucket
+				break
+			}
+		}
+	}
+	if query.Bucket < 0 {
+		return nil, fmt.Errorf("%w: bucket must be positive", ErrInvalidQuery)
+	}
+	if buckets(span, query.Bucket) > MAX_AGGREGATE_BUCKETS {
+		return nil, fmt.Errorf("%w: the query has more than %d buckets, use a wider bucket or a shorter range",
+			ErrInvalidQuery, MAX_AGGREGATE_BUCKETS)
+	}
+
+	aggregates, err := s.repo.GetMetricAggregates(ctx, query)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+
+	return aggregates, nil
+}
+
+// This function returns the number of buckets of the given width in a span, counting the last
+// partial one
+func buckets(span int64, bucket int64) int64 {
+	return (span + bucket - 1) / bucket
+}
+
+// This function opens a cursor over the metrics of the given sensors between from (included) and
+// to (not included), ordered by timestamp
+func (s *service) ExportMetrics(ctx context.Context, query entity.MetricExportQuery) (MetricCursor, error) {
+	for _, id := range query.SensorIDs {
+		if err := s.validate.Var(id, "uuid_rfc4122"); err != nil {
+			return nil, fmt.Errorf("%w: sensorId %s is not a valid UUID", ErrInvalidQuery, id)
+		}
+	}
+	if query.From != nil && query.To != nil && *query.From >= *query.To {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+
+	cursor, err := s.repo.OpenMetricCursor(ctx, query)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+
+	return cursor, nil
+}
@@ -0,0 +1,202 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-common/validation"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/repository"
+)
+
+// fakeAggregates records the aggregate queries. The rest of the repository is not implemented
+type fakeAggregates struct {
+	repository.Repository
+	query *entity.MetricAggregateQuery
+}
+
+func (f *fakeAggregates) GetMetricAggregates(ctx context.Context, query entity.MetricAggregateQuery) ([]*entity.MetricAggregate, error) {
+	f.query = &query
+	return []*entity.MetricAggregate{}, nil
+}
+
+func TestGetMetricAggregatesBucket(t *testing.T) {
+	const (
+		second = int64(1000)
+		minute = 60 * second
+		hour   = 60 * minute
+		day    = 24 * hour
+	)
+
+	validator, err := validation.NewValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		span   int64
+		bucket int64
+		want   int64
+		// The query is invalid and does not reach the repository
+		wantErr bool
+	}{
+		{name: "minutes", span: 10 * minute, want: second},
+		{name: "up to 1000 seconds", span: 1000 * second, want: second},
+		{name: "over 1000 seconds", span: 1000*second + 1, want: 10 * second},
+		{name: "hour", span: hour, want: 10 * second},
+		{name: "day", span: day, want: 5 * minute},
+		{name: "week", span: 7 * day, want: 15 * minute},
+		{name: "month", span: 30 * day, want: hour},
+		{name: "quarter", span: 90 * day, want: 6 * hour},
+		{name: "year", span: 365 * day, want: day},
+		{name: "decade", span: 3650 * day, want: 7 * day},
+		{name: "too many of the widest buckets", span: 100000 * day, wantErr: true},
+		{name: "given bucket", span: day, bucket: hour, want: hour},
+		{name: "negative bucket", span: day, bucket: -hour, wantErr: true},
+		{name: "too many buckets", span: 30 * day, bucket: second, wantErr: true},
+		{name: "partial last bucket counts", span: 10000*minute + 1, bucket: minute, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAggregates{}
+			svc := &service{repo: repo, validate: validator}
+
+			from := int64(1714521600000)
+			_, err := svc.GetMetricAggregates(context.Background(), entity.MetricAggregateQuery{
+				SensorID: "8cf3030f-2206-4fcb-8c42-d0eb70e197ab",
+				From:     from,
+				To:       from + tt.span,
+				Bucket:   tt.bucket,
+			})
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Errorf("GetMetricAggregates() error = %v, want %v", err, ErrInvalidQuery)
+				}
+				if repo.query != nil {
+					t.Errorf("the repository was queried with %+v", *repo.query)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if repo.query.Bucket != tt.want {
+				t.Errorf("bucket = %d, want %d", repo.query.Bucket, tt.want)
+			}
+			if repo.query.Fn != entity.AVG_AGGREGATE {
+				t.Errorf("fn = %s, want %s by default", repo.query.Fn, entity.AVG_AGGREGATE)
+			}
+		})
+	}
+}
+
+// fakeLatest keeps the sensors and their latest metrics. The rest of the repository is not
+// implemented
+type fakeLatest struct {
+	repository.Repository
+	sensors map[string]bool
+	metrics map[string]entity.Metric
+}
+
+func (f *fakeLatest) GetSensor(ctx context.Context, id string) (*entity.Sensor, error) {
+	if !f.sensors[id] {
+		return nil, repository.ErrSensorNotFound
+	}
+	return &entity.Sensor{ID: id}, nil
+}
+
+func (f *fakeLatest) GetLatestMetric(ctx context.Context, sensorID string) (*entity.Metric, error) {
+	metric, exists := f.metrics[sensorID]
+	if !exists {
+		return nil, repository.ErrMetricNotFound
+	}
+	return &metric, nil
+}
+
+func (f *fakeLatest) GetLatestMetrics(ctx context.Context) ([]*entity.Metric, error) {
+	metrics := make([]*entity.Metric, 0, len(f.metrics))
+	for _, metric := range f.metrics {
+		metrics = append(metrics, &metric)
+	}
+	return metrics, nil
+}
+
+func TestGetLatestMetric(t *testing.T) {
+	const (
+		kitchen = "8cf3030f-2206-4fcb-8c42-d0eb70e197ab"
+		// Sensor created but without metrics yet
+		bathroom = "2a1d7b55-93a4-4c1e-9d0f-3c8f4a6e5b21"
+		// Metrics of an accelerated clock are ahead of the wall-clock time
+		garage  = "d1e4b0a6-5f43-4c7e-8a39-7b2c6f0e9d14"
+		deleted = "5b8e2f1c-0a7d-4e69-b3c4-9f1a6d2e8c70"
+	)
+
+	validator, err := validation.NewValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	repo := &fakeLatest{
+		sensors: map[string]bool{kitchen: true, bathroom: true, garage: true},
+		metrics: map[string]entity.Metric{
+			kitchen: {SensorID: kitchen, Value: 21.5, Unit: "ºC", Timestamp: now.Add(-time.Minute).UnixMilli()},
+			garage:  {SensorID: garage, Value: 12, Unit: "ºC", Timestamp: now.Add(time.Hour).UnixMilli()},
+		},
+	}
+	svc := &service{repo: repo, validate: validator}
+
+	tests := []struct {
+		name    string
+		id      string
+		wantAge time.Duration
+		wantErr error
+	}{
+		{name: "latest metric", id: kitchen, wantAge: time.Minute},
+		{name: "metric ahead of the wall-clock time", id: garage, wantAge: -time.Hour},
+		{name: "sensor without metrics", id: bathroom, wantErr: ErrMetricNotFound},
+		{name: "unknown sensor", id: deleted, wantErr: ErrSensorNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			latest, err := svc.GetLatestMetric(context.Background(), tt.id)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetLatestMetric() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if latest.Metric != repo.metrics[tt.id] {
+				t.Errorf("GetLatestMetric() = %+v, want %+v", latest.Metric, repo.metrics[tt.id])
+			}
+			if diff := latest.Age - tt.wantAge; diff < 0 || diff > time.Second {
+				t.Errorf("age = %v, want %v", latest.Age, tt.wantAge)
+			}
+		})
+	}
+
+	// Every sensor with metrics is listed with the age of its latest one
+	latest, err := svc.GetLatestMetrics(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != len(repo.metrics) {
+		t.Fatalf("GetLatestMetrics() returned %d metrics, want %d", len(latest), len(repo.metrics))
+	}
+	for _, metric := range latest {
+		want := now.Sub(time.UnixMilli(metric.Timestamp))
+		if diff := metric.Age - want; diff < 0 || diff > time.Second {
+			t.Errorf("age of %s = %v, want %v", metric.SensorID, metric.Age, want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/repository"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/simulator"
+	log "github.com/sirupsen/logrus"
+)
+
+// Max sensors with metrics waiting to be sent to a client of the live stream
+const MAX_STREAM_PENDING = 1000
+
+type MetricStreamService interface {
+	StreamMetrics(ctx context.Context, filter entity.MetricStreamFilter) (*MetricStream, error)
+}
+
+// metricHub shares a single NATS subscription among the clients of the live stream. It subscribes
+// when the first client arrives and unsubscribes when the last one leaves
+type metricHub struct {
+	repository  repository.MetricStreamRepository
+	simulator   *simulator.Manager
+	mu          sync.RWMutex
+	clients     map[*MetricStream]struct{}
+	unsubscribe func()
+}
+
+func newMetricHub(repository repository.MetricStreamRepository, simulator *simulator.Manager) *metricHub {
+	return &metricHub{
+		repository: repository,
+		simulator:  simulator,
+		clients:    make(map[*MetricStream]struct{}),
+	}
+}
+
+func (h *metricHub) add(stream *MetricStream) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.unsubscribe == nil {
+		unsubscribe, err := h.repository.SubscribeMetrics(h.dispatch)
+		if err != nil {
+			return err
+		}
+		h.unsubscribe = unsubscribe
+	}
+	h.clients[stream] = struct{}{}
+
+	return nil
+}
+
+func (h *metricHub) remove(stream *MetricStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.clients, stream)
+	if len(h.clients) == 0 && h.unsubscribe != nil {
+		h.unsubscribe()
+		h.unsubscribe = nil
+	}
+}
+
+// This function hands a metric to every client. Type and thresholds of its sensor are looked up
+// once, and the metric is shared by the clients, so they must not modify it
+func (h *metricHub) dispatch(metric *entity.Metric) {
+	// Type and thresholds are only known for the sensors running in this GAN
+	sensor, known := h.simulator.Sensor(metric.SensorID)
+	if known {
+		metric.OutOfRange = metric.Value < sensor.MinThreshold || metric.Value > sensor.MaxThreshold
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for stream := range h.clients {
+		stream.push(metric, sensor, known)
+	}
+}
+
+// MetricStream relays live metrics to a client. Metrics wait in a buffer while the client is
+// busy, so the NATS subscription is never blocked by a slow client. A newer metric of a sensor
+// replaces the waiting one and, once the buffer is full, metrics of other sensors are dropped
+type MetricStream struct {
+	filter entity.MetricStreamFilter
+	hub    *metricHub
+
+	mu      sync.Mutex
+	pending map[string]*entity.Metric
+	// Sensors of the pending metrics in arrival order
+	order []string
+	loss  entity.MetricStreamLoss
+	// Signals that there are pending metrics
+	ready chan struct{}
+}
+
+// This function subscribes a new client to the live metrics matching the filter. The stream must
+// be closed when the client leaves
+func (s *service) StreamMetrics(ctx context.Context, filter entity.MetricStreamFilter) (*MetricStream, error) {
+	for _, id := range filter.SensorIDs {
+		if err := s.validate.Var(id, "uuid_rfc4122"); err != nil {
+			return nil, fmt.Errorf("%w: sensorId %s is not a valid UUID", ErrInvalidQuery, id)
+		}
+	}
+	for _, typ := range filter.Types {
+		if !simulator.IsSensorType(typ) {
+			return nil, fmt.Errorf("%w: type must be one of temperature, humidity or pressure", ErrInvalidQuery)
+		}
+	}
+
+	stream := &MetricStream{
+		filter:  filter,
+		hub:     s.metricHub,
+		pending: make(map[string]*entity.Metric),
+		ready:   make(chan struct{}, 1),
+	}
+
+	if err := s.metricHub.add(stream); err != nil {
+		return nil, err
+	}
+	log.Debugf("new client of the metric stream with filter %+v", filter)
+
+	return stream, nil
+}
+
+// This function checks a metric against the filter of the stream and buffers it. It never blocks
+func (s *MetricStream) push(metric *entity.Metric, sensor entity.Sensor, known bool) {
+	if len(s.filter.SensorIDs) > 0 && !slices.Contains(s.filter.SensorIDs, metric.SensorID) {
+		return
+	}
+	if len(s.filter.Types) > 0 && (!known || !slices.Contains(s.filter.Types, sensor.Type)) {
+		return
+	}
+	if s.filter.OutOfRange && !metric.OutOfRange {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, waiting := s.pending[metric.SensorID]; waiting {
+		s.pending[metric.SensorID] = metric
+		s.loss.Coalesced++
+		return
+	}
+	if len(s.pending) >= MAX_STREAM_PENDING {
+		s.loss.Dropped++
+		return
+	}
+	s.pending[metric.SensorID] = metric
+	s.order = append(s.order, metric.SensorID)
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// This function waits for metrics and returns every pending one, along with the metrics lost
+// since the last call
+func (s *MetricStream) Next(ctx context.Context) ([]*entity.Metric, entity.MetricStreamLoss, error) {
+	for {
+		s.mu.Lock()
+		if len(s.order) > 0 {
+			metrics := make([]*entity.Metric, 0, len(s.order))
+			for _, id := range s.order {
+				metrics = append(metrics, s.pending[id])
+			}
+			loss := s.loss
+
+			s.pending = make(map[string]*entity.Metric)
+			s.order = nil
+			s.loss = entity.MetricStreamLoss{}
+			s.mu.Unlock()
+
+			return metrics, loss, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, entity.MetricStreamLoss{}, ctx.Err()
+		case <-s.ready:
+		}
+	}
+}
+
+// This function unsubscribes the client
+func (s *MetricStream) Close() {
+	s.hub.remove(s)
+}
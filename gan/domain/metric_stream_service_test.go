@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/config"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/simulator"
+)
+
+// fakeMetricStream keeps the handlers of the subscriptions, so metrics can be published to them
+type fakeMetricStream struct {
+	mu            sync.Mutex
+	handlers      map[int]func(metric *entity.Metric)
+	subscriptions int
+}
+
+func (f *fakeMetricStream) SubscribeMetrics(handler func(metric *entity.Metric)) (func(), error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.subscriptions++
+	id := f.subscriptions
+	f.handlers[id] = handler
+
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.handlers, id)
+	}, nil
+}
+
+func (f *fakeMetricStream) publish(metric entity.Metric) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, handler := range f.handlers {
+		handler(&metric)
+	}
+}
+
+func (f *fakeMetricStream) active() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.handlers)
+}
+
+func next(t *testing.T, stream *MetricStream) []*entity.Metric {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	metrics, _, err := stream.Next(ctx)
+	if err != nil {
+		return nil
+	}
+	return metrics
+}
+
+func TestMetricHub(t *testing.T) {
+	clock, err := simulator.NewClock(config.ClockConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := simulator.NewManager(nil, nil, config.SimulatorConfig{Workers: 1}, clock, nil)
+	defer manager.Close()
+
+	repo := &fakeMetricStream{handlers: make(map[int]func(metric *entity.Metric))}
+	svc := &service{metricHub: newMetricHub(repo, manager)}
+
+	const sensorID = "8cf3030f-2206-4fcb-8c42-d0eb70e197ab"
+	all, err := svc.StreamMetrics(context.Background(), entity.MetricStreamFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	one, err := svc.StreamMetrics(context.Background(), entity.MetricStreamFilter{SensorIDs: []string{sensorID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.subscriptions != 1 {
+		t.Errorf("subscriptions = %d, want 1 shared by the clients", repo.subscriptions)
+	}
+
+	repo.publish(entity.Metric{SensorID: sensorID, Value: 1})
+	repo.publish(entity.Metric{SensorID: "3f1e4b52-9d0a-4c1b-a6f1-0d2c8e7b5a90", Value: 2})
+	if got := next(t, all); len(got) != 2 {
+		t.Errorf("unfiltered client received %d metrics, want 2", len(got))
+	}
+	if got := next(t, one); len(got) != 1 || got[0].SensorID != sensorID {
+		t.Errorf("filtered client received %v, want the metric of %s", got, sensorID)
+	}
+
+	// Sensors which are not running here have no type, so type filters drop them
+	typed, err := svc.StreamMetrics(context.Background(), entity.MetricStreamFilter{Types: []string{"temperature"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.publish(entity.Metric{SensorID: sensorID, Value: 3})
+	if got := next(t, typed); len(got) != 0 {
+		t.Errorf("type filtered client received %v, want nothing", got)
+	}
+
+	all.Close()
+	one.Close()
+	if repo.active() != 1 {
+		t.Errorf("active subscriptions = %d, want 1 while a client remains", repo.active())
+	}
+	typed.Close()
+	if repo.active() != 0 {
+		t.Errorf("active subscriptions = %d, want 0 after the last client left", repo.active())
+	}
+}
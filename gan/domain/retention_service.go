@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/simulator"
+	log "github.com/sirupsen/logrus"
+)
+
+// Shortest retention of the metrics
+const MIN_RETENTION = time.Hour
+
+type RetentionService interface {
+	GetRetentionPolicy(ctx context.Context) (*entity.RetentionPolicy, error)
+	SetRetentionPolicy(ctx context.Context, def *time.Duration, types map[string]time.Duration) (*entity.RetentionPolicy, error)
+	ApplyRetention(ctx context.Context) (*entity.RetentionCleanup, error)
+}
+
+func (s *service) GetRetentionPolicy(ctx context.Context) (*entity.RetentionPolicy, error) {
+	policy, err := s.repo.GetRetentionPolicy(ctx)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+
+	return policy, nil
+}
+
+func (s *service) SetRetentionPolicy(ctx context.Context, def *time.Duration,
+	types map[string]time.Duration) (*entity.RetentionPolicy, error) {
+	if def != nil && *def < MIN_RETENTION {
+		return nil, fmt.Errorf("%w: default retention must be at least %v", ErrInvalidRetention, MIN_RETENTION)
+	}
+	for typ, retention := range types {
+		if !simulator.IsSensorType(typ) {
+			return nil, fmt.Errorf("%w: unknown sensor type %s", ErrInvalidRetention, typ)
+		}
+		if retention < MIN_RETENTION {
+			return nil, fmt.Errorf("%w: retention of %s must be at least %v", ErrInvalidRetention, typ, MIN_RETENTION)
+		}
+	}
+
+	if types == nil {
+		types = make(map[string]time.Duration)
+	}
+	policy := &entity.RetentionPolicy{
+		Default:   def,
+		Types:     types,
+		UpdatedAt: time.Now().Unix(),
+	}
+
+	if err := s.repo.SetRetentionPolicy(ctx, policy); err != nil {
+		return nil, fromRepository(err)
+	}
+
+	return policy, nil
+}
+
+// This function deletes the metrics older than the retention of their sensor type. Whole chunks
+// are dropped up to the longest retention, and older rows of the types with shorter retentions
+// are deleted one by one. Retentions are measured from the wall-clock time, not the simulated one.
+// The configured default retention applies when the policy has none
+func (s *service) ApplyRetention(ctx context.Context) (*entity.RetentionCleanup, error) {
+	policy, err := s.repo.GetRetentionPolicy(ctx)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+	if policy.Default == nil && s.conf.Retention.Default > 0 {
+		def := time.Duration(s.conf.Retention.Default) * time.Second
+		policy.Default = &def
+	}
+
+	now := time.Now()
+	cleanup := &entity.RetentionCleanup{}
+
+	types := make([]string, 0, len(policy.Types))
+	longest := time.Duration(0)
+	for typ, retention := range policy.Types {
+		types = append(types, typ)
+		longest = max(longest, retention)
+	}
+	sort.Strings(types)
+
+	// Without a default retention some metrics are kept forever, so no chunk can be dropped
+	if policy.Default != nil {
+		longest = max(longest, *policy.Default)
+		cleanup.DroppedChunks, err = s.repo.DropMetricChunks(ctx, now.Add(-longest).UnixMilli())
+		if err != nil {
+			return cleanup, fromRepository(err)
+		}
+
+		if *policy.Default < longest {
+			deleted, err := s.repo.DeleteMetricsExceptTypes(ctx, types, now.Add(-*policy.Default).UnixMilli())
+			cleanup.DeletedRows += deleted
+			if err != nil {
+				return cleanup, err
+			}
+		}
+	}
+
+	for _, typ := range types {
+		retention := policy.Types[typ]
+		if policy.Default != nil && retention >= longest {
+			continue
+		}
+
+		deleted, err := s.repo.DeleteMetricsOfType(ctx, typ, now.Add(-retention).UnixMilli())
+		cleanup.DeletedRows += deleted
+		if err != nil {
+			return cleanup, err
+		}
+	}
+
+	log.Debugf("retention applied: %d chunks dropped and %d rows deleted", cleanup.DroppedChunks, cleanup.DeletedRows)
+
+	return cleanup, nil
+}
@@ -0,0 +1,114 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/config"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/repository"
+)
+
+// fakeRetention returns a stored policy and records the cleanups. The rest of the repository is
+// not implemented
+type fakeRetention struct {
+	repository.Repository
+	policy entity.RetentionPolicy
+	now    time.Time
+	calls  []string
+}
+
+func (f *fakeRetention) GetRetentionPolicy(ctx context.Context) (*entity.RetentionPolicy, error) {
+	policy := f.policy
+	return &policy, nil
+}
+
+func (f *fakeRetention) DropMetricChunks(ctx context.Context, olderThan int64) (int, error) {
+	f.calls = append(f.calls, fmt.Sprintf("drop chunks %v", f.age(olderThan)))
+	return 1, nil
+}
+
+func (f *fakeRetention) DeleteMetricsOfType(ctx context.Context, typ string, olderThan int64) (int64, error) {
+	f.calls = append(f.calls, fmt.Sprintf("delete %s %v", typ, f.age(olderThan)))
+	return 10, nil
+}
+
+func (f *fakeRetention) DeleteMetricsExceptTypes(ctx context.Context, types []string, olderThan int64) (int64, error) {
+	f.calls = append(f.calls, fmt.Sprintf("delete except %v %v", types, f.age(olderThan)))
+	return 100, nil
+}
+
+// Age of the metrics older than the given UNIX milliseconds, rounded to hours
+func (f *fakeRetention) age(olderThan int64) time.Duration {
+	return f.now.Sub(time.UnixMilli(olderThan)).Round(time.Hour)
+}
+
+func TestApplyRetention(t *testing.T) {
+	day := 24 * time.Hour
+	week := 7 * day
+	month := 30 * day
+
+	tests := []struct {
+		name string
+		def  *time.Duration
+		// Default retention of the configuration, in seconds
+		confDefault int
+		types       map[string]time.Duration
+		want        []string
+		wantCleanup entity.RetentionCleanup
+	}{
+		{name: "kept forever", want: nil},
+		{name: "only the default", def: &week,
+			want:        []string{"drop chunks 168h0m0s"},
+			wantCleanup: entity.RetentionCleanup{DroppedChunks: 1}},
+		{name: "types without a default are deleted row by row",
+			types:       map[string]time.Duration{"temperature": week, "humidity": day},
+			want:        []string{"delete humidity 24h0m0s", "delete temperature 168h0m0s"},
+			wantCleanup: entity.RetentionCleanup{DeletedRows: 20}},
+		{name: "default longer than the types", def: &month,
+			types:       map[string]time.Duration{"temperature": week, "humidity": day},
+			want:        []string{"drop chunks 720h0m0s", "delete humidity 24h0m0s", "delete temperature 168h0m0s"},
+			wantCleanup: entity.RetentionCleanup{DroppedChunks: 1, DeletedRows: 20}},
+		{name: "type longer than the default", def: &day,
+			types: map[string]time.Duration{"temperature": month, "humidity": week},
+			want: []string{"drop chunks 720h0m0s", "delete except [humidity temperature] 24h0m0s",
+				"delete humidity 168h0m0s"},
+			wantCleanup: entity.RetentionCleanup{DroppedChunks: 1, DeletedRows: 110}},
+		{name: "default equal to the longest type", def: &month,
+			types:       map[string]time.Duration{"temperature": month},
+			want:        []string{"drop chunks 720h0m0s"},
+			wantCleanup: entity.RetentionCleanup{DroppedChunks: 1}},
+		{name: "configured default", confDefault: int(week / time.Second),
+			types:       map[string]time.Duration{"humidity": day},
+			want:        []string{"drop chunks 168h0m0s", "delete humidity 24h0m0s"},
+			wantCleanup: entity.RetentionCleanup{DroppedChunks: 1, DeletedRows: 10}},
+		{name: "policy default replaces the configured one", def: &month, confDefault: int(week / time.Second),
+			want:        []string{"drop chunks 720h0m0s"},
+			wantCleanup: entity.RetentionCleanup{DroppedChunks: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeRetention{policy: entity.RetentionPolicy{Default: tt.def, Types: tt.types}, now: time.Now()}
+			if repo.policy.Types == nil {
+				repo.policy.Types = make(map[string]time.Duration)
+			}
+			svc := &service{repo: repo, conf: config.Config{Retention: config.RetentionConfig{Default: tt.confDefault}}}
+
+			cleanup, err := svc.ApplyRetention(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(repo.calls, tt.want) {
+				t.Errorf("cleanups = %q, want %q", repo.calls, tt.want)
+			}
+			if *cleanup != tt.wantCleanup {
+				t.Errorf("ApplyRetention() = %+v, want %+v", *cleanup, tt.wantCleanup)
+			}
+		})
+	}
+}
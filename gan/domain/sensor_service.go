@@ -2,29 +2,44 @@ package domain
 
 import (
 	"context"
+	stderrors "errors"
+	"fmt"
 	"time"
 
 	"github.com/AntonioBR9998/go-common/errors"
 	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/simulator"
 	log "github.com/sirupsen/logrus"
 )
 
 type SensorService interface {
-	CreateSensor(ctx context.Context, id string, typ string, alias string, rate int,
-		maxTh float32, minTh float32) (*entity.Sensor, error)
-	ModifySensor(ctx context.Context, id string, typ string, alias string, rate int,
-		maxTh float32, minTh float32) (*entity.Sensor, error)
+	CreateSensor(ctx context.Context, id string, typ string, alias string, rate time.Duration,
+		jitter time.Duration, maxTh float32, minTh float32, generator entity.Generator, crossingRate *float64, seed *int64,
+		faults entity.FaultProfile, replay *entity.Replay) (*entity.Sensor, error)
+	ModifySensor(ctx context.Context, id string, typ string, alias string, rate time.Duration,
+		jitter time.Duration, maxTh float32, minTh float32, generator entity.Generator, crossingRate *float64, seed *int64,
+		faults entity.FaultProfile, replay *entity.Replay, version int64) (*entity.Sensor, error)
+	SetSensorFaults(ctx context.Context, id string, version int64, faults entity.FaultProfile) (int64, error)
+	PatchSensor(ctx context.Context, id string, version int64, patch func(sensor *entity.Sensor) error) (*entity.Sensor, error)
+	GetSensor(ctx context.Context, id string) (*entity.Sensor, error)
 	GetSensors(ctx context.Context) ([]*entity.Sensor, error)
 	DeleteSensor(ctx context.Context, id string) error
+	SyncSimulators(ctx context.Context) error
 }
 
 func (s *service) CreateSensor(ctx context.Context,
 	id string,
 	typ string,
 	alias string,
-	rate int,
+	rate time.Duration,
+	jitter time.Duration,
 	maxTh float32,
 	minTh float32,
+	generator entity.Generator,
+	crossingRate *float64,
+	seed *int64,
+	faults entity.FaultProfile,
+	replay *entity.Replay,
 ) (*entity.Sensor, error) {
 	errVars := map[string]any{"id": id, "alias": alias}
 
@@ -46,22 +61,36 @@ func (s *service) CreateSensor(ctx context.Context,
 	updatedAt := time.Now().Unix()
 
 	sensor := &entity.Sensor{
-		ID:           id,
-		Type:         typ,
-		Alias:        alias,
-		Rate:         rate,
-		MaxThreshold: maxTh,
-		MinThreshold: minTh,
-		UpdatedAt:    updatedAt,
+		ID:                    id,
+		Type:                  typ,
+		Alias:                 alias,
+		Rate:                  rate,
+		Jitter:                jitter,
+		MaxThreshold:          maxTh,
+		MinThreshold:          minTh,
+		Generator:             generator,
+		ThresholdCrossingRate: crossingRate,
+		Seed:                  seed,
+		Faults:                faults,
+		Replay:                replay,
+		UpdatedAt:             updatedAt,
+		Version:               1,
 	}
 
-	err = s.repo.CreateSensor(ctx, sensor)
+	// Validating simulation settings
+	err = s.validateSimulation(ctx, sensor)
 	if err != nil {
+		log.Errorln("validation error: ", err)
 		return nil, err
 	}
 
+	err = s.repo.CreateSensor(ctx, sensor)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+
 	// Adding sensor to simulator
-	go s.simulator.Start(sensor.ID, sensor.Type, sensor.Rate)
+	s.simulator.Start(*sensor)
 
 	return sensor, nil
 }
@@ -70,9 +99,16 @@ func (s *service) ModifySensor(ctx context.Context,
 	id string,
 	typ string,
 	alias string,
-	rate int,
+	rate time.Duration,
+	jitter time.Duration,
 	maxTh float32,
 	minTh float32,
+	generator entity.Generator,
+	crossingRate *float64,
+	seed *int64,
+	faults entity.FaultProfile,
+	replay *entity.Replay,
+	version int64,
 ) (*entity.Sensor, error) {
 	errVars := map[string]any{"id": id, "alias": alias}
 
@@ -90,26 +126,154 @@ func (s *service) ModifySensor(ctx context.Context,
 		return nil, errors.TrackErrorVar(err, errVars)
 	}
 
-	// Updating sensor in database
+	// Updating sensor in database. It is only updated if it still has the given version, unless
+	// it is 0
 	updatedAt := time.Now().Unix()
 
 	sensor := &entity.Sensor{
-		ID:           id,
-		Type:         typ,
-		Alias:        alias,
-		Rate:         rate,
-		MaxThreshold: maxTh,
-		MinThreshold: minTh,
-		UpdatedAt:    updatedAt,
+		ID:                    id,
+		Type:                  typ,
+		Alias:                 alias,
+		Rate:                  rate,
+		Jitter:                jitter,
+		MaxThreshold:          maxTh,
+		MinThreshold:          minTh,
+		Generator:             generator,
+		ThresholdCrossingRate: crossingRate,
+		Seed:                  seed,
+		Faults:                faults,
+		Replay:                replay,
+		UpdatedAt:             updatedAt,
+		Version:               version,
+	}
+
+	// Validating simulation settings
+	err = s.validateSimulation(ctx, sensor)
+	if err != nil {
+		log.Errorln("validation error: ", err)
+		return nil, err
 	}
 
 	err = s.repo.ModifySensor(ctx, sensor)
 	if err != nil {
+		return nil, fromRepository(err)
+	}
+
+	// Updating sensor in simulator
+	s.runSimulation(*sensor)
+
+	return sensor, nil
+}
+
+// This function replaces the fault profile of a sensor and returns its new version. If version is
+// not 0, the stored sensor must have it
+func (s *service) SetSensorFaults(ctx context.Context, id string, version int64, faults entity.FaultProfile) (int64, error) {
+	errVars := map[string]any{"id": id}
+
+	// Validating param id
+	err := s.validate.Var(id, "uuid_rfc4122")
+	if err != nil {
+		log.Errorln("validation error: ", err)
+		return 0, errors.TrackErrorVar(err, errVars)
+	}
+
+	err = validateFaults(faults)
+	if err != nil {
+		log.Errorln("validation error: ", err)
+		return 0, err
+	}
+
+	// Updating sensor in database
+	updatedAt := time.Now().Unix()
+
+	version, err = s.repo.UpdateSensorFaults(ctx, id, faults, updatedAt, version)
+	if err != nil {
+		return 0, fromRepository(err)
+	}
+
+	// Updating running sensor in simulator
+	s.simulator.SetFaults(id, faults, updatedAt, version)
+
+	return version, nil
+}
+
+// This function changes some settings of a sensor. The patch receives a copy of the stored sensor
+// and changes it.
+// If version is not 0, the stored sensor must have it. In any case, the sensor is not updated if
+// someone else updates it meanwhile
+func (s *service) PatchSensor(ctx context.Context, id string, version int64, patch func(sensor *entity.Sensor) error) (*entity.Sensor, error) {
+	errVars := map[string]any{"id": id}
+
+	// Validating param id
+	err := s.validate.Var(id, "uuid_rfc4122")
+	if err != nil {
+		log.Errorln("validation error: ", err)
+		return nil, errors.TrackErrorVar(err, errVars)
+	}
+
+	stored, err := s.repo.GetSensor(ctx, id)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+	if version != 0 && stored.Version != version {
+		return nil, ErrVersionConflict
+	}
+
+	sensor := *stored
+	if err := patch(&sensor); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSimulation, err)
+	}
+	if sensor.ID != id {
+		return nil, fmt.Errorf("%w: the ID of a sensor cannot be changed", ErrInvalidSimulation)
+	}
+	if !simulator.IsSensorType(sensor.Type) {
+		return nil, fmt.Errorf("%w: type must be one of temperature, humidity or pressure", ErrInvalidSimulation)
+	}
+
+	// Validating param alias
+	err = s.validate.Var(sensor.Alias, "128_character_name")
+	if err != nil {
+		log.Errorln("validation error: ", err)
+		return nil, errors.TrackErrorVar(err, errVars)
+	}
+
+	// Validating simulation settings
+	err = s.validateSimulation(ctx, &sensor)
+	if err != nil {
+		log.Errorln("validation error: ", err)
 		return nil, err
 	}
 
-	// Replacing sensor in simulator
-	go s.simulator.Start(sensor.ID, sensor.Type, sensor.Rate)
+	// Updating sensor in database
+	sensor.UpdatedAt = time.Now().Unix()
+	sensor.Version = stored.Version
+
+	err = s.repo.ModifySensor(ctx, &sensor)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
+
+	// Updating sensor in simulator
+	s.runSimulation(sensor)
+
+	return &sensor, nil
+}
+
+func (s *service) GetSensor(ctx context.Context, id string) (*entity.Sensor, error) {
+	errVars := map[string]any{"id": id}
+
+	// Validating param id
+	err := s.validate.Var(id, "uuid_rfc4122")
+	if err != nil {
+		log.Errorln("validation error: ", err)
+		return nil, errors.TrackErrorVar(err, errVars)
+	}
+
+	// Calling repository
+	sensor, err := s.repo.GetSensor(ctx, id)
+	if err != nil {
+		return nil, fromRepository(err)
+	}
 
 	return sensor, nil
 }
@@ -118,7 +282,7 @@ func (s *service) GetSensors(ctx context.Context) ([]*entity.Sensor, error) {
 	// Calling repository
 	sensorList, err := s.repo.GetSensors(ctx)
 	if err != nil {
-		return nil, err
+		return nil, fromRepository(err)
 	}
 
 	return sensorList, nil
@@ -137,7 +301,7 @@ func (s *service) DeleteSensor(ctx context.Context, id string) error {
 	// Deleting sensor in database
 	err = s.repo.DeleteSensor(ctx, id)
 	if err != nil {
-		return err
+		return fromRepository(err)
 	}
 
 	// Deleting sensor in simulator
@@ -145,3 +309,84 @@ func (s *service) DeleteSensor(ctx context.Context, id string) error {
 
 	return nil
 }
+
+// This function applies the settings of an updated sensor to the simulator. The simulation is only
+// started again if the values of the sensor change (see simulator.NeedsRestart). It returns once
+// the simulator runs the sensor, so every update reaches it in order
+func (s *service) runSimulation(sensor entity.Sensor) {
+	if running, exists := s.simulator.Sensor(sensor.ID); exists && !simulator.NeedsRestart(running, sensor) {
+		s.simulator.Update(sensor)
+		return
+	}
+
+	s.simulator.Start(sensor)
+}
+
+// This function loads every sensor from the database and makes the simulator run exactly them
+func (s *service) SyncSimulators(ctx context.Context) error {
+	sensorList, err := s.repo.GetSensors(ctx)
+	if err != nil {
+		return fromRepository(err)
+	}
+
+	log.Debugf("synchronizing simulator with %d sensors", len(sensorList))
+	s.simulator.Sync(sensorList)
+
+	return nil
+}
+
+// This function checks the simulation settings of a sensor and fills the default generator
+func (s *service) validateSimulation(ctx context.Context, sensor *entity.Sensor) error {
+	if sensor.Generator.Type == "" {
+		sensor.Generator.Type = simulator.UNIFORM_GENERATOR
+	}
+
+	if err := simulator.ValidateGenerator(sensor.Type, sensor.Generator); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSimulation, err)
+	}
+
+	if err := simulator.ValidateRate(*sensor); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSimulation, err)
+	}
+
+	if err := simulator.ValidateBounds(*sensor); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSimulation, err)
+	}
+
+	if err := validateFaults(sensor.Faults); err != nil {
+		return err
+	}
+
+	return s.validateReplay(ctx, sensor.Replay)
+}
+
+// This function checks the fault profile of a sensor
+func validateFaults(faults entity.FaultProfile) error {
+	if err := simulator.ValidateFaults(faults); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSimulation, err)
+	}
+
+	return nil
+}
+
+// This function checks the replay settings of a sensor. The dataset must exist
+func (s *service) validateReplay(ctx context.Context, replay *entity.Replay) error {
+	if replay == nil {
+		return nil
+	}
+
+	if err := s.validate.Var(replay.DatasetID, "uuid_rfc4122"); err != nil {
+		return fmt.Errorf("%w: dataset ID must be a valid UUID", ErrInvalidSimulation)
+	}
+
+	if replay.Scale < 0 {
+		return fmt.Errorf("%w: replay scale must not be negative", ErrInvalidSimulation)
+	}
+
+	_, err := s.repo.GetDataset(ctx, replay.DatasetID)
+	if err = fromRepository(err); stderrors.Is(err, ErrDatasetNotFound) {
+		return fmt.Errorf("%w: dataset %s does not exist", ErrInvalidSimulation, replay.DatasetID)
+	}
+
+	return err
+}
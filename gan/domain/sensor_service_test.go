@@ -0,0 +1,238 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-common/validation"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/config"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/repository"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/simulator"
+)
+
+// fakeSensors keeps the sensors in memory. The rest of the repository is not implemented
+type fakeSensors struct {
+	repository.Repository
+	mu      sync.Mutex
+	sensors map[string]entity.Sensor
+	// Error returned listing the sensors
+	err error
+}
+
+func (f *fakeSensors) CreateSensor(ctx context.Context, sensor *entity.Sensor) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sensors[sensor.ID] = *sensor
+	return nil
+}
+
+func (f *fakeSensors) ModifySensor(ctx context.Context, sensor *entity.Sensor) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, exists := f.sensors[sensor.ID]
+	if !exists {
+		return repository.ErrSensorNotFound
+	}
+	if sensor.Version != 0 && sensor.Version != stored.Version {
+		return repository.ErrVersionConflict
+	}
+
+	sensor.Version = stored.Version + 1
+	f.sensors[sensor.ID] = *sensor
+	return nil
+}
+
+func (f *fakeSensors) GetSensor(ctx context.Context, id string) (*entity.Sensor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sensor, exists := f.sensors[id]
+	if !exists {
+		return nil, repository.ErrSensorNotFound
+	}
+	return &sensor, nil
+}
+
+func (f *fakeSensors) GetSensors(ctx context.Context) ([]*entity.Sensor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	sensors := make([]*entity.Sensor, 0, len(f.sensors))
+	for _, sensor := range f.sensors {
+		sensors = append(sensors, &sensor)
+	}
+	return sensors, nil
+}
+
+func (f *fakeSensors) DeleteSensor(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.sensors, id)
+	return nil
+}
+
+// countingPublisher counts the samples sent by every sensor
+type countingPublisher struct {
+	mu      sync.Mutex
+	samples map[string]int
+}
+
+func (p *countingPublisher) Publish(subject string, msgID string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.samples[subject]++
+	return nil
+}
+
+func (p *countingPublisher) count(subject string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.samples[subject]
+}
+
+func newSensorTestService(t *testing.T) (*service, *countingPublisher) {
+	t.Helper()
+
+	clock, err := simulator.NewClock(config.ClockConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subjects, err := simulator.NewSubjectTemplate(simulator.DEFAULT_SUBJECT_TEMPLATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := validation.NewValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := &countingPublisher{samples: make(map[string]int)}
+	manager := simulator.NewManager(publisher, subjects, config.SimulatorConfig{Workers: 1}, clock, nil)
+	t.Cleanup(manager.Close)
+
+	return &service{
+		repo:      &fakeSensors{sensors: make(map[string]entity.Sensor)},
+		validate:  validator,
+		simulator: manager,
+	}, publisher
+}
+
+func TestModifySensorRestartsOnlyWhenValuesChange(t *testing.T) {
+	svc, publisher := newSensorTestService(t)
+	ctx := context.Background()
+
+	const id = "8cf3030f-2206-4fcb-8c42-d0eb70e197ab"
+	subject := "sensors.temperature." + id
+
+	// The first sample of a sensor is sent as soon as it starts, and the next one in an hour
+	sensor, err := svc.CreateSensor(ctx, id, "temperature", "Kitchen", time.Hour, 0, 30, 10,
+		entity.Generator{}, nil, nil, entity.FaultProfile{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		alias    string
+		maxTh    float32
+		restarts bool
+	}{
+		{name: "alias", alias: "Living room", maxTh: 30, restarts: false},
+		{name: "thresholds", alias: "Living room", maxTh: 40, restarts: true},
+		{name: "same settings", alias: "Living room", maxTh: 40, restarts: false},
+	}
+
+	samples := 1
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sensor, err = svc.ModifySensor(ctx, id, "temperature", tt.alias, time.Hour, 0, tt.maxTh, 10,
+				entity.Generator{}, nil, nil, entity.FaultProfile{}, nil, sensor.Version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if running, ok := svc.simulator.Sensor(id); !ok || running.Version != sensor.Version || running.Alias != tt.alias {
+				t.Errorf("running sensor = %+v, want version %d with alias %s", running, sensor.Version, tt.alias)
+			}
+
+			if tt.restarts {
+				samples++
+			}
+			time.Sleep(50 * time.Millisecond)
+			if got := publisher.count(subject); got != samples {
+				t.Errorf("samples sent = %d, want %d", got, samples)
+			}
+		})
+	}
+}
+
+func TestSyncSimulatorsRestoresSensors(t *testing.T) {
+	svc, publisher := newSensorTestService(t)
+	repo := svc.repo.(*fakeSensors)
+	ctx := context.Background()
+
+	sensor := func(id string, typ string, generator string) entity.Sensor {
+		return entity.Sensor{ID: id, Type: typ, Alias: typ, Rate: time.Hour, MaxThreshold: 30,
+			Generator: entity.Generator{Type: generator}, Version: 1}
+	}
+	kitchen := sensor("8cf3030f-2206-4fcb-8c42-d0eb70e197ab", "temperature", simulator.UNIFORM_GENERATOR)
+	bathroom := sensor("2a1d7b55-93a4-4c1e-9d0f-3c8f4a6e5b21", "humidity", simulator.UNIFORM_GENERATOR)
+	broken := sensor("d1e4b0a6-5f43-4c7e-8a39-7b2c6f0e9d14", "pressure", "unknown")
+
+	steps := []struct {
+		name    string
+		sensors []entity.Sensor
+		err     error
+		want    []entity.Sensor
+		wantErr bool
+	}{
+		// Sensors which cannot be simulated do not stop the rest
+		{name: "startup", sensors: []entity.Sensor{kitchen, bathroom, broken}, want: []entity.Sensor{kitchen, bathroom}},
+		{name: "deleted sensor", sensors: []entity.Sensor{kitchen}, want: []entity.Sensor{kitchen}},
+		// The running sensors are kept while the database is not available
+		{name: "database not available", err: errors.New("connection refused"), want: []entity.Sensor{kitchen}, wantErr: true},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			repo.sensors = make(map[string]entity.Sensor)
+			for _, sensor := range step.sensors {
+				repo.sensors[sensor.ID] = sensor
+			}
+			repo.err = step.err
+
+			if err := svc.SyncSimulators(ctx); (err != nil) != step.wantErr {
+				t.Fatalf("SyncSimulators() error = %v, wantErr %v", err, step.wantErr)
+			}
+
+			for _, sensor := range []entity.Sensor{kitchen, bathroom, broken} {
+				want := slices.ContainsFunc(step.want, func(s entity.Sensor) bool { return s.ID == sensor.ID })
+				if _, running := svc.simulator.Sensor(sensor.ID); running != want {
+					t.Errorf("sensor %s running = %v, want %v", sensor.Alias, running, want)
+				}
+			}
+
+			// Every running sensor sent its first sample as soon as it started
+			time.Sleep(50 * time.Millisecond)
+			for _, sensor := range step.want {
+				if got := publisher.count(fmt.Sprintf("sensors.%s.%s", sensor.Type, sensor.ID)); got != 1 {
+					t.Errorf("samples sent by %s = %d, want 1", sensor.Alias, got)
+				}
+			}
+		})
+	}
+}
@@ -10,26 +10,35 @@ import (
 type Service interface {
 	SensorService
 	MetricService
+	DatasetService
+	DeadLetterService
+	RetentionService
+	MetricStreamService
 }
 
 type service struct {
-	repo      repository.Repository
-	conf      config.Config
-	validate  *validation.Validator
-	simulator *simulator.Manager
+	repo        repository.Repository
+	deadLetters repository.DeadLetterRepository
+	metricHub   *metricHub
+	conf        config.Config
+	validate    *validation.Validator
+	simulator   *simulator.Manager
 }
 
-func NewService(repo repository.Repository, conf config.Config, simulator *simulator.Manager) Service {
+func NewService(repo repository.Repository, deadLetters repository.DeadLetterRepository,
+	metricStream repository.MetricStreamRepository, conf config.Config, simulator *simulator.Manager) Service {
 	validator, err := validation.NewValidator()
 	if err != nil {
 		panic(err)
 	}
 
 	svc := &service{
-		repo:      repo,
-		conf:      conf,
-		validate:  validator,
-		simulator: simulator,
+		repo:        repo,
+		deadLetters: deadLetters,
+		metricHub:   newMetricHub(metricStream, simulator),
+		conf:        conf,
+		validate:    validator,
+		simulator:   simulator,
 	}
 
 	return svc
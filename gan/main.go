@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"database/sql"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	commonConfig "github.com/AntonioBR9998/go-common/config"
 	"github.com/nats-io/nats.go"
@@ -48,6 +51,32 @@ func main() {
 				EnvVars:   []string{"GAN_CONFIG_FILE"},
 			},
 		},
+		Commands: []*cli.Command{
+			{
+				Name:  "migrate",
+				Usage: "manage the database schema",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "up",
+						Usage:  "apply the pending migrations",
+						Action: migrateUp,
+					},
+					{
+						Name:   "down",
+						Usage:  "undo the last applied migrations",
+						Action: migrateDown,
+						Flags: []cli.Flag{
+							&cli.IntFlag{Name: "steps", Value: 1, Usage: "migrations to undo"},
+						},
+					},
+					{
+						Name:   "status",
+						Usage:  "list the migrations and whether they are applied",
+						Action: migrationStatus,
+					},
+				},
+			},
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -70,13 +99,53 @@ func startGanService(ctx *cli.Context) error {
 
 	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{ServerName: cfg.ServerName, InsecureSkipVerify: true}
 
+	log.Traceln("checking database schema")
+	if err := checkSchema(cfg); err != nil {
+		return err
+	}
+
 	log.Traceln("creating repository layer")
-	repository := repository.NewRepository(*cfg)
+	repo := repository.NewRepository(*cfg)
 
 	log.Traceln("creating service layer")
-	natsClient, _ := nats.Connect(cfg.Nats.Host + ":" + cfg.Nats.Port)
-	sensorManager := simulator.NewManager(natsClient)
-	service := domain.NewService(repository, *cfg, sensorManager)
+	natsClient, err := nats.Connect(cfg.Nats.Host + ":" + cfg.Nats.Port)
+	if err != nil {
+		return fmt.Errorf("error connecting to NATS: %w", err)
+	}
+	clock, err := simulator.NewClock(cfg.Simulator.Clock)
+	if err != nil {
+		return fmt.Errorf("error creating simulator clock: %w", err)
+	}
+	subjects, err := simulator.NewSubjectTemplate(cfg.Nats.SubjectTemplate)
+	if err != nil {
+		return fmt.Errorf("error creating sensors subject: %w", err)
+	}
+	publisher, err := simulator.NewJetStreamPublisher(context.Background(), natsClient, cfg.Nats.Stream, subjects)
+	if err != nil {
+		return fmt.Errorf("error creating sensors stream: %w", err)
+	}
+	sensorManager := simulator.NewManager(publisher, subjects, cfg.Simulator, clock, repo)
+	deadLetters, err := repository.NewDeadLetterRepository(context.Background(), natsClient, cfg.Nats.DeadLetter)
+	if err != nil {
+		return fmt.Errorf("error creating dead letter stream: %w", err)
+	}
+	metricStream := repository.NewMetricStreamRepository(natsClient, subjects.Filter())
+	service := domain.NewService(repo, deadLetters, metricStream, *cfg, sensorManager)
+
+	log.Traceln("restoring sensors from database")
+	if err := service.SyncSimulators(context.Background()); err != nil {
+		log.Errorf("error restoring sensors from database: %v", err)
+	}
+	if cfg.Simulator.ReconcileInterval > 0 {
+		go reconcileSimulators(service, time.Duration(cfg.Simulator.ReconcileInterval)*time.Second)
+	}
+
+	if def := time.Duration(cfg.Retention.Default) * time.Second; def > 0 && def < domain.MIN_RETENTION {
+		return fmt.Errorf("default retention must be at least %v", domain.MIN_RETENTION)
+	}
+	if cfg.Retention.Interval > 0 {
+		go applyRetention(service, time.Duration(cfg.Retention.Interval)*time.Second)
+	}
 
 	log.Traceln("creating REST API layer")
 	s := server.NewAPI(*cfg, service)
@@ -85,6 +154,100 @@ func startGanService(ctx *cli.Context) error {
 	return http.ListenAndServe(cfg.API.GetRelativeURL(), s.Router())
 }
 
+// Checks that the database schema is up to date before serving
+func checkSchema(cfg *config.Config) error {
+	db := repository.NewPostgresClient(cfg.TimescaleDB)
+	defer db.Close()
+
+	return repository.CheckSchemaVersion(context.Background(), db)
+}
+
+// Loads the configuration of the migrate subcommands and connects to the database
+func migrationClient(ctx *cli.Context) *sql.DB {
+	cfg := commonConfig.New(
+		&config.Config{},
+		func(cfg *config.Config) {
+			cfg.ConfigPath = ctx.String("config")
+		},
+	)
+
+	return repository.NewPostgresClient(cfg.TimescaleDB)
+}
+
+func migrateUp(ctx *cli.Context) error {
+	db := migrationClient(ctx)
+	defer db.Close()
+
+	applied, err := repository.MigrateUp(ctx.Context, db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d migrations applied\n", len(applied))
+	return nil
+}
+
+func migrateDown(ctx *cli.Context) error {
+	db := migrationClient(ctx)
+	defer db.Close()
+
+	undone, err := repository.MigrateDown(ctx.Context, db, ctx.Int("steps"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d migrations undone\n", len(undone))
+	return nil
+}
+
+func migrationStatus(ctx *cli.Context) error {
+	db := migrationClient(ctx)
+	defer db.Close()
+
+	statusList, err := repository.GetMigrationStatus(ctx.Context, db)
+
+	fmt.Printf("%8s %-30s %s\n", "version", "name", "applied at")
+	for _, status := range statusList {
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = time.Unix(*status.AppliedAt, 0).UTC().Format(time.RFC3339)
+		}
+		fmt.Printf("%8d %-30s %s\n", status.Version, status.Name, appliedAt)
+	}
+
+	return err
+}
+
+// Periodically reconciles the running sensors with the devices table
+func reconcileSimulators(service domain.Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := service.SyncSimulators(context.Background()); err != nil {
+			log.Errorf("error reconciling sensors with database: %v", err)
+		}
+	}
+}
+
+// Deletes the metrics older than their retention at startup and periodically after it
+func applyRetention(service domain.Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cleanup, err := service.ApplyRetention(context.Background())
+		if err != nil {
+			log.Errorf("error applying metrics retention: %v", err)
+		} else {
+			log.Infof("metrics retention applied: %d chunks dropped and %d rows deleted",
+				cleanup.DroppedChunks, cleanup.DeletedRows)
+		}
+
+		<-ticker.C
+	}
+}
+
 func BeforeFunc(ctx *cli.Context) error {
 	ch := make(chan os.Signal, 2)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
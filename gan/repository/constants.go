@@ -2,33 +2,163 @@ package repository
 
 const (
 	// Sensors
-	DEVICE_FIELDS = "id, type, alias, rate, max_threshold, min_threshold, updated_at"
+	DEVICE_FIELDS = "id, type, alias, rate_ns, jitter_ns, max_threshold, min_threshold, generator, threshold_crossing_rate, seed, faults, replay, updated_at, version"
 
 	INSERT_SENSOR = `
 		INSERT INTO devices (` + DEVICE_FIELDS + `)
-		VALUES ($1, $2, $3, $4, $5, $6, $7);`
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14);`
 
+	// The row is only updated if its version is $14, or whatever its version is if $14 is 0
 	REPLACE_SENSOR = `
 		UPDATE devices
-		SET type=$2, alias=$3, rate=$4, max_threshold=$5, min_threshold=$6, updated_at=$7
+		SET type=$2, alias=$3, rate_ns=$4, jitter_ns=$5, max_threshold=$6, min_threshold=$7, generator=$8,
+			threshold_crossing_rate=$9, seed=$10, faults=$11, replay=$12, updated_at=$13, version=version+1
+		WHERE id=$1 AND ($14=0 OR version=$14)
+		RETURNING version;`
+
+	// The row is only updated if its version is $4, or whatever its version is if $4 is 0
+	UPDATE_SENSOR_FAULTS = `
+		UPDATE devices
+		SET faults=$2, updated_at=$3, version=version+1
+		WHERE id=$1 AND ($4=0 OR version=$4)
+		RETURNING version;`
+
+	GET_SENSOR_VERSION = `
+		SELECT version
+		FROM devices
 		WHERE id=$1;`
 
 	DELETE_SENSOR = `
 		DELETE FROM devices
 		WHERE id=$1;`
 
+	GET_SENSOR = `
+		SELECT
+			` + DEVICE_FIELDS + `
+		FROM devices
+		WHERE id=$1;`
+
 	GET_SENSORS = `
         SELECT
 			` + DEVICE_FIELDS + `
         FROM devices
 		WHERE TRUE` // This botched job is neccessary for adding filters in query
 
+	// Datasets
+	DATASET_FIELDS = "id, name, format, samples, created_at"
+
+	INSERT_DATASET = `
+		INSERT INTO datasets (` + DATASET_FIELDS + `, content)
+		VALUES ($1, $2, $3, $4, $5, $6);`
+
+	GET_DATASETS = `
+		SELECT
+			` + DATASET_FIELDS + `
+		FROM datasets
+		WHERE TRUE` // This botched job is neccessary for adding filters in query
+
+	GET_DATASET = `
+		SELECT
+			` + DATASET_FIELDS + `
+		FROM datasets
+		WHERE id=$1;`
+
+	GET_DATASET_CONTENT = `
+		SELECT format, content
+		FROM datasets
+		WHERE id=$1;`
+
+	COUNT_DATASET_SENSORS = `
+		SELECT COUNT(*)
+		FROM devices
+		WHERE replay->>'datasetId'=$1;`
+
+	DELETE_DATASET = `
+		DELETE FROM datasets
+		WHERE id=$1;`
+
+	// Retention policies
+	GET_RETENTION_POLICIES = `
+		SELECT scope, retention_ns, updated_at
+		FROM retention_policies;`
+
+	DELETE_RETENTION_POLICIES = `
+		DELETE FROM retention_policies;`
+
+	INSERT_RETENTION_POLICY = `
+		INSERT INTO retention_policies (scope, retention_ns, updated_at)
+		VALUES ($1, $2, $3);`
+
+	// Chunks whose samples are all older than $1 are dropped at once
+	DROP_METRIC_CHUNKS = `
+		SELECT count(*)
+		FROM drop_chunks('metrics', older_than => $1::BIGINT);`
+
+	DELETE_METRICS_OF_TYPE = `
+		DELETE FROM metrics m
+		USING devices d
+		WHERE m.sensor_id = d.id
+			AND d.type::TEXT = $1
+			AND m.timestamp < $2;`
+
+	// Metrics of the sensors of other types, or which no longer exist
+	DELETE_METRICS_EXCEPT_TYPES = `
+		DELETE FROM metrics
+		WHERE timestamp < $1
+			AND sensor_id NOT IN (SELECT id FROM devices WHERE type::TEXT = ANY($2));`
+
 	// Metrics
-	METRICS_FIELDS = "sensor_id, value, unit, timestamp"
+	METRICS_FIELDS = "sensor_id, value, unit, timestamp, out_of_range"
 
 	GET_METRICS = `
 		SELECT
 			` + METRICS_FIELDS + `
 		FROM metrics
 		WHERE TRUE` // This botched job is neccessary for adding filters in query
+
+	// Time column, function expression and table are filled by the repository
+	GET_METRIC_AGGREGATES = `
+		SELECT
+			time_bucket($1::BIGINT, %[1]s) AS bucket_start,
+			(%[2]s)::DOUBLE PRECISION
+		FROM %[3]s
+		WHERE sensor_id = $2
+			AND %[1]s >= $3
+			AND %[1]s < $4
+		GROUP BY bucket_start
+		ORDER BY bucket_start;`
+
+	// The latest metric of every sensor is read with the (sensor_id, timestamp) index, instead of
+	// scanning the whole hypertable like DISTINCT ON would
+	GET_LATEST_METRICS = `
+		SELECT
+			d.id, m.value, m.unit, m.timestamp, m.out_of_range
+		FROM devices d
+		CROSS JOIN LATERAL (
+			SELECT value, unit, timestamp, out_of_range
+			FROM metrics
+			WHERE sensor_id = d.id
+			ORDER BY timestamp DESC
+			LIMIT 1
+		) m
+		ORDER BY d.id;`
+
+	GET_LATEST_METRIC = `
+		SELECT
+			` + METRICS_FIELDS + `
+		FROM metrics
+		WHERE sensor_id = $1
+		ORDER BY timestamp DESC
+		LIMIT 1;`
+
+	// Cursor of a bulk export. The predicates are added by the repository
+	DECLARE_METRIC_EXPORT_CURSOR = `
+		DECLARE metric_export NO SCROLL CURSOR FOR
+		SELECT
+			` + METRICS_FIELDS + `
+		FROM metrics
+		WHERE TRUE%s
+		ORDER BY timestamp, sensor_id`
+
+	FETCH_METRIC_EXPORT = "FETCH FORWARD %d FROM metric_export"
 )
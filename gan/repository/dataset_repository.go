@@ -0,0 +1,212 @@
+// Datasets CRUD in TimescaleDB
+
+package repository
+
+import (
+	"context"
+	stdsql "database/sql"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AntonioBR9998/go-common/errors"
+	"github.com/AntonioBR9998/go-common/humamw"
+	"github.com/AntonioBR9998/go-common/sql"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	log "github.com/sirupsen/logrus"
+)
+
+const DATASET_RESOURCE_TYPE = "dataset"
+
+type DatasetRepository interface {
+	CreateDataset(ctx context.Context, dataset *entity.Dataset, content []byte) error
+	GetDataset(ctx context.Context, id string) (*entity.Dataset, error)
+	GetDatasetContent(ctx context.Context, id string) (string, []byte, error)
+	GetDatasets(ctx context.Context) ([]*entity.Dataset, error)
+	DeleteDataset(ctx context.Context, id string) error
+}
+
+func (r *repository) CreateDataset(ctx context.Context, dataset *entity.Dataset, content []byte) error {
+	log.Debugf("writing in repository datasets table a new dataset with ID: %s", dataset.ID)
+
+	errVars := map[string]any{"id": dataset.ID, "name": dataset.Name}
+
+	// Writing in TimescaleDB a new dataset
+	_, err := r.timescaleDbClient.Exec(
+		INSERT_DATASET,
+		dataset.ID,
+		dataset.Name,
+		dataset.Format,
+		dataset.Samples,
+		dataset.CreatedAt,
+		content,
+	)
+
+	if err != nil {
+		err := errors.WrapPostgresErrorCode(err, DATASET_RESOURCE_TYPE, dataset.ID)
+		return errors.TrackErrorVar(err, errVars)
+	}
+
+	return nil
+}
+
+func (r *repository) GetDataset(ctx context.Context, id string) (*entity.Dataset, error) {
+	log.Debugf("getting in repository the dataset with ID: %s", id)
+
+	errVars := map[string]any{"id": id}
+
+	var dataset entity.Dataset
+	err := r.timescaleDbClient.QueryRow(GET_DATASET, id).Scan(&dataset.ID, &dataset.Name,
+		&dataset.Format, &dataset.Samples, &dataset.CreatedAt)
+
+	if stderrors.Is(err, stdsql.ErrNoRows) {
+		return nil, ErrDatasetNotFound
+	}
+	if err != nil {
+		err := errors.WrapPostgresErrorCode(err, DATASET_RESOURCE_TYPE, id)
+		return nil, errors.TrackErrorVar(err, errVars)
+	}
+
+	return &dataset, nil
+}
+
+// It returns the format and the raw content of a dataset
+func (r *repository) GetDatasetContent(ctx context.Context, id string) (string, []byte, error) {
+	log.Debugf("getting in repository the content of dataset with ID: %s", id)
+
+	errVars := map[string]any{"id": id}
+
+	var format string
+	var content []byte
+	err := r.timescaleDbClient.QueryRow(GET_DATASET_CONTENT, id).Scan(&format, &content)
+
+	if stderrors.Is(err, stdsql.ErrNoRows) {
+		return "", nil, ErrDatasetNotFound
+	}
+	if err != nil {
+		err := errors.WrapPostgresErrorCode(err, DATASET_RESOURCE_TYPE, id)
+		return "", nil, errors.TrackErrorVar(err, errVars)
+	}
+
+	return format, content, nil
+}
+
+// Allowed fields to filter by in /GET datasets
+var getDatasetsWhereDef = map[string]string{
+	"id":     "id",
+	"name":   "name",
+	"format": "format",
+}
+
+// Allowed fields to order by in /GET datasets
+var getDatasetsOrderDef = map[string]string{
+	"name":      "name",
+	"createdAt": "created_at",
+}
+
+func (r *repository) GetDatasets(ctx context.Context) ([]*entity.Dataset, error) {
+	log.Debug("getting datasets in repository")
+
+	queryTemplate := GET_DATASETS
+	args := []any{}
+
+	// Getting filters
+	filter, hasFilter := humamw.GetFilter(ctx)
+	if hasFilter {
+		var err error
+		queryTemplate, args, err = sql.AddFilterToQuery(filter, getDatasetsWhereDef, getDatasetsOrderDef, queryTemplate, args)
+		if err != nil {
+			return nil, errors.TrackError(err)
+		}
+	}
+
+	// Getting total
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS subquery", queryTemplate)
+	var total int
+	prev := time.Now()
+	err := r.timescaleDbClient.QueryRow(countQuery, args...).Scan(&total)
+	log.Infof("Time counting datasets: %v", time.Since(prev))
+
+	if err != nil {
+		log.Errorf("Error while counting datasets: %v \n query: %s", err, countQuery)
+		return nil, errors.TrackError(err)
+	}
+
+	// Pagination should has default values (see middleware to setup)
+	pagination, hasPagination := humamw.GetPagination(ctx)
+	// If has pagination
+	if hasPagination {
+		// Update template to use pagination
+		argsLen := len(args)
+		paginatedStr := fmt.Sprintf(" LIMIT $%d OFFSET $%d", argsLen+1, argsLen+2)
+		queryTemplate = strings.Join([]string{queryTemplate, paginatedStr, ";"}, "")
+		// Add pagination limit and offset
+		args = append(args, pagination.Limit, pagination.Offset)
+	}
+
+	rows, err := r.timescaleDbClient.Query(queryTemplate, args...)
+	if err != nil {
+		log.Errorf("Error executing query: %s \n error: %v", queryTemplate, err)
+		return nil, errors.TrackError(err)
+	}
+	defer rows.Close()
+
+	// Reading rows
+	var datasetsData = []*entity.Dataset{}
+	for rows.Next() {
+		var dataset entity.Dataset
+
+		if err := rows.Scan(&dataset.ID, &dataset.Name, &dataset.Format, &dataset.Samples, &dataset.CreatedAt); err != nil {
+			log.Errorln("Error scanning datasets table rows:", err)
+			return nil, errors.TrackError(err)
+		}
+
+		datasetsData = append(datasetsData, &dataset)
+	}
+
+	if cb, ok := humamw.GetSetHeaderCallback(ctx, "Total"); ok {
+		cb("Total", strconv.Itoa(total))
+	}
+
+	return datasetsData, nil
+}
+
+// Datasets replayed by sensors cannot be deleted
+func (r *repository) DeleteDataset(ctx context.Context, id string) error {
+	log.Debugf("deleting in repository datasets table the dataset with ID: %s", id)
+
+	errVars := map[string]any{"id": id}
+
+	var sensors int
+	err := r.timescaleDbClient.QueryRow(COUNT_DATASET_SENSORS, id).Scan(&sensors)
+	if err != nil {
+		err := errors.WrapPostgresErrorCode(err, DATASET_RESOURCE_TYPE, id)
+		return errors.TrackErrorVar(err, errVars)
+	}
+	if sensors > 0 {
+		return ErrDatasetInUse
+	}
+
+	// Deleting in TimescaleDB
+	res, err := r.timescaleDbClient.Exec(
+		DELETE_DATASET,
+		id,
+	)
+
+	if err != nil {
+		err := errors.WrapPostgresErrorCode(err, DATASET_RESOURCE_TYPE, id)
+		return errors.TrackErrorVar(err, errVars)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.TrackErrorVar(err, errVars)
+	}
+	if affected == 0 {
+		return ErrDatasetNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+// Dead letters of NTA in a JetStream stream
+
+package repository
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AntonioBR9998/go-common/errors"
+	"github.com/AntonioBR9998/go-common/humamw"
+	"github.com/AntonioBR9998/go-nats-simulator/deadletter"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/config"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	log "github.com/sirupsen/logrus"
+)
+
+type DeadLetterRepository interface {
+	GetDeadLetters(ctx context.Context) ([]*entity.DeadLetter, error)
+	GetDeadLetter(ctx context.Context, seq uint64) (*entity.DeadLetter, error)
+	RedriveDeadLetter(ctx context.Context, seq uint64) error
+	DeleteDeadLetter(ctx context.Context, seq uint64) error
+}
+
+// Longest wait for a page of dead letters
+const DEAD_LETTERS_FETCH_WAIT = 5 * time.Second
+
+type deadLetterRepository struct {
+	js     jetstream.JetStream
+	stream jetstream.Stream
+	prefix string
+}
+
+// NewDeadLetterRepository creates the dead letter stream or updates it with the configured
+// settings. It stores every subject under the dead letter prefix
+func NewDeadLetterRepository(ctx context.Context, nc *nats.Conn, conf config.DeadLetterConfig) (DeadLetterRepository, error) {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	name := conf.Stream
+	if name == "" {
+		name = deadletter.DEFAULT_STREAM
+	}
+	prefix := conf.Prefix
+	if prefix == "" {
+		prefix = deadletter.DEFAULT_PREFIX
+	}
+
+	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     name,
+		Subjects: []string{deadletter.Subjects(prefix)},
+		MaxAge:   time.Duration(conf.MaxAge * float64(time.Second)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating stream %s: %w", name, err)
+	}
+
+	return &deadLetterRepository{js: js, stream: stream, prefix: prefix}, nil
+}
+
+// This function reads a dead letter from the headers added by NTA
+func (r *deadLetterRepository) toDeadLetter(msg *jetstream.RawStreamMsg) *entity.DeadLetter {
+	deadLetter := &entity.DeadLetter{
+		Sequence: msg.Sequence,
+		Subject:  msg.Header.Get(deadletter.SUBJECT_HEADER),
+		Reason:   msg.Header.Get(deadletter.REASON_HEADER),
+		Stream:   msg.Header.Get(deadletter.STREAM_HEADER),
+		Payload:  msg.Data,
+		FailedAt: msg.Time.Unix(),
+	}
+	deadLetter.Attempts, _ = strconv.Atoi(msg.Header.Get(deadletter.ATTEMPTS_HEADER))
+	deadLetter.StreamSequence, _ = strconv.ParseUint(msg.Header.Get(deadletter.SEQUENCE_HEADER), 10, 64)
+
+	// Dead letters without the header keep their subject after the prefix
+	if deadLetter.Subject == "" {
+		deadLetter.Subject = deadletter.OriginalSubject(r.prefix, msg.Subject)
+	}
+
+	return deadLetter
+}
+
+// This function returns the sequence of the dead letter at the given position of the stream.
+// Deleted dead letters leave gaps in the sequence, which are skipped
+func startSequence(state jetstream.StreamState, offset uint64) uint64 {
+	seq := state.FirstSeq + offset
+	// Gaps are sorted, and every one before the start moves it one position further
+	for _, deleted := range state.Deleted {
+		if deleted >= state.FirstSeq && deleted <= seq {
+			seq++
+		}
+	}
+
+	return seq
+}
+
+// Dead letters are listed in the order they failed. A page is read with an ordered consumer which
+// starts at its first dead letter
+func (r *deadLetterRepository) GetDeadLetters(ctx context.Context) ([]*entity.DeadLetter, error) {
+	log.Debug("getting dead letters in repository")
+
+	info, err := r.stream.Info(ctx, jetstream.WithDeletedDetails(true))
+	if err != nil {
+		return nil, errors.TrackError(err)
+	}
+
+	offset, limit := uint64(0), info.State.Msgs
+	if pagination, hasPagination := humamw.GetPagination(ctx); hasPagination {
+		offset, limit = uint64(pagination.Offset), uint64(pagination.Limit)
+	}
+	if cb, ok := humamw.GetSetHeaderCallback(ctx, "Total"); ok {
+		cb("Total", strconv.FormatUint(info.State.Msgs, 10))
+	}
+
+	// The fetch waits for the whole batch, so it never asks for more dead letters than remain
+	deadLetters := []*entity.DeadLetter{}
+	if offset >= info.State.Msgs || limit == 0 {
+		return deadLetters, nil
+	}
+	limit = min(limit, info.State.Msgs-offset)
+
+	consumer, err := r.stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{
+		DeliverPolicy: jetstream.DeliverByStartSequencePolicy,
+		OptStartSeq:   startSequence(info.State, offset),
+	})
+	if err != nil {
+		return nil, errors.TrackError(err)
+	}
+
+	batch, err := consumer.Fetch(int(limit), jetstream.FetchMaxWait(DEAD_LETTERS_FETCH_WAIT))
+	if err != nil {
+		return nil, errors.TrackError(err)
+	}
+	for msg := range batch.Messages() {
+		meta, err := msg.Metadata()
+		if err != nil {
+			return nil, errors.TrackError(err)
+		}
+
+		deadLetters = append(deadLetters, r.toDeadLetter(&jetstream.RawStreamMsg{
+			Subject:  msg.Subject(),
+			Sequence: meta.Sequence.Stream,
+			Header:   msg.Headers(),
+			Data:     msg.Data(),
+			Time:     meta.Timestamp,
+		}))
+	}
+	if err := batch.Error(); err != nil {
+		return nil, errors.TrackError(err)
+	}
+
+	return deadLetters, nil
+}
+
+func (r *deadLetterRepository) GetDeadLetter(ctx context.Context, seq uint64) (*entity.DeadLetter, error) {
+	log.Debugf("getting in repository the dead letter with sequence: %d", seq)
+
+	msg, err := r.stream.GetMsg(ctx, seq)
+	if stderrors.Is(err, jetstream.ErrMsgNotFound) {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, errors.TrackErrorVar(err, map[string]any{"sequence": seq})
+	}
+
+	return r.toDeadLetter(msg), nil
+}
+
+// The message is published again in its original subject and the dead letter is deleted
+func (r *deadLetterRepository) RedriveDeadLetter(ctx context.Context, seq uint64) error {
+	log.Debugf("re-driving in repository the dead letter with sequence: %d", seq)
+
+	errVars := map[string]any{"sequence": seq}
+
+	deadLetter, err := r.GetDeadLetter(ctx, seq)
+	if err != nil {
+		return err
+	}
+
+	// The original message ID was already stored, so the stream would drop it as a duplicate
+	msg := nats.NewMsg(deadLetter.Subject)
+	msg.Data = deadLetter.Payload
+	_, err = r.js.PublishMsg(ctx, msg, jetstream.WithMsgID(fmt.Sprintf("redrive-%s-%d", r.prefix, seq)))
+	if err != nil {
+		return errors.TrackErrorVar(err, errVars)
+	}
+
+	return r.DeleteDeadLetter(ctx, seq)
+}
+
+func (r *deadLetterRepository) DeleteDeadLetter(ctx context.Context, seq uint64) error {
+	log.Debugf("deleting in repository the dead letter with sequence: %d", seq)
+
+	// The stream does not tell why a message cannot be deleted
+	if _, err := r.GetDeadLetter(ctx, seq); err != nil {
+		return err
+	}
+
+	err := r.stream.DeleteMsg(ctx, seq)
+	if err != nil {
+		return errors.TrackErrorVar(err, map[string]any{"sequence": seq})
+	}
+
+	return nil
+}
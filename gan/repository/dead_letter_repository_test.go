@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/deadletter"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestStartSequence(t *testing.T) {
+	tests := []struct {
+		name    string
+		first   uint64
+		deleted []uint64
+		offset  uint64
+		want    uint64
+	}{
+		{name: "first page", first: 1, offset: 0, want: 1},
+		{name: "without gaps", first: 1, offset: 20, want: 21},
+		{name: "after purged messages", first: 101, offset: 20, want: 121},
+		{name: "gaps before the page", first: 1, deleted: []uint64{3, 5}, offset: 20, want: 23},
+		{name: "gaps after the page", first: 1, deleted: []uint64{30, 31}, offset: 20, want: 21},
+		{name: "gap at the start of the page", first: 1, deleted: []uint64{21, 22}, offset: 20, want: 23},
+		{name: "gaps pushing the start onto more gaps", first: 1, deleted: []uint64{2, 3, 4}, offset: 1, want: 5},
+		{name: "gaps before the first message", first: 10, deleted: []uint64{2, 3}, offset: 5, want: 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := startSequence(jetstream.StreamState{FirstSeq: tt.first, Deleted: tt.deleted}, tt.offset)
+			if got != tt.want {
+				t.Errorf("startSequence() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// Dead letter read by a consumer
+type fakeDeadLetterMsg struct {
+	jetstream.Msg
+	seq     uint64
+	subject string
+}
+
+func (m fakeDeadLetterMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{Sequence: jetstream.SequencePair{Stream: m.seq}, Timestamp: time.Unix(1714521600, 0)}, nil
+}
+
+func (m fakeDeadLetterMsg) Subject() string { return "dlq." + m.subject }
+func (m fakeDeadLetterMsg) Data() []byte    { return []byte("{}") }
+func (m fakeDeadLetterMsg) Headers() nats.Header {
+	return nats.Header{deadletter.REASON_HEADER: {"invalid sample"}}
+}
+
+type fakeBatch struct {
+	msgs chan jetstream.Msg
+}
+
+func (b fakeBatch) Messages() <-chan jetstream.Msg { return b.msgs }
+func (b fakeBatch) Error() error                   { return nil }
+
+// fakeDeadLetterStream keeps the sequences of its dead letters, and records where its consumers
+// start and how many dead letters they fetch
+type fakeDeadLetterStream struct {
+	jetstream.Stream
+	seqs    []uint64
+	deleted []uint64
+	start   uint64
+	fetched int
+}
+
+func (s *fakeDeadLetterStream) Info(ctx context.Context, opts ...jetstream.StreamInfoOpt) (*jetstream.StreamInfo, error) {
+	return &jetstream.StreamInfo{State: jetstream.StreamState{
+		Msgs:     uint64(len(s.seqs)),
+		FirstSeq: s.seqs[0],
+		Deleted:  s.deleted,
+	}}, nil
+}
+
+func (s *fakeDeadLetterStream) OrderedConsumer(ctx context.Context, cfg jetstream.OrderedConsumerConfig) (jetstream.Consumer, error) {
+	s.start = cfg.OptStartSeq
+	return fakeDeadLetterConsumer{stream: s}, nil
+}
+
+// Consumer of a fakeDeadLetterStream. It only fetches
+type fakeDeadLetterConsumer struct {
+	jetstream.Consumer
+	stream *fakeDeadLetterStream
+}
+
+func (c fakeDeadLetterConsumer) Fetch(batch int, opts ...jetstream.FetchOpt) (jetstream.MessageBatch, error) {
+	s := c.stream
+	s.fetched = batch
+
+	msgs := make(chan jetstream.Msg, batch)
+	for _, seq := range s.seqs {
+		if seq >= s.start && len(msgs) < batch {
+			msgs <- fakeDeadLetterMsg{seq: seq, subject: "sensors.temperature"}
+		}
+	}
+	close(msgs)
+
+	return fakeBatch{msgs: msgs}, nil
+}
+
+func TestGetDeadLetters(t *testing.T) {
+	stream := &fakeDeadLetterStream{seqs: []uint64{4, 6, 7}, deleted: []uint64{5}}
+	r := &deadLetterRepository{stream: stream, prefix: "dlq"}
+
+	deadLetters, err := r.GetDeadLetters(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The consumer starts at the first dead letter and fetches the remaining ones at once
+	if stream.start != 4 || stream.fetched != 3 {
+		t.Errorf("consumer started at %d fetching %d, want 4 fetching 3", stream.start, stream.fetched)
+	}
+	if len(deadLetters) != len(stream.seqs) {
+		t.Fatalf("GetDeadLetters() returned %d dead letters, want %d", len(deadLetters), len(stream.seqs))
+	}
+	for i, deadLetter := range deadLetters {
+		if deadLetter.Sequence != stream.seqs[i] || deadLetter.Subject != "sensors.temperature" ||
+			deadLetter.Reason != "invalid sample" || deadLetter.FailedAt != 1714521600 {
+			t.Errorf("dead letter %d = %+v", i, *deadLetter)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package repository
+
+import "errors"
+
+// ErrSensorNotFound is returned when there is no sensor with the given ID in the devices table
+var ErrSensorNotFound = errors.New("sensor not found")
+
+// ErrVersionConflict is returned when a sensor is updated but its version is not the expected one,
+// because someone else has updated it since it was read
+var ErrVersionConflict = errors.New("sensor has been modified by someone else")
+
+// ErrMetricNotFound is returned when a sensor has no metrics
+var ErrMetricNotFound = errors.New("sensor has no metrics")
+
+// ErrDatasetNotFound is returned when there is no dataset with the given ID in the datasets table
+var ErrDatasetNotFound = errors.New("dataset not found")
+
+// ErrDeadLetterNotFound is returned when there is no dead letter with the given sequence
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// ErrDatasetInUse is returned when a dataset cannot be deleted because some sensors replay it
+var ErrDatasetInUse = errors.New("dataset is replayed by some sensors")
+
+// ErrSchemaOutdated is returned when some migrations are not applied to the database
+var ErrSchemaOutdated = errors.New("database schema is outdated")
+
+// ErrSchemaTooNew is returned when the database has migrations applied by a newer GAN version
+var ErrSchemaTooNew = errors.New("database schema is newer than GAN")
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	stdsql "database/sql"
+	stderrors "errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -11,11 +13,31 @@ import (
 	"github.com/AntonioBR9998/go-common/humamw"
 	"github.com/AntonioBR9998/go-common/sql"
 	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 )
 
 type MetricRepository interface {
-	GetMetrics(ctx context.Context) ([]*entity.Metric, error)
+	GetMetrics(ctx context.Context, from *int64, to *int64) ([]*entity.Metric, error)
+	GetMetricAggregates(ctx context.Context, query entity.MetricAggregateQuery) ([]*entity.MetricAggregate, error)
+	GetLatestMetrics(ctx context.Context) ([]*entity.Metric, error)
+	GetLatestMetric(ctx context.Context, sensorID string) (*entity.Metric, error)
+	OpenMetricCursor(ctx context.Context, query entity.MetricExportQuery) (MetricCursor, error)
+}
+
+// Rows fetched from the cursor of an export at once
+const METRIC_EXPORT_BATCH = 5000
+
+// MetricCursor reads the metrics of an export in batches, so the memory does not depend on the
+// size of the export
+type MetricCursor interface {
+	// It returns an empty batch when there are no more metrics
+	Next(ctx context.Context) ([]*entity.Metric, error)
+	Close() error
+}
+
+type metricCursor struct {
+	tx *stdsql.Tx
 }
 
 // Allowed fields to filter by in /GET metrics
@@ -30,12 +52,22 @@ var getMetricsOrderDef = map[string]string{
 	"timestamp": "timestamp",
 }
 
-func (r *repository) GetMetrics(ctx context.Context) ([]*entity.Metric, error) {
+func (r *repository) GetMetrics(ctx context.Context, from *int64, to *int64) ([]*entity.Metric, error) {
 	log.Debug("getting metrics in repository")
 
 	queryTemplate := GET_METRICS
 	args := []any{}
 
+	// Range predicates on the time column let TimescaleDB skip the chunks out of the range
+	if from != nil {
+		args = append(args, *from)
+		queryTemplate += fmt.Sprintf(" AND timestamp >= $%d", len(args))
+	}
+	if to != nil {
+		args = append(args, *to)
+		queryTemplate += fmt.Sprintf(" AND timestamp < $%d", len(args))
+	}
+
 	// Getting filters
 	filter, hasFilter := humamw.GetFilter(ctx)
 	if hasFilter {
@@ -82,7 +114,7 @@ func (r *repository) GetMetrics(ctx context.Context) ([]*entity.Metric, error) {
 	for rows.Next() {
 		var metric entity.Metric
 
-		if err := rows.Scan(&metric.SensorID, &metric.Value, &metric.Unit, &metric.Timestamp); err != nil {
+		if err := rows.Scan(&metric.SensorID, &metric.Value, &metric.Unit, &metric.Timestamp, &metric.OutOfRange); err != nil {
 			log.Errorln("Error scanning metrics table rows:", err)
 			return nil, errors.TrackError(err)
 		}
@@ -96,3 +128,186 @@ func (r *repository) GetMetrics(ctx context.Context) ([]*entity.Metric, error) {
 
 	return metricsData, nil
 }
+
+// Continuous aggregates of the metrics, from the coarsest to the finest
+var metricAggregateViews = []struct {
+	name   string
+	bucket int64
+}{
+	{name: "metrics_1d", bucket: 86400000},
+	{name: "metrics_1h", bucket: 3600000},
+	{name: "metrics_1m", bucket: 60000},
+}
+
+// Expression of every function over the raw metrics and over the continuous aggregates. Averages
+// of the aggregates are weighted with their samples
+var metricAggregateFns = map[string]struct{ raw, view string }{
+	entity.AVG_AGGREGATE:   {raw: "avg(value)", view: "sum(avg_value * samples) / sum(samples)"},
+	entity.MIN_AGGREGATE:   {raw: "min(value)", view: "min(min_value)"},
+	entity.MAX_AGGREGATE:   {raw: "max(value)", view: "max(max_value)"},
+	entity.COUNT_AGGREGATE: {raw: "count(*)", view: "sum(samples)"},
+}
+
+// This function chooses the table read by an aggregate query, its time column and the expression
+// of the function. The coarsest continuous aggregate whose buckets fit exactly in the requested
+// ones is read, and the raw metrics when there is none
+func metricAggregateSource(query entity.MetricAggregateQuery) (table, timeColumn, expr string, err error) {
+	fn, ok := metricAggregateFns[query.Fn]
+	if !ok {
+		return "", "", "", fmt.Errorf("unknown aggregate function %s", query.Fn)
+	}
+
+	for _, view := range metricAggregateViews {
+		if query.Bucket%view.bucket == 0 {
+			return view.name, "bucket", fn.view, nil
+		}
+	}
+
+	return "metrics", "timestamp", fn.raw, nil
+}
+
+// It returns the buckets of the metrics of a sensor
+func (r *repository) GetMetricAggregates(ctx context.Context, query entity.MetricAggregateQuery) ([]*entity.MetricAggregate, error) {
+	table, timeColumn, expr, err := metricAggregateSource(query)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("getting in repository the %s of the metrics of sensor %s from %s", query.Fn, query.SensorID, table)
+
+	sqlQuery := fmt.Sprintf(GET_METRIC_AGGREGATES, timeColumn, expr, table)
+	rows, err := r.timescaleDbClient.QueryContext(ctx, sqlQuery, query.Bucket, query.SensorID, query.From, query.To)
+	if err != nil {
+		log.Errorf("Error executing query: %s \n error: %v", sqlQuery, err)
+		return nil, errors.TrackError(err)
+	}
+	defer rows.Close()
+
+	var aggregates = []*entity.MetricAggregate{}
+	for rows.Next() {
+		var aggregate entity.MetricAggregate
+		if err := rows.Scan(&aggregate.Timestamp, &aggregate.Value); err != nil {
+			log.Errorln("Error scanning metric aggregates:", err)
+			return nil, errors.TrackError(err)
+		}
+
+		aggregates = append(aggregates, &aggregate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.TrackError(err)
+	}
+
+	return aggregates, nil
+}
+
+// It returns the latest metric of every sensor with metrics
+func (r *repository) GetLatestMetrics(ctx context.Context) ([]*entity.Metric, error) {
+	log.Debug("getting latest metrics in repository")
+
+	rows, err := r.timescaleDbClient.QueryContext(ctx, GET_LATEST_METRICS)
+	if err != nil {
+		log.Errorf("Error executing query: %s \n error: %v", GET_LATEST_METRICS, err)
+		return nil, errors.TrackError(err)
+	}
+	defer rows.Close()
+
+	var metricsData = []*entity.Metric{}
+	for rows.Next() {
+		var metric entity.Metric
+
+		if err := rows.Scan(&metric.SensorID, &metric.Value, &metric.Unit, &metric.Timestamp, &metric.OutOfRange); err != nil {
+			log.Errorln("Error scanning latest metrics:", err)
+			return nil, errors.TrackError(err)
+		}
+
+		metricsData = append(metricsData, &metric)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.TrackError(err)
+	}
+
+	return metricsData, nil
+}
+
+func (r *repository) GetLatestMetric(ctx context.Context, sensorID string) (*entity.Metric, error) {
+	log.Debugf("getting in repository the latest metric of sensor with ID: %s", sensorID)
+
+	errVars := map[string]any{"sensorId": sensorID}
+
+	var metric entity.Metric
+	err := r.timescaleDbClient.QueryRowContext(ctx, GET_LATEST_METRIC, sensorID).Scan(&metric.SensorID, &metric.Value,
+		&metric.Unit, &metric.Timestamp, &metric.OutOfRange)
+
+	if stderrors.Is(err, stdsql.ErrNoRows) {
+		return nil, ErrMetricNotFound
+	}
+	if err != nil {
+		return nil, errors.TrackErrorVar(err, errVars)
+	}
+
+	return &metric, nil
+}
+
+// This function declares a cursor over the metrics of an export in a read only transaction. The
+// cursor must be closed to end the transaction
+func (r *repository) OpenMetricCursor(ctx context.Context, query entity.MetricExportQuery) (MetricCursor, error) {
+	log.Debug("opening metric export cursor in repository")
+
+	predicates := ""
+	args := []any{}
+	if len(query.SensorIDs) > 0 {
+		args = append(args, pq.Array(query.SensorIDs))
+		predicates += fmt.Sprintf(" AND sensor_id = ANY($%d)", len(args))
+	}
+	if query.From != nil {
+		args = append(args, *query.From)
+		predicates += fmt.Sprintf(" AND timestamp >= $%d", len(args))
+	}
+	if query.To != nil {
+		args = append(args, *query.To)
+		predicates += fmt.Sprintf(" AND timestamp < $%d", len(args))
+	}
+
+	tx, err := r.timescaleDbClient.BeginTx(ctx, &stdsql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, errors.TrackError(err)
+	}
+
+	sqlQuery := fmt.Sprintf(DECLARE_METRIC_EXPORT_CURSOR, predicates)
+	if _, err := tx.ExecContext(ctx, sqlQuery, args...); err != nil {
+		tx.Rollback()
+		log.Errorf("Error executing query: %s \n error: %v", sqlQuery, err)
+		return nil, errors.TrackError(err)
+	}
+
+	return &metricCursor{tx: tx}, nil
+}
+
+func (c *metricCursor) Next(ctx context.Context) ([]*entity.Metric, error) {
+	rows, err := c.tx.QueryContext(ctx, fmt.Sprintf(FETCH_METRIC_EXPORT, METRIC_EXPORT_BATCH))
+	if err != nil {
+		return nil, errors.TrackError(err)
+	}
+	defer rows.Close()
+
+	metricsData := make([]*entity.Metric, 0, METRIC_EXPORT_BATCH)
+	for rows.Next() {
+		var metric entity.Metric
+
+		if err := rows.Scan(&metric.SensorID, &metric.Value, &metric.Unit, &metric.Timestamp, &metric.OutOfRange); err != nil {
+			log.Errorln("Error scanning metrics table rows:", err)
+			return nil, errors.TrackError(err)
+		}
+
+		metricsData = append(metricsData, &metric)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.TrackError(err)
+	}
+
+	return metricsData, nil
+}
+
+// The transaction only reads, so it is rolled back, which also closes the cursor
+func (c *metricCursor) Close() error {
+	return c.tx.Rollback()
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+func TestMetricAggregateSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		fn         string
+		bucket     int64
+		wantTable  string
+		wantColumn string
+		wantExpr   string
+		wantErr    bool
+	}{
+		{name: "second buckets", fn: entity.AVG_AGGREGATE, bucket: 1000,
+			wantTable: "metrics", wantColumn: "timestamp", wantExpr: "avg(value)"},
+		{name: "buckets not aligned to minutes", fn: entity.MAX_AGGREGATE, bucket: 90000,
+			wantTable: "metrics", wantColumn: "timestamp", wantExpr: "max(value)"},
+		{name: "minute buckets", fn: entity.AVG_AGGREGATE, bucket: 60000,
+			wantTable: "metrics_1m", wantColumn: "bucket", wantExpr: "sum(avg_value * samples) / sum(samples)"},
+		{name: "five minute buckets", fn: entity.MIN_AGGREGATE, bucket: 300000,
+			wantTable: "metrics_1m", wantColumn: "bucket", wantExpr: "min(min_value)"},
+		{name: "hour buckets", fn: entity.COUNT_AGGREGATE, bucket: 3600000,
+			wantTable: "metrics_1h", wantColumn: "bucket", wantExpr: "sum(samples)"},
+		{name: "six hour buckets", fn: entity.MAX_AGGREGATE, bucket: 21600000,
+			wantTable: "metrics_1h", wantColumn: "bucket", wantExpr: "max(max_value)"},
+		{name: "day buckets", fn: entity.AVG_AGGREGATE, bucket: 86400000,
+			wantTable: "metrics_1d", wantColumn: "bucket", wantExpr: "sum(avg_value * samples) / sum(samples)"},
+		{name: "week buckets", fn: entity.COUNT_AGGREGATE, bucket: 604800000,
+			wantTable: "metrics_1d", wantColumn: "bucket", wantExpr: "sum(samples)"},
+		{name: "unknown function", fn: "median", bucket: 60000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, column, expr, err := metricAggregateSource(entity.MetricAggregateQuery{Fn: tt.fn, Bucket: tt.bucket})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("metricAggregateSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if table != tt.wantTable || column != tt.wantColumn || expr != tt.wantExpr {
+				t.Errorf("metricAggregateSource() = %s, %s, %s, want %s, %s, %s",
+					table, column, expr, tt.wantTable, tt.wantColumn, tt.wantExpr)
+			}
+		})
+	}
+}
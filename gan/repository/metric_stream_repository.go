@@ -0,0 +1,47 @@
+// Live metrics published by the sensors in NATS
+
+package repository
+
+import (
+	"encoding/json"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+type MetricStreamRepository interface {
+	SubscribeMetrics(handler func(metric *entity.Metric)) (func(), error)
+}
+
+type metricStreamRepository struct {
+	nc      *nats.Conn
+	subject string
+}
+
+// NewMetricStreamRepository reads the metrics published in the subjects matching the given filter
+func NewMetricStreamRepository(nc *nats.Conn, subject string) MetricStreamRepository {
+	return &metricStreamRepository{nc: nc, subject: subject}
+}
+
+// This function calls the handler with every metric published from now on, in the goroutine of
+// the subscription, so the handler must not block. It returns the function which unsubscribes
+func (r *metricStreamRepository) SubscribeMetrics(handler func(metric *entity.Metric)) (func(), error) {
+	sub, err := r.nc.Subscribe(r.subject, func(msg *nats.Msg) {
+		metric := &entity.Metric{}
+		if err := json.Unmarshal(msg.Data, metric); err != nil || metric.SensorID == "" {
+			log.Debugf("skipping invalid metric in subject %s", msg.Subject)
+			return
+		}
+		handler(metric)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := sub.Unsubscribe(); err != nil {
+			log.Warnf("error unsubscribing from %s: %v", r.subject, err)
+		}
+	}, nil
+}
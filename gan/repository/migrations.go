@@ -0,0 +1,324 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Migrations are embedded in the binary. Every version has a NNNN_name.up.sql file and a
+// NNNN_name.down.sql file which undoes it. Files starting with a NO_TRANSACTION line run outside a
+// transaction, one statement at a time, for statements such as the creation of continuous
+// aggregates. Their statements end with a semicolon at the end of a line and should be idempotent
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	MIGRATIONS_TABLE = "schema_migrations"
+	// Key of the advisory lock which keeps two GAN instances from migrating at once
+	MIGRATIONS_LOCK = 7262810
+	NO_TRANSACTION  = "-- no-transaction"
+)
+
+const CREATE_MIGRATIONS_TABLE = `
+	CREATE TABLE IF NOT EXISTS ` + MIGRATIONS_TABLE + ` (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`
+
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	// UNIX seconds. Nil if the migration is pending
+	AppliedAt *int64
+}
+
+// This function returns the embedded migrations sorted by version
+func Migrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		name := path.Base(file)
+		direction := ""
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s must end with .up.sql or .down.sql", name)
+		}
+
+		prefix, rest, ok := strings.Cut(strings.TrimSuffix(name, "."+direction+".sql"), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must start with its version, like 0001_name", name)
+		}
+
+		content, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: rest}
+			byVersion[version] = migration
+		}
+		if migration.Name != rest {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, rest)
+		}
+		if direction == "up" {
+			migration.up = string(content)
+		} else {
+			migration.down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %d needs an up and a down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// This function applies the pending migrations, each one in its own transaction. It returns the
+// applied ones
+func MigrateUp(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.ExecContext(ctx, CREATE_MIGRATIONS_TABLE); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range migrations {
+		done, err := runMigration(ctx, db, migration, true)
+		if err != nil {
+			return applied, fmt.Errorf("error applying migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if done {
+			log.Infof("migration %d_%s applied", migration.Version, migration.Name)
+			applied = append(applied, migration)
+		}
+	}
+
+	return applied, nil
+}
+
+// This function undoes the last steps applied migrations. It returns the undone ones
+func MigrateDown(ctx context.Context, db *sql.DB, steps int) ([]Migration, error) {
+	statusList, err := GetMigrationStatus(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var undone []Migration
+	for i := len(statusList) - 1; i >= 0 && len(undone) < steps; i-- {
+		if statusList[i].AppliedAt == nil {
+			continue
+		}
+
+		migration := statusList[i].Migration
+		done, err := runMigration(ctx, db, migration, false)
+		if err != nil {
+			return undone, fmt.Errorf("error undoing migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if done {
+			log.Infof("migration %d_%s undone", migration.Version, migration.Name)
+			undone = append(undone, migration)
+		}
+	}
+
+	return undone, nil
+}
+
+// This function applies or undoes a migration and records it. Another instance may have done it
+// while waiting for the lock, in which case it returns false
+func runMigration(ctx context.Context, db *sql.DB, migration Migration, up bool) (bool, error) {
+	// The lock belongs to the session, so every statement must use the same connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", MIGRATIONS_LOCK); err != nil {
+		return false, err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", MIGRATIONS_LOCK)
+
+	var applied bool
+	err = conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+MIGRATIONS_TABLE+" WHERE version = $1)",
+		migration.Version).Scan(&applied)
+	if err != nil {
+		return false, err
+	}
+	if applied == up {
+		return false, nil
+	}
+
+	script := migration.down
+	record := "DELETE FROM " + MIGRATIONS_TABLE + " WHERE version = $1"
+	args := []any{migration.Version}
+	if up {
+		script = migration.up
+		record = "INSERT INTO " + MIGRATIONS_TABLE + " (version, name, applied_at) VALUES ($1, $2, $3)"
+		args = append(args, migration.Name, time.Now().Unix())
+	}
+
+	if strings.HasPrefix(script, NO_TRANSACTION) {
+		for _, statement := range splitStatements(script) {
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				return false, err
+			}
+		}
+		_, err = conn.ExecContext(ctx, record, args...)
+		return err == nil, err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// This function splits a script into statements ending with a semicolon at the end of a line
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			if statement := strings.TrimSpace(current.String()); statement != "" {
+				statements = append(statements, statement)
+			}
+			current.Reset()
+		}
+	}
+	if statement := strings.TrimSpace(current.String()); statement != "" && !isComment(statement) {
+		statements = append(statements, statement)
+	}
+
+	return statements
+}
+
+// This function tells whether a piece of script only has comments
+func isComment(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// This function returns every embedded migration and when it was applied
+func GetMigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.ExecContext(ctx, CREATE_MIGRATIONS_TABLE); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version, applied_at FROM "+MIGRATIONS_TABLE)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int64]int64)
+	for rows.Next() {
+		var version, at int64
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statusList := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Migration: migration}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+			delete(appliedAt, migration.Version)
+		}
+		statusList = append(statusList, status)
+	}
+
+	// Versions applied by a newer GAN
+	if len(appliedAt) > 0 {
+		return statusList, fmt.Errorf("%w: %d applied migrations are unknown to this GAN version", ErrSchemaTooNew, len(appliedAt))
+	}
+
+	return statusList, nil
+}
+
+// This function checks that every embedded migration is applied, so GAN does not run against an
+// outdated schema
+func CheckSchemaVersion(ctx context.Context, db *sql.DB) error {
+	statusList, err := GetMigrationStatus(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	pending := 0
+	for _, status := range statusList {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d pending migrations. Run 'gan migrate up'", ErrSchemaOutdated, pending)
+	}
+
+	return nil
+}
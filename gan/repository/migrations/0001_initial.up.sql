@@ -0,0 +1,28 @@
+-- Schema created by the first version of setup.sh. Existing databases are adopted as they are and
+-- brought up to date by the next migrations, which add what every later version added. The
+-- metrics table becomes a hypertable in 0007, since integer time columns need a chunk interval
+-- and the first setup.sh did not give one
+CREATE EXTENSION IF NOT EXISTS timescaledb CASCADE;
+
+DO $$ BEGIN
+    CREATE TYPE device_type AS ENUM ('humidity', 'temperature', 'pressure');
+EXCEPTION
+    WHEN duplicate_object THEN NULL;
+END $$;
+
+CREATE TABLE IF NOT EXISTS devices (
+    id UUID PRIMARY KEY,
+    type device_type NOT NULL,
+    alias TEXT NOT NULL,
+    rate INTEGER NOT NULL,
+    max_threshold INTEGER NOT NULL,
+    min_threshold INTEGER NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS metrics (
+    sensor_id UUID NOT NULL,
+    value REAL NOT NULL,
+    unit TEXT NOT NULL,
+    timestamp BIGINT NOT NULL
+);
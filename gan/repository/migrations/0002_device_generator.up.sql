@@ -0,0 +1,3 @@
+-- Generator of the values of every sensor. Existing sensors keep drawing uniform values
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS generator JSONB NOT NULL DEFAULT '{"type": "uniform"}';
+ALTER TABLE devices ALTER COLUMN generator DROP DEFAULT;
@@ -0,0 +1,2 @@
+-- Seed of the random values of a sensor. Null uses the seed of the simulator
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS seed BIGINT;
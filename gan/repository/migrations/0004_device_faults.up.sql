@@ -0,0 +1,3 @@
+-- Fault profile of every sensor. Existing sensors have no faults
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS faults JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE devices ALTER COLUMN faults DROP DEFAULT;
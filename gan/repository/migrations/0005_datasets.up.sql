@@ -0,0 +1,11 @@
+-- Uploaded datasets, and the dataset replayed by a sensor instead of a generator
+CREATE TABLE IF NOT EXISTS datasets (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    format TEXT NOT NULL,
+    samples INTEGER NOT NULL,
+    content BYTEA NOT NULL,
+    created_at BIGINT NOT NULL
+);
+
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS replay JSONB;
@@ -0,0 +1 @@
+ALTER TABLE devices DROP COLUMN IF EXISTS threshold_crossing_rate;
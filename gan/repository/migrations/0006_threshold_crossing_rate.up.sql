@@ -0,0 +1,2 @@
+-- Share of the values out of the thresholds. Null leaves the values of the generator as they are
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS threshold_crossing_rate DOUBLE PRECISION;
@@ -0,0 +1,21 @@
+-- Rates are rounded up to whole seconds and metrics lose their milliseconds
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS rate INTEGER;
+UPDATE devices SET rate = GREATEST(1, CEIL(rate_ns / 1000000000.0));
+ALTER TABLE devices ALTER COLUMN rate SET NOT NULL;
+ALTER TABLE devices DROP COLUMN IF EXISTS rate_ns;
+ALTER TABLE devices DROP COLUMN IF EXISTS jitter_ns;
+
+ALTER INDEX IF EXISTS metrics_timestamp_idx RENAME TO metrics_milliseconds_timestamp_idx;
+ALTER TABLE metrics RENAME TO metrics_milliseconds;
+
+CREATE TABLE metrics (
+    sensor_id UUID NOT NULL,
+    value REAL NOT NULL,
+    unit TEXT NOT NULL,
+    timestamp BIGINT NOT NULL
+);
+SELECT create_hypertable('metrics', 'timestamp', chunk_time_interval => 604800);
+
+INSERT INTO metrics (sensor_id, value, unit, timestamp)
+    SELECT sensor_id, value, unit, timestamp / 1000 FROM metrics_milliseconds;
+DROP TABLE metrics_milliseconds;
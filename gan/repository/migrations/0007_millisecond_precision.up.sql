@@ -0,0 +1,38 @@
+-- Rates were whole seconds and are nanoseconds, with a jitter, so sensors can sample faster than
+-- once per second. Metrics were stamped with UNIX seconds and are stamped with UNIX milliseconds
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS rate_ns BIGINT;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS jitter_ns BIGINT NOT NULL DEFAULT 0;
+
+DO $$ BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'devices' AND column_name = 'rate') THEN
+        UPDATE devices SET rate_ns = rate::BIGINT * 1000000000;
+        ALTER TABLE devices DROP COLUMN rate;
+    END IF;
+END $$;
+
+ALTER TABLE devices ALTER COLUMN rate_ns SET NOT NULL;
+
+-- Metrics stamped with milliseconds are in a hypertable with chunks of one day. Metrics stamped
+-- with seconds are in a plain table, or in a hypertable with another chunk interval. Rows cannot
+-- move between chunks, so the table is written again
+DO $$ BEGIN
+    IF (SELECT integer_interval FROM timescaledb_information.dimensions
+        WHERE hypertable_schema = current_schema() AND hypertable_name = 'metrics'
+            AND column_name = 'timestamp') IS DISTINCT FROM 86400000 THEN
+        ALTER INDEX IF EXISTS metrics_timestamp_idx RENAME TO metrics_seconds_timestamp_idx;
+        ALTER TABLE metrics RENAME TO metrics_seconds;
+
+        CREATE TABLE metrics (
+            sensor_id UUID NOT NULL,
+            value REAL NOT NULL,
+            unit TEXT NOT NULL,
+            timestamp BIGINT NOT NULL
+        );
+        PERFORM create_hypertable('metrics', 'timestamp', chunk_time_interval => 86400000);
+
+        INSERT INTO metrics (sensor_id, value, unit, timestamp)
+            SELECT sensor_id, value, unit, timestamp * 1000 FROM metrics_seconds;
+        DROP TABLE metrics_seconds;
+    END IF;
+END $$;
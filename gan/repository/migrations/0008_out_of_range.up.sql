@@ -0,0 +1,2 @@
+-- Set by NTA when the value is out of the thresholds of the sensor
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS out_of_range BOOLEAN NOT NULL DEFAULT FALSE;
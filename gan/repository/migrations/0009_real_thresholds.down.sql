@@ -0,0 +1,3 @@
+ALTER TABLE devices
+    ALTER COLUMN max_threshold TYPE INTEGER USING ROUND(max_threshold),
+    ALTER COLUMN min_threshold TYPE INTEGER USING ROUND(min_threshold);
@@ -0,0 +1,4 @@
+-- Thresholds are float32 in GAN, so decimal thresholds were rejected by the database
+ALTER TABLE devices
+    ALTER COLUMN max_threshold TYPE REAL,
+    ALTER COLUMN min_threshold TYPE REAL;
@@ -0,0 +1,6 @@
+-- Retention of the metrics. The default scope applies to the sensor types without their own
+CREATE TABLE IF NOT EXISTS retention_policies (
+    scope TEXT PRIMARY KEY,
+    retention_ns BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL
+);
@@ -0,0 +1,14 @@
+-- no-transaction
+DROP MATERIALIZED VIEW IF EXISTS metrics_1d;
+DROP MATERIALIZED VIEW IF EXISTS metrics_1h;
+DROP MATERIALIZED VIEW IF EXISTS metrics_1m;
+
+-- TimescaleDB has no function to unset the integer now function, so it is removed from the catalog
+UPDATE _timescaledb_catalog.dimension
+SET integer_now_func_schema = NULL, integer_now_func = NULL
+WHERE hypertable_id = (
+    SELECT id FROM _timescaledb_catalog.hypertable
+    WHERE schema_name = current_schema() AND table_name = 'metrics'
+);
+
+DROP FUNCTION IF EXISTS metrics_now();
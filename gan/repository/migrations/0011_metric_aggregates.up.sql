@@ -0,0 +1,67 @@
+-- no-transaction
+-- Continuous aggregates of the metrics by minute, hour and day. Recent buckets which are not
+-- materialized yet are computed from the raw metrics, so queries are always up to date
+
+-- Timestamps are UNIX milliseconds, so TimescaleDB needs to know the current one
+CREATE OR REPLACE FUNCTION metrics_now() RETURNS BIGINT
+    LANGUAGE SQL STABLE AS $$ SELECT (EXTRACT(EPOCH FROM now()) * 1000)::BIGINT $$;
+
+SELECT set_integer_now_func('metrics', 'metrics_now', replace_if_exists => TRUE);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS metrics_1m
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    sensor_id,
+    time_bucket(60000::BIGINT, timestamp) AS bucket,
+    avg(value) AS avg_value,
+    min(value) AS min_value,
+    max(value) AS max_value,
+    count(*) AS samples
+FROM metrics
+GROUP BY sensor_id, bucket
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS metrics_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    sensor_id,
+    time_bucket(3600000::BIGINT, timestamp) AS bucket,
+    avg(value) AS avg_value,
+    min(value) AS min_value,
+    max(value) AS max_value,
+    count(*) AS samples
+FROM metrics
+GROUP BY sensor_id, bucket
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS metrics_1d
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    sensor_id,
+    time_bucket(86400000::BIGINT, timestamp) AS bucket,
+    avg(value) AS avg_value,
+    min(value) AS min_value,
+    max(value) AS max_value,
+    count(*) AS samples
+FROM metrics
+GROUP BY sensor_id, bucket
+WITH NO DATA;
+
+-- Offsets in milliseconds. Buckets are refreshed while they are newer than the start offset, so
+-- the aggregates keep the metrics deleted by the retention policies
+SELECT add_continuous_aggregate_policy('metrics_1m',
+    start_offset => 86400000::BIGINT, end_offset => 60000::BIGINT,
+    schedule_interval => INTERVAL '1 minute', if_not_exists => TRUE);
+
+SELECT add_continuous_aggregate_policy('metrics_1h',
+    start_offset => 604800000::BIGINT, end_offset => 3600000::BIGINT,
+    schedule_interval => INTERVAL '30 minutes', if_not_exists => TRUE);
+
+SELECT add_continuous_aggregate_policy('metrics_1d',
+    start_offset => 7776000000::BIGINT, end_offset => 86400000::BIGINT,
+    schedule_interval => INTERVAL '1 hour', if_not_exists => TRUE);
+
+-- Histories written before the aggregates existed
+CALL refresh_continuous_aggregate('metrics_1m', NULL, NULL);
+CALL refresh_continuous_aggregate('metrics_1h', NULL, NULL);
+CALL refresh_continuous_aggregate('metrics_1d', NULL, NULL);
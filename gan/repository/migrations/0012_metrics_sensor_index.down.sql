@@ -0,0 +1 @@
+DROP INDEX IF EXISTS metrics_sensor_id_timestamp_idx;
@@ -0,0 +1,2 @@
+-- Queries of a sensor within a time range. The hypertable already indexes the time column
+CREATE INDEX IF NOT EXISTS metrics_sensor_id_timestamp_idx ON metrics (sensor_id, timestamp DESC);
@@ -0,0 +1,2 @@
+-- Version of every sensor, increased by every update, for optimistic concurrency
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
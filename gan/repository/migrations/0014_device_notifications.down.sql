@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS devices_changed ON devices;
+DROP FUNCTION IF EXISTS notify_devices_changed();
@@ -0,0 +1,12 @@
+-- Every change of the devices table is notified in the devices_changed channel, so NTA reloads
+-- the thresholds of the sensors at once. Notifications are sent when the transaction commits
+CREATE OR REPLACE FUNCTION notify_devices_changed() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('devices_changed', '');
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS devices_changed ON devices;
+CREATE TRIGGER devices_changed AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON devices
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_devices_changed();
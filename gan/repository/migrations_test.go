@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() error = %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("Migrations() returned no migrations")
+	}
+
+	for i, migration := range migrations {
+		// Versions are never skipped, so a missing file is noticed
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %d_%s has version %d, want %d", migration.Version, migration.Name, migration.Version, i+1)
+		}
+		if strings.HasPrefix(migration.up, NO_TRANSACTION) != strings.HasPrefix(migration.down, NO_TRANSACTION) {
+			t.Errorf("migration %d_%s runs up and down in different modes", migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{name: "empty", script: "", want: nil},
+		{name: "only comments", script: "-- no-transaction\n-- nothing to do\n", want: nil},
+		{
+			name:   "single line statements",
+			script: "CREATE TABLE a (id INT);\nDROP TABLE b;\n",
+			want:   []string{"CREATE TABLE a (id INT);", "DROP TABLE b;"},
+		},
+		{
+			name:   "comments go with the next statement",
+			script: "-- no-transaction\n-- first\nSELECT 1;\n\n-- second\nSELECT 2;",
+			want:   []string{"-- no-transaction\n-- first\nSELECT 1;", "-- second\nSELECT 2;"},
+		},
+		{
+			name:   "multiline statement",
+			script: "CREATE VIEW v AS\nSELECT x\nFROM t;\nSELECT 1;\n",
+			want:   []string{"CREATE VIEW v AS\nSELECT x\nFROM t;", "SELECT 1;"},
+		},
+		{
+			name:   "semicolons within a line",
+			script: "CREATE FUNCTION f() RETURNS INT LANGUAGE SQL AS $$ SELECT 1; $$;\n",
+			want:   []string{"CREATE FUNCTION f() RETURNS INT LANGUAGE SQL AS $$ SELECT 1; $$;"},
+		},
+		{
+			name:   "statement without semicolon",
+			script: "SELECT 1;\nSELECT 2\n",
+			want:   []string{"SELECT 1;", "SELECT 2"},
+		},
+		{
+			name:   "trailing comment",
+			script: "SELECT 1;\n-- done\n",
+			want:   []string{"SELECT 1;"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.script)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
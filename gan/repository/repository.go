@@ -15,6 +15,8 @@ import (
 type Repository interface {
 	MetricRepository
 	SensorRepository
+	DatasetRepository
+	RetentionRepository
 }
 
 type repository struct {
@@ -0,0 +1,134 @@
+// Retention policies and cleanup of the metrics in TimescaleDB
+
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/AntonioBR9998/go-common/errors"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	RETENTION_RESOURCE_TYPE = "retention policy"
+	// Scope of the default retention in the retention_policies table
+	DEFAULT_RETENTION_SCOPE = "default"
+)
+
+type RetentionRepository interface {
+	GetRetentionPolicy(ctx context.Context) (*entity.RetentionPolicy, error)
+	SetRetentionPolicy(ctx context.Context, policy *entity.RetentionPolicy) error
+	DropMetricChunks(ctx context.Context, olderThan int64) (int, error)
+	DeleteMetricsOfType(ctx context.Context, typ string, olderThan int64) (int64, error)
+	DeleteMetricsExceptTypes(ctx context.Context, types []string, olderThan int64) (int64, error)
+}
+
+func (r *repository) GetRetentionPolicy(ctx context.Context) (*entity.RetentionPolicy, error) {
+	log.Debug("getting in repository the retention policy")
+
+	rows, err := r.timescaleDbClient.QueryContext(ctx, GET_RETENTION_POLICIES)
+	if err != nil {
+		return nil, errors.WrapPostgresErrorCode(err, RETENTION_RESOURCE_TYPE, "")
+	}
+	defer rows.Close()
+
+	policy := &entity.RetentionPolicy{Types: make(map[string]time.Duration)}
+	for rows.Next() {
+		var scope string
+		var retention, updatedAt int64
+		if err := rows.Scan(&scope, &retention, &updatedAt); err != nil {
+			return nil, errors.WrapPostgresErrorCode(err, RETENTION_RESOURCE_TYPE, "")
+		}
+
+		if scope == DEFAULT_RETENTION_SCOPE {
+			d := time.Duration(retention)
+			policy.Default = &d
+		} else {
+			policy.Types[scope] = time.Duration(retention)
+		}
+		policy.UpdatedAt = max(policy.UpdatedAt, updatedAt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WrapPostgresErrorCode(err, RETENTION_RESOURCE_TYPE, "")
+	}
+
+	return policy, nil
+}
+
+// The policy replaces the stored one
+func (r *repository) SetRetentionPolicy(ctx context.Context, policy *entity.RetentionPolicy) error {
+	log.Debug("writing in repository the retention policy")
+
+	tx, err := r.timescaleDbClient.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WrapPostgresErrorCode(err, RETENTION_RESOURCE_TYPE, "")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, DELETE_RETENTION_POLICIES); err != nil {
+		return errors.WrapPostgresErrorCode(err, RETENTION_RESOURCE_TYPE, "")
+	}
+
+	scopes := make(map[string]time.Duration, len(policy.Types)+1)
+	for typ, retention := range policy.Types {
+		scopes[typ] = retention
+	}
+	if policy.Default != nil {
+		scopes[DEFAULT_RETENTION_SCOPE] = *policy.Default
+	}
+
+	for scope, retention := range scopes {
+		_, err := tx.ExecContext(ctx, INSERT_RETENTION_POLICY, scope, int64(retention), policy.UpdatedAt)
+		if err != nil {
+			err := errors.WrapPostgresErrorCode(err, RETENTION_RESOURCE_TYPE, scope)
+			return errors.TrackErrorVar(err, map[string]any{"scope": scope})
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.WrapPostgresErrorCode(err, RETENTION_RESOURCE_TYPE, "")
+	}
+
+	return nil
+}
+
+// It drops the chunks of the metrics hypertable whose samples are older than the given UNIX
+// milliseconds, and returns how many were dropped
+func (r *repository) DropMetricChunks(ctx context.Context, olderThan int64) (int, error) {
+	log.Debugf("dropping in repository the metric chunks older than %d", olderThan)
+
+	var dropped int
+	err := r.timescaleDbClient.QueryRowContext(ctx, DROP_METRIC_CHUNKS, olderThan).Scan(&dropped)
+	if err != nil {
+		return 0, errors.WrapPostgresErrorCode(err, RETENTION_RESOURCE_TYPE, "")
+	}
+
+	return dropped, nil
+}
+
+func (r *repository) DeleteMetricsOfType(ctx context.Context, typ string, olderThan int64) (int64, error) {
+	log.Debugf("deleting in repository the %s metrics older than %d", typ, olderThan)
+
+	res, err := r.timescaleDbClient.ExecContext(ctx, DELETE_METRICS_OF_TYPE, typ, olderThan)
+	if err != nil {
+		return 0, errors.WrapPostgresErrorCode(err, RETENTION_RESOURCE_TYPE, typ)
+	}
+
+	return res.RowsAffected()
+}
+
+// It deletes the metrics older than the given UNIX milliseconds of every sensor whose type is
+// not in types, including the sensors which no longer exist
+func (r *repository) DeleteMetricsExceptTypes(ctx context.Context, types []string, olderThan int64) (int64, error) {
+	log.Debugf("deleting in repository the metrics older than %d except %v", olderThan, types)
+
+	res, err := r.timescaleDbClient.ExecContext(ctx, DELETE_METRICS_EXCEPT_TYPES, olderThan, pq.Array(types))
+	if err != nil {
+		return 0, errors.WrapPostgresErrorCode(err, RETENTION_RESOURCE_TYPE, "")
+	}
+
+	return res.RowsAffected()
+}
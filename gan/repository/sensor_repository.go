@@ -4,6 +4,8 @@ package repository
 
 import (
 	"context"
+	stdsql "database/sql"
+	stderrors "errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -21,6 +23,8 @@ const SENSOR_RESOURCE_TYPE = "sensor"
 type SensorRepository interface {
 	CreateSensor(ctx context.Context, sensor *entity.Sensor) error
 	ModifySensor(ctx context.Context, sensor *entity.Sensor) error
+	UpdateSensorFaults(ctx context.Context, id string, faults entity.FaultProfile, updatedAt int64, version int64) (int64, error)
+	GetSensor(ctx context.Context, id string) (*entity.Sensor, error)
 	GetSensors(ctx context.Context) ([]*entity.Sensor, error)
 	DeleteSensor(ctx context.Context, id string) error
 }
@@ -37,9 +41,16 @@ func (r *repository) CreateSensor(ctx context.Context, sensor *entity.Sensor) er
 		sensor.Type,
 		sensor.Alias,
 		sensor.Rate,
+		sensor.Jitter,
 		sensor.MaxThreshold,
 		sensor.MinThreshold,
+		sensor.Generator,
+		sensor.ThresholdCrossingRate,
+		sensor.Seed,
+		sensor.Faults,
+		sensor.Replay,
 		sensor.UpdatedAt,
+		sensor.Version,
 	)
 
 	if err != nil {
@@ -50,31 +61,108 @@ func (r *repository) CreateSensor(ctx context.Context, sensor *entity.Sensor) er
 	return nil
 }
 
+// The sensor is only updated if its stored version is the version of the given sensor, unless
+// it is 0. The version of the given sensor is set to the new one
 func (r *repository) ModifySensor(ctx context.Context, sensor *entity.Sensor) error {
 	log.Debugf("updating in repository devices table the sensor with ID: %s", sensor.ID)
 
-	errVars := map[string]any{"id": sensor.ID, "alias": sensor.Alias}
+	errVars := map[string]any{"id": sensor.ID, "alias": sensor.Alias, "version": sensor.Version}
 
 	// Updating in TimescaleDB
-	_, err := r.timescaleDbClient.Exec(
+	var version int64
+	err := r.timescaleDbClient.QueryRow(
 		REPLACE_SENSOR,
 		sensor.ID,
 		sensor.Type,
 		sensor.Alias,
 		sensor.Rate,
+		sensor.Jitter,
 		sensor.MaxThreshold,
 		sensor.MinThreshold,
+		sensor.Generator,
+		sensor.ThresholdCrossingRate,
+		sensor.Seed,
+		sensor.Faults,
+		sensor.Replay,
 		sensor.UpdatedAt,
-	)
-
+		sensor.Version,
+	).Scan(&version)
+
+	// Nothing has been updated, because the sensor does not exist or has another version
+	if stderrors.Is(err, stdsql.ErrNoRows) {
+		err = r.timescaleDbClient.QueryRow(GET_SENSOR_VERSION, sensor.ID).Scan(&version)
+		if stderrors.Is(err, stdsql.ErrNoRows) {
+			return ErrSensorNotFound
+		}
+		if err == nil {
+			return ErrVersionConflict
+		}
+	}
 	if err != nil {
 		err := errors.WrapPostgresErrorCode(err, SENSOR_RESOURCE_TYPE, sensor.ID)
 		return errors.TrackErrorVar(err, errVars)
 	}
 
+	sensor.Version = version
 	return nil
 }
 
+// The faults are only updated if the stored version of the sensor is the given one, unless it is 0.
+// It returns the new version of the sensor
+func (r *repository) UpdateSensorFaults(ctx context.Context, id string, faults entity.FaultProfile, updatedAt int64,
+	version int64) (int64, error) {
+	log.Debugf("updating in repository devices table the faults of sensor with ID: %s", id)
+
+	errVars := map[string]any{"id": id, "version": version}
+
+	// Updating in TimescaleDB
+	err := r.timescaleDbClient.QueryRow(
+		UPDATE_SENSOR_FAULTS,
+		id,
+		faults,
+		updatedAt,
+		version,
+	).Scan(&version)
+
+	// Nothing has been updated, because the sensor does not exist or has another version
+	if stderrors.Is(err, stdsql.ErrNoRows) {
+		err = r.timescaleDbClient.QueryRow(GET_SENSOR_VERSION, id).Scan(&version)
+		if stderrors.Is(err, stdsql.ErrNoRows) {
+			return 0, ErrSensorNotFound
+		}
+		if err == nil {
+			return 0, ErrVersionConflict
+		}
+	}
+	if err != nil {
+		err := errors.WrapPostgresErrorCode(err, SENSOR_RESOURCE_TYPE, id)
+		return 0, errors.TrackErrorVar(err, errVars)
+	}
+
+	return version, nil
+}
+
+func (r *repository) GetSensor(ctx context.Context, id string) (*entity.Sensor, error) {
+	log.Debugf("getting in repository the sensor with ID: %s", id)
+
+	errVars := map[string]any{"id": id}
+
+	var sensor entity.Sensor
+	err := r.timescaleDbClient.QueryRow(GET_SENSOR, id).Scan(&sensor.ID, &sensor.Type, &sensor.Alias, &sensor.Rate,
+		&sensor.Jitter, &sensor.MaxThreshold, &sensor.MinThreshold, &sensor.Generator, &sensor.ThresholdCrossingRate,
+		&sensor.Seed, &sensor.Faults, &sensor.Replay, &sensor.UpdatedAt, &sensor.Version)
+
+	if stderrors.Is(err, stdsql.ErrNoRows) {
+		return nil, ErrSensorNotFound
+	}
+	if err != nil {
+		err := errors.WrapPostgresErrorCode(err, SENSOR_RESOURCE_TYPE, id)
+		return nil, errors.TrackErrorVar(err, errVars)
+	}
+
+	return &sensor, nil
+}
+
 // Allowed fields to filter by in /GET sensors
 var getSensorsWhereDef = map[string]string{
 	"id":    "id",
@@ -142,8 +230,8 @@ func (r *repository) GetSensors(ctx context.Context) ([]*entity.Sensor, error) {
 	for rows.Next() {
 		var sensor entity.Sensor
 
-		if err := rows.Scan(&sensor.ID, &sensor.Type, &sensor.Alias, &sensor.Rate,
-			&sensor.MaxThreshold, &sensor.MinThreshold, &sensor.UpdatedAt); err != nil {
+		if err := rows.Scan(&sensor.ID, &sensor.Type, &sensor.Alias, &sensor.Rate, &sensor.Jitter,
+			&sensor.MaxThreshold, &sensor.MinThreshold, &sensor.Generator, &sensor.ThresholdCrossingRate, &sensor.Seed, &sensor.Faults, &sensor.Replay, &sensor.UpdatedAt, &sensor.Version); err != nil {
 			log.Errorln("Error scanning devices table rows:", err)
 			return nil, errors.TrackError(err)
 		}
@@ -165,7 +253,7 @@ func (r *repository) DeleteSensor(ctx context.Context, id string) error {
 	errVars := map[string]any{"id": id}
 
 	// Deleting in TimescaleDB
-	_, err := r.timescaleDbClient.Exec(
+	res, err := r.timescaleDbClient.Exec(
 		DELETE_SENSOR,
 		id,
 	)
@@ -175,5 +263,13 @@ func (r *repository) DeleteSensor(ctx context.Context, id string) error {
 		return errors.TrackErrorVar(err, errVars)
 	}
 
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.TrackErrorVar(err, errVars)
+	}
+	if affected == 0 {
+		return ErrSensorNotFound
+	}
+
 	return nil
 }
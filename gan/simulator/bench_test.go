@@ -0,0 +1,240 @@
+package simulator
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/config"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+	log "github.com/sirupsen/logrus"
+)
+
+// Resolution and range of the tick error histogram of the benchmark
+const (
+	BENCH_BUCKET_WIDTH = 100 * time.Microsecond
+	BENCH_BUCKETS      = 10000
+)
+
+// Rate and jitter of the sensors of the benchmark
+const (
+	BENCH_RATE   = 100 * time.Millisecond
+	BENCH_JITTER = 10 * time.Millisecond
+)
+
+// Publisher which discards the samples, so the benchmark only measures the simulator
+type discardPublisher struct{}
+
+func (discardPublisher) Publish(subject string, msgID string, data []byte) error {
+	return nil
+}
+
+// Histogram of tick errors which can be updated by every worker at once
+type tickHistogram struct {
+	buckets [BENCH_BUCKETS + 1]atomic.Int64
+	max     atomic.Int64
+	enabled atomic.Bool
+}
+
+func (h *tickHistogram) add(late time.Duration) {
+	if !h.enabled.Load() {
+		return
+	}
+
+	late = max(late, 0)
+	h.buckets[min(int(late/BENCH_BUCKET_WIDTH), BENCH_BUCKETS)].Add(1)
+
+	for {
+		current := h.max.Load()
+		if int64(late) <= current || h.max.CompareAndSwap(current, int64(late)) {
+			return
+		}
+	}
+}
+
+func (h *tickHistogram) total() int64 {
+	var total int64
+	for i := range h.buckets {
+		total += h.buckets[i].Load()
+	}
+	return total
+}
+
+// This function returns the upper bound of the bucket containing the quantile q
+func (h *tickHistogram) quantile(q float64) time.Duration {
+	target := int64(q * float64(h.total()))
+
+	var count int64
+	for i := range h.buckets {
+		count += h.buckets[i].Load()
+		if count > target {
+			return time.Duration(i+1) * BENCH_BUCKET_WIDTH
+		}
+	}
+
+	return time.Duration(h.max.Load())
+}
+
+// Default p99 tick error allowed by BenchmarkSchedulerCapacity. GAN_BENCH_TICK_BUDGET sets
+// another one, e.g. 5ms
+const BENCH_DEFAULT_BUDGET = 10 * time.Millisecond
+
+// Fleets measured by BenchmarkSchedulerCapacity, which stops doubling the fleet at the max size and
+// stops bisecting when the fleets it tells apart are closer than the precision (a fraction)
+const (
+	BENCH_MIN_FLEET       = 1000
+	BENCH_MAX_FLEET       = 1 << 20
+	BENCH_PRECISION       = 0.05
+	BENCH_CAPACITY_ROUNDS = 20
+)
+
+// BenchmarkScheduler measures the tick error of the scheduler with the wall-clock time, that is
+// the delay between the instant a sample is due and the instant a worker starts sending it. Every
+// operation is a round of samples of every sensor, so -benchtime 100x measures 10 seconds. A
+// saturated simulator sends fewer samples than expected, which is reported as ticks/sensor/op
+func BenchmarkScheduler(b *testing.B) {
+	// Starting and stopping thousands of sensors must not flood the output
+	level := log.GetLevel()
+	log.SetLevel(log.WarnLevel)
+	defer log.SetLevel(level)
+
+	for _, sensors := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("sensors=%d", sensors), func(b *testing.B) {
+			histogram := measureScheduler(sensors, b.N, b.ResetTimer, b.StopTimer)
+
+			b.ReportMetric(float64(sensors)/float64(runtime.GOMAXPROCS(0)), "sensors/core")
+			b.ReportMetric(float64(histogram.quantile(0.5)), "p50-tick-error-ns")
+			b.ReportMetric(float64(histogram.quantile(0.99)), "p99-tick-error-ns")
+			b.ReportMetric(float64(histogram.max.Load()), "max-tick-error-ns")
+			b.ReportMetric(float64(histogram.total())/float64(sensors)/float64(b.N), "ticks/sensor/op")
+		})
+	}
+}
+
+// BenchmarkSchedulerCapacity finds the largest fleet whose p99 tick error stays within the budget
+// and reports it as sensors/core. The fleet is doubled until the budget is exceeded and then the
+// largest fleet within the budget is bisected. Every fleet is measured for a couple of seconds, so
+// run it with -benchtime 1x
+func BenchmarkSchedulerCapacity(b *testing.B) {
+	budget := BENCH_DEFAULT_BUDGET
+	if env := os.Getenv("GAN_BENCH_TICK_BUDGET"); env != "" {
+		var err error
+		if budget, err = time.ParseDuration(env); err != nil {
+			b.Fatalf("invalid GAN_BENCH_TICK_BUDGET: %v", err)
+		}
+	}
+
+	level := log.GetLevel()
+	log.SetLevel(log.WarnLevel)
+	defer log.SetLevel(level)
+
+	within := func(sensors int) bool {
+		histogram := measureScheduler(sensors, BENCH_CAPACITY_ROUNDS, func() {}, func() {})
+		p99 := histogram.quantile(0.99)
+		// A saturated scheduler skips samples instead of sending them late
+		ticks := float64(histogram.total()) / float64(sensors) / BENCH_CAPACITY_ROUNDS
+		b.Logf("%d sensors: p99 tick error %v, %.2f ticks/sensor/round", sensors, p99, ticks)
+		return p99 <= budget && ticks >= 0.9
+	}
+
+	var capacity int
+	for range b.N {
+		capacity = searchCapacity(within)
+	}
+
+	b.ReportMetric(float64(capacity)/float64(runtime.GOMAXPROCS(0)), "sensors/core")
+	b.ReportMetric(float64(capacity), "sensors")
+	b.ReportMetric(float64(budget), "p99-budget-ns")
+}
+
+// This function returns the largest fleet between BENCH_MIN_FLEET and BENCH_MAX_FLEET for which
+// within is true, assuming that it is false for every larger fleet. It returns 0 if even the
+// smallest fleet is not within
+func searchCapacity(within func(sensors int) bool) int {
+	if !within(BENCH_MIN_FLEET) {
+		return 0
+	}
+
+	low, high := BENCH_MIN_FLEET, 0
+	for high == 0 {
+		if low >= BENCH_MAX_FLEET {
+			return BENCH_MAX_FLEET
+		}
+		next := min(2*low, BENCH_MAX_FLEET)
+		if within(next) {
+			low = next
+		} else {
+			high = next
+		}
+	}
+
+	for float64(high-low) > BENCH_PRECISION*float64(low) {
+		mid := low + (high-low)/2
+		if within(mid) {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return low
+}
+
+// This function runs a fleet of sensors and returns the histogram of the tick errors of the given
+// rounds of samples. start and stop are called around the measured rounds
+func measureScheduler(sensors int, rounds int, start func(), stop func()) *tickHistogram {
+	histogram := &tickHistogram{}
+	subjects, _ := NewSubjectTemplate(DEFAULT_SUBJECT_TEMPLATE)
+	m := newManager(discardPublisher{}, subjects, config.SimulatorConfig{}, &realClock{}, nil, histogram.add)
+	defer m.Close()
+
+	for i := range sensors {
+		m.Start(entity.Sensor{
+			ID:           fmt.Sprintf("00000000-0000-4000-8000-%012d", i),
+			Type:         "temperature",
+			Rate:         BENCH_RATE,
+			Jitter:       BENCH_JITTER,
+			MaxThreshold: 40,
+			MinThreshold: -20,
+			Generator:    entity.Generator{Type: UNIFORM_GENERATOR},
+		})
+	}
+
+	// The first round of samples is not measured, since sensors are still being started
+	time.Sleep(BENCH_RATE)
+	histogram.enabled.Store(true)
+	start()
+	for range rounds {
+		time.Sleep(BENCH_RATE)
+	}
+	stop()
+	histogram.enabled.Store(false)
+
+	return histogram
+}
+
+func TestSearchCapacity(t *testing.T) {
+	for _, capacity := range []int{0, 999, 1000, 1500, 4096, 300000, BENCH_MAX_FLEET, 2 * BENCH_MAX_FLEET} {
+		t.Run(fmt.Sprint(capacity), func(t *testing.T) {
+			measured := 0
+			got := searchCapacity(func(sensors int) bool {
+				measured++
+				return sensors <= capacity
+			})
+
+			want := min(capacity, BENCH_MAX_FLEET)
+			if capacity < BENCH_MIN_FLEET {
+				want = 0
+			}
+			if got > want || float64(want-got) > BENCH_PRECISION*float64(want) {
+				t.Errorf("searchCapacity() = %d, want %d within %v", got, want, BENCH_PRECISION)
+			}
+			if measured > 20 {
+				t.Errorf("%d fleets measured", measured)
+			}
+		})
+	}
+}
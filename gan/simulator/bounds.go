@@ -0,0 +1,95 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+// ValidateBounds checks that the sensor thresholds can be crossed at the configured rate
+func ValidateBounds(sensor entity.Sensor) error {
+	if sensor.ThresholdCrossingRate == nil {
+		return nil
+	}
+
+	rate := *sensor.ThresholdCrossingRate
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("threshold crossing rate must be between 0 and 1")
+	}
+
+	if sensor.MinThreshold >= sensor.MaxThreshold {
+		return fmt.Errorf("min threshold must be lower than max threshold")
+	}
+
+	b := newValueBounds(sensor, nil)
+	if rate > 0 && !b.canCrossMin() && !b.canCrossMax() {
+		return fmt.Errorf("thresholds cannot be crossed within the physical limits of %s sensors", sensor.Type)
+	}
+
+	return nil
+}
+
+// valueBounds keeps generated values within the physical limits of the sensor type. If the sensor
+// has a threshold crossing rate, values stay within the thresholds except for that fraction of
+// samples, which cross one of them
+type valueBounds struct {
+	physicalMin  float64
+	physicalMax  float64
+	minThreshold float64
+	maxThreshold float64
+	crossingRate *float64
+	rng          *rand.Rand
+}
+
+func newValueBounds(sensor entity.Sensor, rng *rand.Rand) *valueBounds {
+	profile := sensorProfiles[sensor.Type]
+
+	return &valueBounds{
+		physicalMin:  profile.physicalMin,
+		physicalMax:  profile.physicalMax,
+		minThreshold: float64(sensor.MinThreshold),
+		maxThreshold: float64(sensor.MaxThreshold),
+		crossingRate: sensor.ThresholdCrossingRate,
+		rng:          rng,
+	}
+}
+
+func (b *valueBounds) canCrossMin() bool {
+	return b.minThreshold > b.physicalMin
+}
+
+func (b *valueBounds) canCrossMax() bool {
+	return b.maxThreshold < b.physicalMax
+}
+
+func (b *valueBounds) apply(value float32) float32 {
+	v := float64(value)
+
+	if b.crossingRate != nil {
+		v = math.Min(math.Max(v, b.minThreshold), b.maxThreshold)
+
+		if b.rng.Float64() < *b.crossingRate {
+			v = b.cross()
+		}
+	}
+
+	return float32(math.Min(math.Max(v, b.physicalMin), b.physicalMax))
+}
+
+// This function returns a value beyond one of the thresholds, at most a 10% of the distance
+// between thresholds away from it
+func (b *valueBounds) cross() float64 {
+	excursion := (b.maxThreshold - b.minThreshold) * 0.1 * (1 - b.rng.Float64())
+
+	above := b.canCrossMax()
+	if b.canCrossMax() && b.canCrossMin() {
+		above = b.rng.IntN(2) == 0
+	}
+
+	if above {
+		return math.Min(b.maxThreshold+excursion, b.physicalMax)
+	}
+	return math.Max(b.minThreshold-excursion, b.physicalMin)
+}
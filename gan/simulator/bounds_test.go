@@ -0,0 +1,88 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+func TestValueBounds(t *testing.T) {
+	none := 0.0
+
+	tests := []struct {
+		name  string
+		typ   string
+		rate  *float64
+		value float32
+		want  float32
+	}{
+		{name: "within thresholds", typ: "temperature", value: 20, want: 20},
+		{name: "beyond thresholds without rate", typ: "temperature", value: 45, want: 45},
+		{name: "above thresholds with rate", typ: "temperature", rate: &none, value: 45, want: 30},
+		{name: "below thresholds with rate", typ: "temperature", rate: &none, value: -25, want: 10},
+		{name: "below physical limit", typ: "humidity", value: -5, want: 0},
+		{name: "above physical limit", typ: "humidity", value: 120, want: 100},
+		{name: "below absolute zero", typ: "temperature", value: -300, want: -273.15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sensor := entity.Sensor{Type: tt.typ, MinThreshold: 10, MaxThreshold: 30, ThresholdCrossingRate: tt.rate}
+			b := newValueBounds(sensor, rand.New(rand.NewPCG(1, 1)))
+
+			if got := b.apply(tt.value); got != tt.want {
+				t.Errorf("apply(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThresholdCrossingRate(t *testing.T) {
+	tests := []struct {
+		typ      string
+		min, max float32
+	}{
+		// The default range of temperature sensors (-30..60) goes beyond both thresholds
+		{typ: "temperature", min: 0, max: 30},
+		{typ: "pressure", min: 740, max: 780},
+		// Humidity thresholds at the physical limit can only be crossed on the other side
+		{typ: "humidity", min: 0, max: 70},
+	}
+
+	for _, tt := range tests {
+		for _, rate := range []float64{0, 0.1, 0.5, 1} {
+			t.Run(fmt.Sprintf("%s %v", tt.typ, rate), func(t *testing.T) {
+				sensor := entity.Sensor{Type: tt.typ, MinThreshold: tt.min, MaxThreshold: tt.max, ThresholdCrossingRate: &rate}
+				rng := rand.New(rand.NewPCG(7, 7))
+				gen, err := NewGenerator(tt.typ, entity.Generator{Type: UNIFORM_GENERATOR}, rng)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b := newValueBounds(sensor, rng)
+
+				// Crossings are at most a 10% of the distance between thresholds away
+				margin := (tt.max - tt.min) * 0.1
+
+				const samples = 100000
+				crossed := 0
+				for range samples {
+					v := b.apply(gen.Next(time.Time{}))
+					if v < tt.min || v > tt.max {
+						crossed++
+						if v < tt.min-margin || v > tt.max+margin {
+							t.Fatalf("crossing %v too far from the thresholds", v)
+						}
+					}
+				}
+
+				if got := float64(crossed) / samples; math.Abs(got-rate) > 0.01 {
+					t.Errorf("crossing rate = %v, want %v", got, rate)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package simulator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/config"
+)
+
+const (
+	REALTIME_CLOCK    = "realtime"
+	ACCELERATED_CLOCK = "accelerated"
+	FAST_CLOCK        = "fast"
+)
+
+// Clock is the source of time of the simulator. Sensors are scheduled and their samples are
+// stamped with its time, which does not need to be the wall-clock time
+type Clock interface {
+	// Now returns the current simulated instant
+	Now() time.Time
+	// SleepUntil blocks until the simulated instant t. It returns false if stop is closed before,
+	// or if t is beyond the end of the simulated time
+	SleepUntil(t time.Time, stop <-chan struct{}) bool
+}
+
+// NewClock builds the clock described in the simulator configuration
+func NewClock(conf config.ClockConfig) (Clock, error) {
+	now := time.Now()
+
+	epoch := now
+	if conf.Epoch != "" {
+		var err error
+		if epoch, err = time.Parse(time.RFC3339, conf.Epoch); err != nil {
+			return nil, fmt.Errorf("invalid clock epoch: %w", err)
+		}
+	}
+
+	var end time.Time
+	if conf.Until != "" {
+		var err error
+		if end, err = time.Parse(time.RFC3339, conf.Until); err != nil {
+			return nil, fmt.Errorf("invalid clock until: %w", err)
+		}
+	}
+
+	switch conf.Mode {
+	case "", REALTIME_CLOCK:
+		return &realClock{end: end}, nil
+	case ACCELERATED_CLOCK:
+		if conf.Factor <= 0 {
+			return nil, fmt.Errorf("accelerated clock factor must be greater than 0")
+		}
+		return &acceleratedClock{epoch: epoch, start: now, factor: conf.Factor, end: end}, nil
+	case FAST_CLOCK:
+		return &fastClock{now: epoch, end: end}, nil
+	default:
+		return nil, fmt.Errorf("unknown clock mode %s", conf.Mode)
+	}
+}
+
+// This function tells whether t is beyond the end of the simulated time
+func isAfterEnd(t, end time.Time) bool {
+	return !end.IsZero() && t.After(end)
+}
+
+// This function waits d of wall-clock time unless stop is closed before
+func sleep(d time.Duration, stop <-chan struct{}) bool {
+	if d <= 0 {
+		select {
+		case <-stop:
+			return false
+		default:
+			return true
+		}
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Wall-clock time
+type realClock struct {
+	end time.Time
+}
+
+func (c *realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c *realClock) SleepUntil(t time.Time, stop <-chan struct{}) bool {
+	if isAfterEnd(t, c.end) {
+		return false
+	}
+	return sleep(time.Until(t), stop)
+}
+
+// Time which starts in epoch and runs factor times faster than the wall-clock time
+type acceleratedClock struct {
+	epoch  time.Time
+	start  time.Time
+	factor float64
+	end    time.Time
+}
+
+func (c *acceleratedClock) Now() time.Time {
+	elapsed := time.Duration(float64(time.Since(c.start)) * c.factor)
+	return c.epoch.Add(elapsed)
+}
+
+func (c *acceleratedClock) SleepUntil(t time.Time, stop <-chan struct{}) bool {
+	if isAfterEnd(t, c.end) {
+		return false
+	}
+	return sleep(time.Duration(float64(t.Sub(c.Now()))/c.factor), stop)
+}
+
+// Time which starts in epoch and jumps to the next instant as soon as it is requested, so the
+// simulation runs as fast as possible. Now returns the latest instant reached by any sensor
+type fastClock struct {
+	now time.Time
+	end time.Time
+	mu  sync.Mutex
+}
+
+func (c *fastClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fastClock) SleepUntil(t time.Time, stop <-chan struct{}) bool {
+	if isAfterEnd(t, c.end) {
+		return false
+	}
+
+	c.mu.Lock()
+	if t.After(c.now) {
+		c.now = t
+	}
+	c.mu.Unlock()
+
+	return sleep(0, stop)
+}
@@ -0,0 +1,158 @@
+package simulator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/config"
+)
+
+func TestNewClock(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.ClockConfig
+		want    Clock
+		wantErr bool
+	}{
+		{name: "default", conf: config.ClockConfig{}, want: &realClock{}},
+		{name: "realtime", conf: config.ClockConfig{Mode: REALTIME_CLOCK, Until: "2030-01-01T00:00:00Z"}, want: &realClock{}},
+		{name: "accelerated", conf: config.ClockConfig{Mode: ACCELERATED_CLOCK, Factor: 60, Epoch: "2024-05-01T00:00:00Z"}, want: &acceleratedClock{}},
+		{name: "fast", conf: config.ClockConfig{Mode: FAST_CLOCK, Epoch: "2024-05-01T00:00:00Z"}, want: &fastClock{}},
+		{name: "accelerated without factor", conf: config.ClockConfig{Mode: ACCELERATED_CLOCK}, wantErr: true},
+		{name: "negative factor", conf: config.ClockConfig{Mode: ACCELERATED_CLOCK, Factor: -1}, wantErr: true},
+		{name: "invalid epoch", conf: config.ClockConfig{Mode: FAST_CLOCK, Epoch: "yesterday"}, wantErr: true},
+		{name: "invalid until", conf: config.ClockConfig{Until: "1714521600"}, wantErr: true},
+		{name: "unknown mode", conf: config.ClockConfig{Mode: "slow"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock, err := NewClock(tt.conf)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("NewClock() = %T, want an error", clock)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if reflect.TypeOf(clock) != reflect.TypeOf(tt.want) {
+				t.Errorf("NewClock() = %T, want %T", clock, tt.want)
+			}
+			// Simulated clocks start in the epoch
+			epoch := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+			if tt.conf.Epoch != "" && (clock.Now().Before(epoch) || clock.Now().After(epoch.Add(time.Hour))) {
+				t.Errorf("Now() = %v, want it at the epoch %v", clock.Now(), epoch)
+			}
+		})
+	}
+}
+
+func TestAcceleratedClock(t *testing.T) {
+	epoch := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		factor  float64
+		elapsed time.Duration
+		// Simulated time to sleep and the wall-clock time it should take
+		sleep time.Duration
+		wall  time.Duration
+	}{
+		{factor: 1, elapsed: time.Second, sleep: 50 * time.Millisecond, wall: 50 * time.Millisecond},
+		{factor: 60, elapsed: time.Second, sleep: 3 * time.Second, wall: 50 * time.Millisecond},
+		{factor: 3600, elapsed: 2 * time.Second, sleep: 3 * time.Minute, wall: 50 * time.Millisecond},
+		{factor: 0.5, elapsed: 4 * time.Second, sleep: 25 * time.Millisecond, wall: 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(time.Duration(tt.factor*float64(time.Second)).String()+"/s", func(t *testing.T) {
+			c := &acceleratedClock{epoch: epoch, start: time.Now().Add(-tt.elapsed), factor: tt.factor}
+
+			want := epoch.Add(time.Duration(float64(tt.elapsed) * tt.factor))
+			if got := c.Now(); got.Before(want) || got.Sub(want) > time.Duration(tt.factor*float64(100*time.Millisecond)) {
+				t.Errorf("Now() = %v, want %v", got, want)
+			}
+
+			start := time.Now()
+			if !c.SleepUntil(c.Now().Add(tt.sleep), nil) {
+				t.Fatal("SleepUntil() = false, want true")
+			}
+			if wall := time.Since(start); wall < tt.wall*9/10 || wall > tt.wall+200*time.Millisecond {
+				t.Errorf("SleepUntil() slept %v, want %v", wall, tt.wall)
+			}
+		})
+	}
+}
+
+func TestFastClock(t *testing.T) {
+	epoch := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	c := &fastClock{now: epoch, end: epoch.Add(time.Hour)}
+	stopped := make(chan struct{})
+	close(stopped)
+
+	steps := []struct {
+		name  string
+		until time.Time
+		stop  <-chan struct{}
+		want  bool
+		// Simulated instant after sleeping
+		now time.Time
+	}{
+		{name: "advances at once", until: epoch.Add(time.Minute), want: true, now: epoch.Add(time.Minute)},
+		{name: "never goes back", until: epoch.Add(time.Second), want: true, now: epoch.Add(time.Minute)},
+		{name: "until the end", until: epoch.Add(time.Hour), want: true, now: epoch.Add(time.Hour)},
+		{name: "beyond the end", until: epoch.Add(time.Hour + time.Millisecond), want: false, now: epoch.Add(time.Hour)},
+		{name: "stopped", until: epoch.Add(30 * time.Minute), stop: stopped, want: false, now: epoch.Add(time.Hour)},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			start := time.Now()
+			if got := c.SleepUntil(step.until, step.stop); got != step.want {
+				t.Errorf("SleepUntil(%v) = %v, want %v", step.until, got, step.want)
+			}
+			if wall := time.Since(start); wall > 50*time.Millisecond {
+				t.Errorf("SleepUntil(%v) waited %v of wall-clock time", step.until, wall)
+			}
+			if got := c.Now(); !got.Equal(step.now) {
+				t.Errorf("Now() = %v, want %v", got, step.now)
+			}
+		})
+	}
+}
+
+func TestRealClock(t *testing.T) {
+	stopped := make(chan struct{})
+	close(stopped)
+
+	tests := []struct {
+		name  string
+		end   time.Time
+		until time.Duration
+		stop  <-chan struct{}
+		want  bool
+		wall  time.Duration
+	}{
+		{name: "past instant", until: -time.Second, want: true},
+		{name: "future instant", until: 50 * time.Millisecond, want: true, wall: 50 * time.Millisecond},
+		{name: "stopped", until: time.Hour, stop: stopped, want: false},
+		{name: "beyond the end", end: time.Now(), until: time.Hour, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &realClock{end: tt.end}
+
+			start := time.Now()
+			if got := c.SleepUntil(start.Add(tt.until), tt.stop); got != tt.want {
+				t.Errorf("SleepUntil() = %v, want %v", got, tt.want)
+			}
+			if wall := time.Since(start); wall < tt.wall*9/10 || wall > tt.wall+200*time.Millisecond {
+				t.Errorf("SleepUntil() slept %v, want %v", wall, tt.wall)
+			}
+		})
+	}
+}
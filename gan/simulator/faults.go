@@ -0,0 +1,166 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+// ValidateFaults checks the fault profile of a sensor
+func ValidateFaults(profile entity.FaultProfile) error {
+	faults := map[string]*entity.Fault{
+		"dropout":   profile.Dropout,
+		"stuckAt":   profile.StuckAt,
+		"spike":     profile.Spike,
+		"drift":     profile.Drift,
+		"garbage":   profile.Garbage,
+		"duplicate": profile.Duplicate,
+	}
+
+	for name, fault := range faults {
+		if fault == nil {
+			continue
+		}
+		if fault.Probability < 0 || fault.Probability > 1 {
+			return fmt.Errorf("%s fault probability must be between 0 and 1", name)
+		}
+		if fault.Duration < 0 {
+			return fmt.Errorf("%s fault duration must not be negative", name)
+		}
+	}
+
+	for name, fault := range map[string]*entity.Fault{"spike": profile.Spike, "drift": profile.Drift} {
+		if fault != nil && fault.Enabled && fault.Magnitude == 0 {
+			return fmt.Errorf("%s fault magnitude must not be 0", name)
+		}
+	}
+
+	return nil
+}
+
+// What has to be sent for a sample once faults are applied
+type faultySample struct {
+	value float32
+	// Number of times the sample is sent
+	copies int
+	// The payload is not a valid sample
+	garbage bool
+}
+
+// faultInjector applies the fault profile of a sensor to its samples. The profile can be
+// replaced while the sensor is running
+type faultInjector struct {
+	profile entity.FaultProfile
+	rng     *rand.Rand
+	// Simulated instant when every active fault ends
+	activeUntil map[*entity.Fault]time.Time
+	stuckValue  float32
+	drift       float64
+	mu          sync.Mutex
+}
+
+func newFaultInjector(profile entity.FaultProfile, rng *rand.Rand) *faultInjector {
+	return &faultInjector{
+		profile:     profile,
+		rng:         rng,
+		activeUntil: make(map[*entity.Fault]time.Time),
+	}
+}
+
+// This function replaces the fault profile. Active faults are cancelled
+func (f *faultInjector) setProfile(profile entity.FaultProfile) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.profile = profile
+	f.activeUntil = make(map[*entity.Fault]time.Time)
+	f.drift = 0
+}
+
+// This function tells whether a fault is happening in the sample taken at instant t. A fault
+// which is not happening may start with its probability
+func (f *faultInjector) isActive(fault *entity.Fault, t time.Time) bool {
+	if fault == nil || !fault.Enabled {
+		return false
+	}
+
+	if until, ok := f.activeUntil[fault]; ok {
+		if !t.After(until) {
+			return true
+		}
+		delete(f.activeUntil, fault)
+	}
+
+	if f.rng.Float64() < fault.Probability {
+		f.activeUntil[fault] = t.Add(time.Duration(fault.Duration * float64(time.Second)))
+		return true
+	}
+
+	return false
+}
+
+// This function applies the faults to the value sampled at instant t
+func (f *faultInjector) apply(t time.Time, value float32) faultySample {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sample := faultySample{value: value, copies: 1}
+
+	if f.isActive(f.profile.Dropout, t) {
+		sample.copies = 0
+		return sample
+	}
+
+	if f.isActive(f.profile.StuckAt, t) {
+		sample.value = f.stuckValue
+	} else {
+		f.stuckValue = value
+	}
+
+	if f.isActive(f.profile.Drift, t) {
+		f.drift += f.profile.Drift.Magnitude
+	} else {
+		f.drift = 0
+	}
+	sample.value += float32(f.drift)
+
+	if f.isActive(f.profile.Spike, t) {
+		if f.rng.IntN(2) == 0 {
+			sample.value += float32(f.profile.Spike.Magnitude)
+		} else {
+			sample.value -= float32(f.profile.Spike.Magnitude)
+		}
+	}
+
+	sample.garbage = f.isActive(f.profile.Garbage, t)
+
+	if f.isActive(f.profile.Duplicate, t) {
+		sample.copies = 2
+	}
+
+	return sample
+}
+
+// This function builds a payload which consumers cannot process as a sample
+func (f *faultInjector) garbage(id string, t time.Time) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch f.rng.IntN(3) {
+	case 0:
+		// JSON does not support NaN
+		return fmt.Appendf(nil, `{"sensorId":"%s","value":NaN,"unit":"","timestamp":%d}`, id, t.UnixMilli())
+	case 1:
+		// Truncated message
+		return fmt.Appendf(nil, `{"sensorId":"%s","val`, id)
+	default:
+		payload := make([]byte, 16)
+		for i := range payload {
+			payload[i] = byte(f.rng.UintN(256))
+		}
+		return payload
+	}
+}
@@ -0,0 +1,139 @@
+package simulator
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+func always(magnitude float64) *entity.Fault {
+	return &entity.Fault{Enabled: true, Probability: 1, Magnitude: magnitude}
+}
+
+func TestValidateFaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile entity.FaultProfile
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "valid", profile: entity.FaultProfile{Dropout: &entity.Fault{Enabled: true, Probability: 0.1, Duration: 5}, Spike: always(3)}},
+		{name: "probability above 1", profile: entity.FaultProfile{Garbage: &entity.Fault{Probability: 1.5}}, wantErr: true},
+		{name: "negative probability", profile: entity.FaultProfile{Duplicate: &entity.Fault{Probability: -0.1}}, wantErr: true},
+		{name: "negative duration", profile: entity.FaultProfile{StuckAt: &entity.Fault{Duration: -1}}, wantErr: true},
+		{name: "spike without magnitude", profile: entity.FaultProfile{Spike: always(0)}, wantErr: true},
+		{name: "disabled drift without magnitude", profile: entity.FaultProfile{Drift: &entity.Fault{Probability: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateFaults(tt.profile); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFaults() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFaultInjector(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name    string
+		profile entity.FaultProfile
+		want    []faultySample
+	}{
+		{
+			name: "no faults",
+			want: []faultySample{{value: 10, copies: 1}, {value: 20, copies: 1}, {value: 30, copies: 1}},
+		},
+		{
+			name:    "disabled fault",
+			profile: entity.FaultProfile{Dropout: &entity.Fault{Probability: 1}},
+			want:    []faultySample{{value: 10, copies: 1}, {value: 20, copies: 1}, {value: 30, copies: 1}},
+		},
+		{
+			name:    "dropout",
+			profile: entity.FaultProfile{Dropout: always(0), Duplicate: always(0)},
+			want:    []faultySample{{value: 10}, {value: 20}, {value: 30}},
+		},
+		{
+			name:    "drift accumulates",
+			profile: entity.FaultProfile{Drift: always(0.5)},
+			want:    []faultySample{{value: 10.5, copies: 1}, {value: 21, copies: 1}, {value: 31.5, copies: 1}},
+		},
+		{
+			name:    "duplicate",
+			profile: entity.FaultProfile{Duplicate: always(0)},
+			want:    []faultySample{{value: 10, copies: 2}, {value: 20, copies: 2}, {value: 30, copies: 2}},
+		},
+		{
+			name:    "garbage",
+			profile: entity.FaultProfile{Garbage: always(0)},
+			want:    []faultySample{{value: 10, copies: 1, garbage: true}, {value: 20, copies: 1, garbage: true}, {value: 30, copies: 1, garbage: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFaultInjector(tt.profile, rand.New(rand.NewPCG(1, 2)))
+			for i, want := range tt.want {
+				if got := f.apply(start.Add(time.Duration(i)*time.Second), float32(10*(i+1))); got != want {
+					t.Errorf("sample %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSpikeFault(t *testing.T) {
+	f := newFaultInjector(entity.FaultProfile{Spike: always(5)}, rand.New(rand.NewPCG(1, 2)))
+
+	for i := range 100 {
+		got := f.apply(time.Unix(int64(i), 0), 10)
+		if got.value != 15 && got.value != 5 {
+			t.Fatalf("sample %d = %v, want 10 ± 5", i, got.value)
+		}
+	}
+}
+
+func TestStuckAtFault(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	f := newFaultInjector(entity.FaultProfile{}, rand.New(rand.NewPCG(1, 2)))
+
+	f.apply(start, 10)
+	f.setProfile(entity.FaultProfile{StuckAt: always(0)})
+	for i, value := range []float32{20, 30} {
+		if got := f.apply(start.Add(time.Duration(i+1)*time.Second), value); got.value != 10 {
+			t.Errorf("sample %d = %v, want the last value before the fault", i+1, got.value)
+		}
+	}
+}
+
+func TestFaultDuration(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	dropout := &entity.Fault{Enabled: true, Probability: 1, Duration: 2}
+	f := newFaultInjector(entity.FaultProfile{Dropout: dropout}, rand.New(rand.NewPCG(1, 2)))
+
+	f.apply(start, 10)
+	// The fault cannot start again, but the started one lasts its duration
+	dropout.Probability = 0
+	for i, want := range []int{0, 0, 1} {
+		if got := f.apply(start.Add(time.Duration(i+1)*time.Second), 10); got.copies != want {
+			t.Errorf("second %d: copies = %d, want %d", i+1, got.copies, want)
+		}
+	}
+}
+
+func TestGarbagePayload(t *testing.T) {
+	f := newFaultInjector(entity.FaultProfile{}, rand.New(rand.NewPCG(1, 2)))
+
+	for range 30 {
+		payload := f.garbage("8cf3030f-2206-4fcb-8c42-d0eb70e197ab", time.Unix(1700000000, 0))
+		if json.Valid(payload) {
+			t.Fatalf("garbage payload %q is valid JSON", payload)
+		}
+	}
+}
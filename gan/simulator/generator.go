@@ -0,0 +1,234 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+const (
+	UNIFORM_GENERATOR     = "uniform"
+	RANDOM_WALK_GENERATOR = "random-walk"
+	SINE_GENERATOR        = "sine"
+	GAUSSIAN_GENERATOR    = "gaussian"
+	CONSTANT_GENERATOR    = "constant"
+	STEP_GENERATOR        = "step"
+)
+
+// Generator produces the values emitted by a sensor simulator
+type Generator interface {
+	// Next returns the value sampled at instant t
+	Next(t time.Time) float32
+}
+
+// Every type of sensor has its own unit, its own default range of values and the physical limits
+// that no generated value can exceed
+type sensorProfile struct {
+	unit        string
+	min         float64
+	max         float64
+	physicalMin float64
+	physicalMax float64
+}
+
+var sensorProfiles = map[string]sensorProfile{
+	"temperature": {unit: "celsius", min: -30, max: 60, physicalMin: -273.15, physicalMax: math.Inf(1)},
+	"pressure":    {unit: "mmHg", min: 700, max: 820, physicalMin: 0, physicalMax: math.Inf(1)},
+	"humidity":    {unit: "percentage", min: 0, max: 100, physicalMin: 0, physicalMax: 100},
+}
+
+// This function tells whether typ is a known type of sensor
+func IsSensorType(typ string) bool {
+	_, ok := sensorProfiles[typ]
+	return ok
+}
+
+// This function returns the unit of the values generated for a type of sensor
+func unitOf(typ string) string {
+	return sensorProfiles[typ].unit
+}
+
+// generatorParams gives access to the user parameters of a generator, falling back to
+// default values. It remembers which parameters have been read so unknown ones can be detected
+type generatorParams struct {
+	values map[string]float64
+	known  map[string]bool
+}
+
+func (p *generatorParams) get(name string, def float64) float64 {
+	p.known[name] = true
+	if v, ok := p.values[name]; ok {
+		return v
+	}
+	return def
+}
+
+func (p *generatorParams) checkUnknown(typ string) error {
+	for name := range p.values {
+		if !p.known[name] {
+			return fmt.Errorf("unknown parameter '%s' for generator %s", name, typ)
+		}
+	}
+	return nil
+}
+
+// ValidateGenerator checks the generator settings of a sensor
+func ValidateGenerator(typ string, cfg entity.Generator) error {
+	_, err := NewGenerator(typ, cfg, nil)
+	return err
+}
+
+// NewGenerator builds the generator configured for a sensor. Missing parameters take default
+// values based on the range of the sensor type. Random values are drawn from rng
+func NewGenerator(typ string, cfg entity.Generator, rng *rand.Rand) (Generator, error) {
+	profile, ok := sensorProfiles[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown sensor type %s", typ)
+	}
+
+	mid := (profile.min + profile.max) / 2
+	span := profile.max - profile.min
+	p := &generatorParams{values: cfg.Params, known: map[string]bool{}}
+
+	var gen Generator
+	switch cfg.Type {
+	case "", UNIFORM_GENERATOR:
+		g := &uniformGenerator{rng: rng, min: p.get("min", profile.min), max: p.get("max", profile.max)}
+		if g.min >= g.max {
+			return nil, fmt.Errorf("min must be lower than max")
+		}
+		gen = g
+	case RANDOM_WALK_GENERATOR:
+		g := &randomWalkGenerator{
+			rng:   rng,
+			value: p.get("start", mid),
+			step:  p.get("step", span/100),
+			min:   p.get("min", profile.min),
+			max:   p.get("max", profile.max),
+		}
+		if g.min >= g.max {
+			return nil, fmt.Errorf("min must be lower than max")
+		}
+		if g.step <= 0 {
+			return nil, fmt.Errorf("step must be greater than 0")
+		}
+		// A single bounce is enough to come back to the limits
+		if g.step > g.max-g.min {
+			return nil, fmt.Errorf("step must not be greater than max - min")
+		}
+		if g.value < g.min || g.value > g.max {
+			return nil, fmt.Errorf("start must be between min and max")
+		}
+		gen = g
+	case SINE_GENERATOR:
+		g := &sineGenerator{
+			offset:    p.get("offset", mid),
+			amplitude: p.get("amplitude", span/4),
+			period:    p.get("period", 24*time.Hour.Seconds()),
+			phase:     p.get("phase", 0),
+		}
+		if g.period <= 0 {
+			return nil, fmt.Errorf("period must be greater than 0")
+		}
+		gen = g
+	case GAUSSIAN_GENERATOR:
+		g := &gaussianGenerator{rng: rng, setpoint: p.get("setpoint", mid), stddev: p.get("stddev", span/50)}
+		if g.stddev < 0 {
+			return nil, fmt.Errorf("stddev must not be negative")
+		}
+		gen = g
+	case CONSTANT_GENERATOR:
+		gen = &constantGenerator{value: p.get("value", mid)}
+	case STEP_GENERATOR:
+		g := &stepGenerator{
+			low:    p.get("low", mid-span/4),
+			high:   p.get("high", mid+span/4),
+			period: p.get("period", time.Hour.Seconds()),
+		}
+		if g.period <= 0 {
+			return nil, fmt.Errorf("period must be greater than 0")
+		}
+		gen = g
+	default:
+		return nil, fmt.Errorf("unknown generator %s", cfg.Type)
+	}
+
+	if err := p.checkUnknown(cfg.Type); err != nil {
+		return nil, err
+	}
+
+	return gen, nil
+}
+
+// Uniform noise in the range [min, max)
+type uniformGenerator struct {
+	rng      *rand.Rand
+	min, max float64
+}
+
+func (g *uniformGenerator) Next(t time.Time) float32 {
+	return float32(g.rng.Float64()*(g.max-g.min) + g.min)
+}
+
+// Random walk which moves at most step per sample and bounces in the limits [min, max]
+type randomWalkGenerator struct {
+	rng                   *rand.Rand
+	value, step, min, max float64
+}
+
+func (g *randomWalkGenerator) Next(t time.Time) float32 {
+	g.value += (g.rng.Float64()*2 - 1) * g.step
+	if g.value > g.max {
+		g.value = 2*g.max - g.value
+	}
+	if g.value < g.min {
+		g.value = 2*g.min - g.value
+	}
+	return float32(g.value)
+}
+
+// Sine wave with a period in seconds, useful for daily or seasonal cycles. The wave is
+// aligned to the UNIX epoch so sensors sharing the same parameters are in phase
+type sineGenerator struct {
+	offset, amplitude, period, phase float64
+}
+
+func (g *sineGenerator) Next(t time.Time) float32 {
+	seconds := float64(t.UnixNano()) / float64(time.Second)
+	return float32(g.offset + g.amplitude*math.Sin(2*math.Pi*seconds/g.period+g.phase))
+}
+
+// Normal distribution around a setpoint
+type gaussianGenerator struct {
+	rng              *rand.Rand
+	setpoint, stddev float64
+}
+
+func (g *gaussianGenerator) Next(t time.Time) float32 {
+	return float32(g.setpoint + g.rng.NormFloat64()*g.stddev)
+}
+
+// Always the same value
+type constantGenerator struct {
+	value float64
+}
+
+func (g *constantGenerator) Next(t time.Time) float32 {
+	return float32(g.value)
+}
+
+// Square wave which stays half of the period in low and the other half in high
+type stepGenerator struct {
+	low, high, period float64
+}
+
+func (g *stepGenerator) Next(t time.Time) float32 {
+	seconds := float64(t.UnixNano()) / float64(time.Second)
+	if math.Mod(seconds, g.period) < g.period/2 {
+		return float32(g.low)
+	}
+	return float32(g.high)
+}
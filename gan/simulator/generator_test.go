@@ -0,0 +1,47 @@
+package simulator
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+func TestRandomWalkGenerator(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]float64
+		wantErr bool
+	}{
+		{name: "defaults", params: nil},
+		{name: "step as wide as the range", params: map[string]float64{"start": 0, "step": 10, "min": 0, "max": 10}},
+		{name: "step wider than the range", params: map[string]float64{"start": 5, "step": 10.5, "min": 0, "max": 10}, wantErr: true},
+		{name: "zero step", params: map[string]float64{"step": 0}, wantErr: true},
+		{name: "start out of range", params: map[string]float64{"start": 11, "min": 0, "max": 10}, wantErr: true},
+		{name: "empty range", params: map[string]float64{"min": 10, "max": 10}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := entity.Generator{Type: RANDOM_WALK_GENERATOR, Params: tt.params}
+			g, err := NewGenerator("temperature", cfg, rand.New(rand.NewPCG(1, 2)))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("NewGenerator() accepted invalid params")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewGenerator() error = %v", err)
+			}
+
+			walk := g.(*randomWalkGenerator)
+			for range 100000 {
+				if v := float64(g.Next(time.Time{})); v < walk.min || v > walk.max {
+					t.Fatalf("value %v out of [%v, %v]", v, walk.min, walk.max)
+				}
+			}
+		})
+	}
+}
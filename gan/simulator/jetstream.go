@@ -0,0 +1,196 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/config"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	log "github.com/sirupsen/logrus"
+)
+
+// Default settings of the sensors stream
+const (
+	DEFAULT_STREAM_NAME       = "SENSORS"
+	DEFAULT_STREAM_DUPLICATES = 2 * time.Minute
+	DEFAULT_ACK_TIMEOUT       = 5 * time.Second
+	DEFAULT_PUBLISH_RETRIES   = 3
+	DEFAULT_MAX_PENDING       = 4096
+)
+
+// JetStreamPublisher sends samples into a JetStream stream without waiting for their
+// acknowledgements, so the scheduler workers are not bound by the round trip to NATS. Publish
+// blocks while maxPending messages are waiting for their acknowledgement. Messages which are not
+// acknowledged are sent again with the same ID, so the stream drops them if the first attempt was
+// stored
+type JetStreamPublisher struct {
+	js         jetstream.JetStream
+	ackTimeout time.Duration
+	retries    int
+	// Messages waiting for their acknowledgement, in the order they were sent
+	pending chan pendingMsg
+}
+
+// A message sent to the stream and the acknowledgement it is waiting for
+type pendingMsg struct {
+	subject string
+	msgID   string
+	data    []byte
+	ack     jetstream.PubAckFuture
+}
+
+// NewJetStreamPublisher creates the sensors stream or updates it with the configured settings.
+// The stream listens on every subject the sensors can publish in
+func NewJetStreamPublisher(ctx context.Context, nc *nats.Conn, conf config.StreamConfig,
+	subjects *SubjectTemplate) (*JetStreamPublisher, error) {
+	maxPending := conf.MaxPending
+	if maxPending <= 0 {
+		maxPending = DEFAULT_MAX_PENDING
+	}
+
+	js, err := jetstream.New(nc, jetstream.WithPublishAsyncMaxPending(maxPending))
+	if err != nil {
+		return nil, err
+	}
+
+	streamConfig, err := newStreamConfig(conf, subjects)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := js.CreateOrUpdateStream(ctx, streamConfig); err != nil {
+		return nil, fmt.Errorf("error creating stream %s: %w", streamConfig.Name, err)
+	}
+	log.Infof("publishing in stream %s with subjects %v", streamConfig.Name, streamConfig.Subjects)
+
+	ackTimeout := time.Duration(conf.AckTimeout * float64(time.Second))
+	if ackTimeout <= 0 {
+		ackTimeout = DEFAULT_ACK_TIMEOUT
+	}
+	retries := conf.PublishRetries
+	if retries <= 0 {
+		retries = DEFAULT_PUBLISH_RETRIES
+	}
+
+	return newJetStreamPublisher(js, ackTimeout, retries, maxPending), nil
+}
+
+// This function starts a publisher and the goroutine which checks its acknowledgements
+func newJetStreamPublisher(js jetstream.JetStream, ackTimeout time.Duration, retries int, maxPending int) *JetStreamPublisher {
+	p := &JetStreamPublisher{
+		js:         js,
+		ackTimeout: ackTimeout,
+		retries:    retries,
+		pending:    make(chan pendingMsg, maxPending),
+	}
+	go p.confirm()
+
+	return p
+}
+
+// This function translates the configuration of the stream
+func newStreamConfig(conf config.StreamConfig, subjects *SubjectTemplate) (jetstream.StreamConfig, error) {
+	streamConfig := jetstream.StreamConfig{
+		Name:       conf.Name,
+		Subjects:   []string{subjects.Filter()},
+		MaxAge:     time.Duration(conf.MaxAge * float64(time.Second)),
+		MaxBytes:   conf.MaxBytes,
+		MaxMsgs:    conf.MaxMsgs,
+		Duplicates: time.Duration(conf.Duplicates * float64(time.Second)),
+		Replicas:   conf.Replicas,
+	}
+
+	if streamConfig.Name == "" {
+		streamConfig.Name = DEFAULT_STREAM_NAME
+	}
+	if streamConfig.MaxBytes == 0 {
+		streamConfig.MaxBytes = -1
+	}
+	if streamConfig.MaxMsgs == 0 {
+		streamConfig.MaxMsgs = -1
+	}
+	if streamConfig.Duplicates <= 0 {
+		streamConfig.Duplicates = DEFAULT_STREAM_DUPLICATES
+	}
+
+	switch conf.Retention {
+	case "", "limits":
+		streamConfig.Retention = jetstream.LimitsPolicy
+	case "interest":
+		streamConfig.Retention = jetstream.InterestPolicy
+	case "workqueue":
+		streamConfig.Retention = jetstream.WorkQueuePolicy
+	default:
+		return streamConfig, fmt.Errorf("unknown stream retention %s", conf.Retention)
+	}
+
+	switch conf.Storage {
+	case "", "file":
+		streamConfig.Storage = jetstream.FileStorage
+	case "memory":
+		streamConfig.Storage = jetstream.MemoryStorage
+	default:
+		return streamConfig, fmt.Errorf("unknown stream storage %s", conf.Storage)
+	}
+
+	return streamConfig, nil
+}
+
+// Publish sends a message without waiting until the stream stores it. It only fails if the
+// message cannot be sent
+func (p *JetStreamPublisher) Publish(subject string, msgID string, data []byte) error {
+	ack, err := p.js.PublishAsync(subject, data, jetstream.WithMsgID(msgID), jetstream.WithStallWait(p.ackTimeout))
+	if err != nil {
+		return err
+	}
+
+	p.pending <- pendingMsg{subject: subject, msgID: msgID, data: data, ack: ack}
+	return nil
+}
+
+// Acknowledgements go rutine. Acknowledgements arrive in the order messages were sent, so they are
+// checked one by one. Messages which fail are sent again before checking the next ones
+func (p *JetStreamPublisher) confirm() {
+	timer := time.NewTimer(p.ackTimeout)
+	defer timer.Stop()
+
+	for msg := range p.pending {
+		timer.Reset(p.ackTimeout)
+
+		var err error
+		select {
+		case <-msg.ack.Ok():
+		case err = <-msg.ack.Err():
+		case <-timer.C:
+			err = fmt.Errorf("no acknowledgement after %v", p.ackTimeout)
+		}
+		timer.Stop()
+
+		if err != nil {
+			log.Warnf("attempt 1 publishing message %s failed: %v", msg.msgID, err)
+			p.resend(msg)
+		}
+	}
+}
+
+// This function sends a message again and waits until the stream stores it. It keeps the
+// message ID, so the stream drops it if an earlier attempt was stored
+func (p *JetStreamPublisher) resend(msg pendingMsg) {
+	var err error
+	for attempt := 1; attempt < p.retries; attempt++ {
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.ackTimeout)
+		_, err = p.js.Publish(ctx, msg.subject, msg.data, jetstream.WithMsgID(msg.msgID))
+		cancel()
+
+		if err == nil {
+			return
+		}
+		log.Warnf("attempt %d publishing message %s failed: %v", attempt+1, msg.msgID, err)
+	}
+
+	log.Errorf("error sending data to NATS: message %s lost after %d attempts", msg.msgID, p.retries)
+}
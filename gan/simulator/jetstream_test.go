@@ -0,0 +1,125 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Acknowledgement which is settled by the test
+type fakeAck struct {
+	ok  chan *jetstream.PubAck
+	err chan error
+}
+
+func (a *fakeAck) Ok() <-chan *jetstream.PubAck { return a.ok }
+func (a *fakeAck) Err() <-chan error            { return a.err }
+func (a *fakeAck) Msg() *nats.Msg               { return nil }
+
+// JetStream context which keeps the acknowledgements of the messages sent asynchronously and
+// records the IDs of the messages sent again
+type fakeJetStream struct {
+	jetstream.JetStream
+	mu      sync.Mutex
+	acks    []*fakeAck
+	resent  []string
+	resends chan struct{}
+}
+
+func (js *fakeJetStream) PublishAsync(subject string, data []byte, opts ...jetstream.PublishOpt) (jetstream.PubAckFuture, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	ack := &fakeAck{ok: make(chan *jetstream.PubAck, 1), err: make(chan error, 1)}
+	js.acks = append(js.acks, ack)
+	return ack, nil
+}
+
+func (js *fakeJetStream) Publish(ctx context.Context, subject string, data []byte, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	js.mu.Lock()
+	js.resent = append(js.resent, string(data))
+	js.mu.Unlock()
+
+	js.resends <- struct{}{}
+	return &jetstream.PubAck{}, nil
+}
+
+func (js *fakeJetStream) ack(i int, err error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	if err != nil {
+		js.acks[i].err <- err
+	} else {
+		js.acks[i].ok <- &jetstream.PubAck{}
+	}
+}
+
+func TestJetStreamPublisherBoundsPendingMessages(t *testing.T) {
+	js := &fakeJetStream{resends: make(chan struct{}, 10)}
+	p := newJetStreamPublisher(js, time.Hour, 3, 2)
+
+	// The first message is being checked and two more are waiting for it
+	for i := range 3 {
+		if err := p.Publish("sensors.temperature.1", fmt.Sprintf("1-%d", i), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sent := make(chan struct{})
+	go func() {
+		p.Publish("sensors.temperature.1", "1-3", []byte{3})
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("Publish() did not wait for the pending messages")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	js.ack(0, nil)
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("Publish() still blocked after an acknowledgement")
+	}
+}
+
+func TestJetStreamPublisherResendsFailedMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(js *fakeJetStream)
+	}{
+		{name: "negative acknowledgement", fail: func(js *fakeJetStream) { js.ack(0, errors.New("stream not available")) }},
+		{name: "no acknowledgement", fail: func(js *fakeJetStream) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js := &fakeJetStream{resends: make(chan struct{}, 10)}
+			p := newJetStreamPublisher(js, 50*time.Millisecond, 3, 10)
+
+			if err := p.Publish("sensors.temperature.1", "1-1", []byte("sample")); err != nil {
+				t.Fatal(err)
+			}
+			tt.fail(js)
+
+			select {
+			case <-js.resends:
+			case <-time.After(time.Second):
+				t.Fatal("message was not sent again")
+			}
+			js.mu.Lock()
+			defer js.mu.Unlock()
+			if len(js.resent) != 1 || js.resent[0] != "sample" {
+				t.Errorf("sent again %v, want the failed message once", js.resent)
+			}
+		})
+	}
+}
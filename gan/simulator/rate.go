@@ -0,0 +1,58 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+// Shortest interval between samples of a sensor
+const MIN_RATE = time.Millisecond
+
+// ValidateRate checks the publish rate and jitter of a sensor. The jitter cannot be greater than
+// half the rate, so samples never swap their order
+func ValidateRate(sensor entity.Sensor) error {
+	if sensor.Rate < MIN_RATE {
+		return fmt.Errorf("rate must be at least %v", MIN_RATE)
+	}
+
+	if sensor.Jitter < 0 {
+		return fmt.Errorf("jitter must not be negative")
+	}
+
+	if sensor.Jitter > sensor.Rate/2 {
+		return fmt.Errorf("jitter must not be greater than half the rate")
+	}
+
+	return nil
+}
+
+// rateSchedule gives the intervals between samples of a sensor. Every sample is moved a random
+// offset within the jitter from its nominal instant, so the rate holds on average and sensors
+// created at once do not publish in lockstep
+type rateSchedule struct {
+	rate   time.Duration
+	jitter time.Duration
+	rng    *rand.Rand
+	// Offset of the last sample from its nominal instant
+	offset time.Duration
+}
+
+func newRateSchedule(sensor entity.Sensor, rng *rand.Rand) *rateSchedule {
+	return &rateSchedule{rate: sensor.Rate, jitter: sensor.Jitter, rng: rng}
+}
+
+// This function returns the time to wait until the next sample
+func (s *rateSchedule) next() time.Duration {
+	if s.jitter <= 0 {
+		return s.rate
+	}
+
+	offset := time.Duration(s.rng.Int64N(int64(2*s.jitter)+1)) - s.jitter
+	wait := s.rate + offset - s.offset
+	s.offset = offset
+
+	return wait
+}
@@ -0,0 +1,67 @@
+package simulator
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+func TestValidateRate(t *testing.T) {
+	tests := []struct {
+		rate    time.Duration
+		jitter  time.Duration
+		wantErr bool
+	}{
+		{rate: time.Second},
+		{rate: MIN_RATE},
+		{rate: 100 * time.Millisecond, jitter: 50 * time.Millisecond},
+		{rate: MIN_RATE - 1, wantErr: true},
+		{rate: time.Second, jitter: -1, wantErr: true},
+		{rate: 100 * time.Millisecond, jitter: 50*time.Millisecond + 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateRate(entity.Sensor{Rate: tt.rate, Jitter: tt.jitter})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateRate(%v, %v) error = %v, want error %v", tt.rate, tt.jitter, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRateSchedule(t *testing.T) {
+	tests := []struct {
+		name   string
+		rate   time.Duration
+		jitter time.Duration
+	}{
+		{name: "without jitter", rate: 100 * time.Millisecond},
+		{name: "with jitter", rate: 100 * time.Millisecond, jitter: 10 * time.Millisecond},
+		{name: "max jitter", rate: 10 * time.Millisecond, jitter: 5 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRateSchedule(entity.Sensor{Rate: tt.rate, Jitter: tt.jitter}, rand.New(rand.NewPCG(3, 4)))
+
+			// Every sample stays within the jitter of its nominal instant, so the rate holds
+			// on average and samples never swap their order
+			var elapsed time.Duration
+			for i := 1; i <= 10000; i++ {
+				wait := s.next()
+				if wait < tt.rate-2*tt.jitter || wait > tt.rate+2*tt.jitter || wait < 0 {
+					t.Fatalf("sample %d: wait %v out of the jitter", i, wait)
+				}
+				if tt.jitter == 0 && wait != tt.rate {
+					t.Fatalf("sample %d: wait %v, want %v", i, wait, tt.rate)
+				}
+
+				elapsed += wait
+				if drift := elapsed - time.Duration(i)*tt.rate; drift < -tt.jitter || drift > tt.jitter {
+					t.Fatalf("sample %d: %v away from its nominal instant", i, drift)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+const (
+	CSV_FORMAT    = "csv"
+	NDJSON_FORMAT = "ndjson"
+)
+
+// DatasetSource gives access to the recorded datasets replayed by sensors
+type DatasetSource interface {
+	GetDatasetContent(ctx context.Context, id string) (format string, content []byte, err error)
+}
+
+// ParseDataset reads the (timestamp, value, unit) rows of a dataset. Timestamps can be RFC3339
+// strings or UNIX seconds, and they must be in chronological order. The unit is optional.
+// CSV files may have a header row
+func ParseDataset(format string, content []byte) ([]entity.DatasetSample, error) {
+	var samples []entity.DatasetSample
+	var err error
+
+	switch format {
+	case CSV_FORMAT:
+		samples, err = parseCSV(content)
+	case NDJSON_FORMAT:
+		samples, err = parseNDJSON(content)
+	default:
+		return nil, fmt.Errorf("unknown dataset format %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("dataset is empty")
+	}
+
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Timestamp.Before(samples[i-1].Timestamp) {
+			return nil, fmt.Errorf("row %d: timestamps are not in chronological order", i+1)
+		}
+	}
+
+	return samples, nil
+}
+
+func parseCSV(content []byte) ([]entity.DatasetSample, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var samples []entity.DatasetSample
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Skipping header
+		if row == 1 && strings.EqualFold(record[0], "timestamp") {
+			continue
+		}
+
+		if len(record) < 2 || len(record) > 3 {
+			return nil, fmt.Errorf("row %d: expected timestamp, value and unit columns", row)
+		}
+
+		timestamp, err := parseTimestamp(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+
+		value, err := strconv.ParseFloat(record[1], 32)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid value: %w", row, err)
+		}
+
+		sample := entity.DatasetSample{Timestamp: timestamp, Value: float32(value)}
+		if len(record) == 3 {
+			sample.Unit = record[2]
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, nil
+}
+
+func parseNDJSON(content []byte) ([]entity.DatasetSample, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var samples []entity.DatasetSample
+	for row := 1; scanner.Scan(); row++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var record struct {
+			Timestamp json.RawMessage `json:"timestamp"`
+			Value     *float32        `json:"value"`
+			Unit      string          `json:"unit"`
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+		if record.Timestamp == nil || record.Value == nil {
+			return nil, fmt.Errorf("row %d: timestamp and value are required", row)
+		}
+
+		timestamp, err := parseTimestamp(strings.Trim(string(record.Timestamp), `"`))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+
+		samples = append(samples, entity.DatasetSample{Timestamp: timestamp, Value: *record.Value, Unit: record.Unit})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// This function parses RFC3339 timestamps or UNIX seconds with optional fraction
+func parseTimestamp(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %s", s)
+	}
+
+	return t, nil
+}
+
+// Sample source which replays a dataset keeping its original timing
+type replaySource struct {
+	samples []entity.DatasetSample
+	// Default unit for rows without unit
+	unit  string
+	scale float64
+	loop  bool
+	pos   int
+}
+
+func newReplaySource(samples []entity.DatasetSample, unit string, replay entity.Replay) *replaySource {
+	scale := replay.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+
+	return &replaySource{samples: samples, unit: unit, scale: scale, loop: replay.Loop}
+}
+
+func (r *replaySource) next(t time.Time) (float32, string, time.Duration, bool) {
+	sample := r.samples[r.pos]
+	unit := sample.Unit
+	if unit == "" {
+		unit = r.unit
+	}
+
+	var wait time.Duration
+	r.pos++
+	if r.pos < len(r.samples) {
+		wait = r.samples[r.pos].Timestamp.Sub(sample.Timestamp)
+	} else {
+		if !r.loop {
+			return sample.Value, unit, 0, false
+		}
+
+		// The dataset starts again after the mean interval between rows, or after a second if
+		// all the rows have the same timestamp
+		r.pos = 0
+		wait = time.Second
+		if n := len(r.samples); n > 1 && r.samples[n-1].Timestamp.After(r.samples[0].Timestamp) {
+			wait = r.samples[n-1].Timestamp.Sub(r.samples[0].Timestamp) / time.Duration(n-1)
+		}
+	}
+
+	return sample.Value, unit, time.Duration(float64(wait) / r.scale), true
+}
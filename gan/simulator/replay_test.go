@@ -0,0 +1,80 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+func TestParseDataset(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		want    []entity.DatasetSample
+		wantErr bool
+	}{
+		{
+			name:    "csv with header and units",
+			format:  CSV_FORMAT,
+			content: "timestamp,value,unit\n2024-05-01T00:00:00Z,21.5,celsius\n2024-05-01T00:00:01Z,22,\n",
+			want: []entity.DatasetSample{
+				{Timestamp: start, Value: 21.5, Unit: "celsius"},
+				{Timestamp: start.Add(time.Second), Value: 22},
+			},
+		},
+		{
+			name:    "csv with UNIX seconds",
+			format:  CSV_FORMAT,
+			content: "1714521600, 1\n1714521600.5, 2\n",
+			want: []entity.DatasetSample{
+				{Timestamp: start, Value: 1},
+				{Timestamp: start.Add(500 * time.Millisecond), Value: 2},
+			},
+		},
+		{
+			name:    "ndjson with blank lines",
+			format:  NDJSON_FORMAT,
+			content: "{\"timestamp\": \"2024-05-01T00:00:00Z\", \"value\": 3, \"unit\": \"%\"}\n\n{\"timestamp\": 1714521601, \"value\": 4}\n",
+			want: []entity.DatasetSample{
+				{Timestamp: start, Value: 3, Unit: "%"},
+				{Timestamp: start.Add(time.Second), Value: 4},
+			},
+		},
+		{name: "unknown format", format: "xml", content: "<x/>", wantErr: true},
+		{name: "empty", format: CSV_FORMAT, content: "timestamp,value\n", wantErr: true},
+		{name: "missing value", format: CSV_FORMAT, content: "1714521600\n", wantErr: true},
+		{name: "invalid value", format: CSV_FORMAT, content: "1714521600,warm\n", wantErr: true},
+		{name: "invalid timestamp", format: CSV_FORMAT, content: "yesterday,1\n", wantErr: true},
+		{name: "not chronological", format: CSV_FORMAT, content: "1714521601,1\n1714521600,2\n", wantErr: true},
+		{name: "ndjson without value", format: NDJSON_FORMAT, content: "{\"timestamp\": 1714521600}\n", wantErr: true},
+		{name: "invalid ndjson", format: NDJSON_FORMAT, content: "{\"timestamp\": \n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDataset(tt.format, []byte(tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseDataset() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDataset() error = %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseDataset() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Timestamp.Equal(tt.want[i].Timestamp) || got[i].Value != tt.want[i].Value || got[i].Unit != tt.want[i].Unit {
+					t.Errorf("sample %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package simulator
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// scheduler sends the samples of every sensor when they are due. Pending samples are kept in a
+// heap ordered by due instant, so a single goroutine waits for the earliest one and hands it to a
+// bounded pool of workers
+type scheduler struct {
+	clock Clock
+	queue simulationQueue
+	// Closed and replaced when a sample earlier than the rest of the queue is added
+	wake chan struct{}
+	jobs chan *simulation
+	quit chan struct{}
+	// It is called with the delay of every sample before it is sent. Nil if nobody is measuring
+	onTick func(late time.Duration)
+	mu     sync.Mutex
+}
+
+// This function starts a scheduler whose workers send the samples with tick and return when
+// the next sample of the sensor is due
+func newScheduler(clock Clock, workers int, tick func(sim *simulation) (time.Time, bool),
+	onTick func(late time.Duration)) *scheduler {
+	s := &scheduler{
+		clock:  clock,
+		wake:   make(chan struct{}),
+		jobs:   make(chan *simulation, workers),
+		quit:   make(chan struct{}),
+		onTick: onTick,
+	}
+
+	for range workers {
+		go s.work(tick)
+	}
+	go s.run()
+
+	return s
+}
+
+// This function queues the next sample of a sensor
+func (s *scheduler) schedule(sim *simulation, due time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sim.stopped {
+		return
+	}
+
+	sim.due = due
+	heap.Push(&s.queue, sim)
+
+	if sim.index == 0 {
+		s.wakeUp()
+	}
+}
+
+// This function removes a sensor from the scheduler. A sample being sent is not cancelled, but
+// the sensor is not scheduled again
+func (s *scheduler) remove(sim *simulation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sim.stopped = true
+	if sim.index >= 0 {
+		heap.Remove(&s.queue, sim.index)
+	}
+}
+
+// This function stops the scheduler and its workers
+func (s *scheduler) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	close(s.quit)
+	s.wakeUp()
+}
+
+// It must be called holding the lock
+func (s *scheduler) wakeUp() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// Scheduler go rutine. It waits for the earliest sample and dispatches it to the workers
+func (s *scheduler) run() {
+	defer close(s.jobs)
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		default:
+		}
+
+		s.mu.Lock()
+		wake := s.wake
+
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			<-wake
+			continue
+		}
+
+		next := s.queue[0]
+		due := next.due
+
+		if !due.After(s.clock.Now()) {
+			heap.Pop(&s.queue)
+			s.mu.Unlock()
+
+			select {
+			case s.jobs <- next:
+			case <-s.quit:
+				return
+			}
+			continue
+		}
+		s.mu.Unlock()
+
+		if s.clock.SleepUntil(due, wake) {
+			continue
+		}
+
+		select {
+		case <-wake:
+			// The queue has changed while sleeping
+		default:
+			// The sample is beyond the end of the simulated time
+			s.mu.Lock()
+			if next.index >= 0 && next.due.Equal(due) {
+				heap.Remove(&s.queue, next.index)
+				log.Infof("sensor %s stopped", next.sensor.ID)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Worker go rutine. It sends the due samples and schedules the next ones
+func (s *scheduler) work(tick func(sim *simulation) (time.Time, bool)) {
+	for sim := range s.jobs {
+		if s.onTick != nil {
+			s.onTick(s.clock.Now().Sub(sim.due))
+		}
+
+		next, more := tick(sim)
+		if more {
+			s.schedule(sim, next)
+		}
+	}
+}
+
+// simulationQueue is a min-heap of sensors ordered by the instant of their next sample
+type simulationQueue []*simulation
+
+func (q simulationQueue) Len() int {
+	return len(q)
+}
+
+func (q simulationQueue) Less(i, j int) bool {
+	return q[i].due.Before(q[j].due)
+}
+
+func (q simulationQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *simulationQueue) Push(x any) {
+	sim := x.(*simulation)
+	sim.index = len(*q)
+	*q = append(*q, sim)
+}
+
+func (q *simulationQueue) Pop() any {
+	old := *q
+	n := len(old)
+	sim := old[n-1]
+	old[n-1] = nil
+	sim.index = -1
+	*q = old[:n-1]
+	return sim
+}
@@ -0,0 +1,117 @@
+package simulator
+
+import (
+	"container/heap"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/config"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+func TestSimulationQueue(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	start := time.Unix(0, 0)
+
+	var q simulationQueue
+	sims := make([]*simulation, 100)
+	for i := range sims {
+		sims[i] = &simulation{due: start.Add(time.Duration(rng.IntN(1000)) * time.Millisecond), index: -1}
+		heap.Push(&q, sims[i])
+	}
+
+	// Removed sensors leave the queue wherever they are, so their indexes must be kept
+	for _, sim := range sims[:30] {
+		heap.Remove(&q, sim.index)
+		if sim.index != -1 {
+			t.Fatalf("removed sensor has index %d", sim.index)
+		}
+	}
+	for i, sim := range q {
+		if sim.index != i {
+			t.Fatalf("sensor at %d has index %d", i, sim.index)
+		}
+	}
+
+	var last time.Time
+	for n := 0; q.Len() > 0; n++ {
+		sim := heap.Pop(&q).(*simulation)
+		if sim.due.Before(last) {
+			t.Fatalf("sample %d due at %v popped after %v", n, sim.due, last)
+		}
+		last = sim.due
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	epoch := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	clock, err := NewClock(config.ClockConfig{
+		Mode:  FAST_CLOCK,
+		Epoch: epoch.Format(time.RFC3339),
+		Until: epoch.Add(time.Minute).Format(time.RFC3339),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	ticks := make(map[string]int)
+	done := make(chan struct{})
+	rates := map[string]time.Duration{"a": time.Second, "b": 2 * time.Second, "c": 7 * time.Second}
+
+	tick := func(sim *simulation) (time.Time, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		ticks[sim.sensor.ID]++
+		return sim.due.Add(rates[sim.sensor.ID]), true
+	}
+	s := newScheduler(clock, 2, tick, nil)
+	defer s.stop()
+
+	removed := &simulation{sensor: entity.Sensor{ID: "removed"}, index: -1}
+	s.schedule(removed, epoch.Add(30*time.Second))
+	s.remove(removed)
+
+	for id := range rates {
+		s.schedule(&simulation{sensor: entity.Sensor{ID: id}, index: -1}, epoch)
+	}
+
+	// Sensors stop once their next sample is beyond the end of the simulated time
+	want := make(map[string]int)
+	for id, rate := range rates {
+		want[id] = int(time.Minute/rate) + 1
+	}
+	go func() {
+		defer close(done)
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			mu.Lock()
+			sent := ticks["a"] >= want["a"] && ticks["b"] >= want["b"] && ticks["c"] >= want["c"]
+			mu.Unlock()
+			if sent {
+				return
+			}
+		}
+	}()
+	<-done
+	// Samples beyond the end would be sent by now
+	time.Sleep(20 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for id := range rates {
+		if ticks[id] != want[id] {
+			t.Errorf("sensor %s sent %d samples, want %d", id, ticks[id], want[id])
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) != 0 {
+		t.Errorf("%d sensors still queued after the end", len(s.queue))
+	}
+	if ticks["removed"] != 0 {
+		t.Errorf("removed sensor sent %d samples", ticks["removed"])
+	}
+}
@@ -1,45 +1,225 @@
 package simulator
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
 	"math/rand/v2"
+	"reflect"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/AntonioBR9998/go-nats-simulator/gan/config"
 	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
-	"github.com/nats-io/nats.go"
 	log "github.com/sirupsen/logrus"
 )
 
+// Publisher sends the samples of the sensors. Messages with the same ID are the same message
+type Publisher interface {
+	Publish(subject string, msgID string, data []byte) error
+}
+
 // It manages actives sensors
 type Manager struct {
-	natsClient *nats.Conn
-	simulators map[string]chan struct{}
+	publisher  Publisher
+	subjects   *SubjectTemplate
+	conf       config.SimulatorConfig
+	clock      Clock
+	datasets   DatasetSource
+	scheduler  *scheduler
+	simulators map[string]*simulation
 	mu         sync.Mutex
+	// Settings of the running sensors, with their own lock so readers, like the live metric
+	// stream, never wait for the sensors being started
+	sensors   map[string]entity.Sensor
+	sensorsMu sync.RWMutex
+	// Last message number of every sensor which has run. It is kept when the sensor is restarted
+	// or deleted, and numbers start from the instant the manager was created, so message IDs are
+	// not reused while the stream remembers them. Guarded by the lock
+	sequences    map[string]*atomic.Uint64
+	sequenceBase uint64
+	closeOnce    sync.Once
+}
+
+// A running sensor and the config it was started with
+type simulation struct {
+	sensor  entity.Sensor
+	subject string
+	source  sampleSource
+	faults  *faultInjector
+	// Message number of the sensor, shared with the previous simulations of the sensor
+	sequence *atomic.Uint64
+	// Instant of the next sample, position in the scheduler queue (-1 if it is not queued) and
+	// whether the sensor has been removed. They are guarded by the scheduler lock
+	due     time.Time
+	index   int
+	stopped bool
+}
+
+// sampleSource gives the values of a sensor
+type sampleSource interface {
+	// next returns the value and unit of the sample taken at instant t and the time to wait until
+	// the next sample. It returns false if there are no more samples after this one
+	next(t time.Time) (value float32, unit string, wait time.Duration, more bool)
+}
+
+// Sample source which generates values at the rate of the sensor
+type generatorSource struct {
+	generator Generator
+	bounds    *valueBounds
+	unit      string
+	schedule  *rateSchedule
+}
+
+func (g *generatorSource) next(t time.Time) (float32, string, time.Duration, bool) {
+	return g.bounds.apply(g.generator.Next(t)), g.unit, g.schedule.next(), true
+}
+
+func NewManager(publisher Publisher, subjects *SubjectTemplate, conf config.SimulatorConfig, clock Clock,
+	datasets DatasetSource) *Manager {
+	return newManager(publisher, subjects, conf, clock, datasets, nil)
+}
+
+// onTick is called with the delay of every sample before it is sent
+func newManager(publisher Publisher, subjects *SubjectTemplate, conf config.SimulatorConfig, clock Clock,
+	datasets DatasetSource, onTick func(late time.Duration)) *Manager {
+	m := &Manager{
+		publisher:    publisher,
+		subjects:     subjects,
+		conf:         conf,
+		clock:        clock,
+		datasets:     datasets,
+		simulators:   make(map[string]*simulation),
+		sensors:      make(map[string]entity.Sensor),
+		sequences:    make(map[string]*atomic.Uint64),
+		sequenceBase: uint64(time.Now().UnixMicro()),
+	}
+
+	workers := conf.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	m.scheduler = newScheduler(clock, workers, m.tick, onTick)
+
+	return m
+}
+
+// This function stops every sensor and the scheduler. Calling it again does nothing
+func (m *Manager) Close() {
+	m.closeOnce.Do(func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		for id := range m.simulators {
+			m.stop(id)
+		}
+		m.scheduler.stop()
+	})
+}
+
+// This function returns a source of random values of a sensor. Every purpose (generator, faults...)
+// has its own stream. A sensor seed gives the same sequences to every sensor using it, while the
+// global seed gives different sequences to each sensor ID. Without seeds they are not reproducible
+func (m *Manager) newRand(sensor entity.Sensor, purpose string) *rand.Rand {
+	h := fnv.New64a()
+
+	if sensor.Seed != nil {
+		h.Write([]byte(purpose))
+		return rand.New(rand.NewPCG(uint64(*sensor.Seed), h.Sum64()))
+	}
+
+	if m.conf.Seed != 0 {
+		h.Write([]byte(sensor.ID + purpose))
+		return rand.New(rand.NewPCG(uint64(m.conf.Seed), h.Sum64()))
+	}
+
+	return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
 }
 
-func NewManager(natsClient *nats.Conn) *Manager {
-	return &Manager{
-		natsClient: natsClient,
-		simulators: make(map[string]chan struct{}),
+// This function builds the state of a sensor simulator. Sensors with replay settings replay their
+// dataset, the rest of them use their generator
+func (m *Manager) newSimulation(sensor entity.Sensor) (*simulation, error) {
+	var source sampleSource
+	if sensor.Replay != nil {
+		format, content, err := m.datasets.GetDatasetContent(context.Background(), sensor.Replay.DatasetID)
+		if err != nil {
+			return nil, err
+		}
+
+		samples, err := ParseDataset(format, content)
+		if err != nil {
+			return nil, err
+		}
+
+		source = newReplaySource(samples, unitOf(sensor.Type), *sensor.Replay)
+	} else {
+		generator, err := NewGenerator(sensor.Type, sensor.Generator, m.newRand(sensor, "generator"))
+		if err != nil {
+			return nil, err
+		}
+
+		source = &generatorSource{
+			generator: generator,
+			bounds:    newValueBounds(sensor, m.newRand(sensor, "bounds")),
+			unit:      unitOf(sensor.Type),
+			schedule:  newRateSchedule(sensor, m.newRand(sensor, "jitter")),
+		}
 	}
+
+	return &simulation{
+		sensor:  sensor,
+		subject: m.subjects.Subject(sensor),
+		source:  source,
+		faults:  newFaultInjector(sensor.Faults, m.newRand(sensor, "faults")),
+		index:   -1,
+	}, nil
 }
 
-// This function initializes a sensor simulator
-func (m *Manager) Start(id string, typ string, rate int) {
+// This function initializes a sensor simulator. If the sensor is already running a newer version,
+// it is kept
+func (m *Manager) Start(sensor entity.Sensor) {
+	sim, err := m.newSimulation(sensor)
+	if err != nil {
+		log.Errorf("sensor with ID %s cannot be started: %v", sensor.ID, err)
+		return
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Checking if a sensor with this ID exists and deleting it
-	if _, exists := m.simulators[id]; exists {
+	m.start(sim)
+}
+
+// It must be called holding the lock
+func (m *Manager) start(sim *simulation) {
+	id := sim.sensor.ID
+
+	// Checking if a sensor with this ID exists and deleting it. Simulations are built without the
+	// lock, so a newer version may have been started in the meantime
+	if running, exists := m.simulators[id]; exists {
+		if running.sensor.Version > sim.sensor.Version {
+			log.Debugf("sensor with ID %s is already running version %d", id, running.sensor.Version)
+			return
+		}
 		log.Warnf("replacing sensor with ID: %s", id)
-		m.Stop(id)
+		m.stop(id)
+	}
+
+	sequence, exists := m.sequences[id]
+	if !exists {
+		sequence = &atomic.Uint64{}
+		sequence.Store(m.sequenceBase)
+		m.sequences[id] = sequence
 	}
+	sim.sequence = sequence
 
-	stopCh := make(chan struct{})
-	m.simulators[id] = stopCh
+	m.simulators[id] = sim
+	m.setSensor(sim.sensor)
 
-	go m.run(id, typ, rate, stopCh)
+	m.scheduler.schedule(sim, m.clock.Now())
 	log.Infof("new sensor running with ID: %s", id)
 }
 
@@ -48,60 +228,173 @@ func (m *Manager) Stop(id string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	stopCh, exists := m.simulators[id]
+	m.stop(id)
+}
+
+// It must be called holding the lock
+func (m *Manager) stop(id string) {
+	sim, exists := m.simulators[id]
 	if !exists {
 		return
 	}
-	close(stopCh)
+	m.scheduler.remove(sim)
 	delete(m.simulators, id)
+
+	m.sensorsMu.Lock()
+	delete(m.sensors, id)
+	m.sensorsMu.Unlock()
+
 	log.Infof("sensor with ID %s has been deleted", id)
 }
 
-// Sensor go rutine
-func (m *Manager) run(id, typ string, rate int, stopCh <-chan struct{}) {
-	subject := "sensors"
+// This function replaces the fault profile of a running sensor without restarting it. The sensor
+// takes the version of the update, unless it already runs a newer one
+func (m *Manager) SetFaults(id string, faults entity.FaultProfile, updatedAt int64, version int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	for {
-		select {
-		case <-stopCh:
-			log.Infof("sensor %s stopped", id)
-			return
-		default:
-			value, unit := m.generateValue(typ)
-
-			event := entity.Metric{
-				SensorID:  id,
-				Value:     value,
-				Unit:      unit,
-				Timestamp: time.Now().Unix(),
-			}
-
-			data, _ := json.Marshal(event)
-			if err := m.natsClient.Publish(subject, data); err != nil {
-				log.Errorf("error sending data to NATS: %v", err)
-			}
-
-			time.Sleep(time.Duration(rate) * time.Second)
+	sim, exists := m.simulators[id]
+	if !exists || sim.sensor.Version > version {
+		return
+	}
+
+	sim.faults.setProfile(faults)
+	sim.sensor.Faults = faults
+	sim.sensor.UpdatedAt = updatedAt
+	sim.sensor.Version = version
+	m.setSensor(sim.sensor)
+	log.Infof("faults of sensor with ID %s have been updated", id)
+}
+
+// This function tells whether the values of a sensor change with its new settings, so its
+// simulation must be started again. Alias and faults are changed without restarting it, and the
+// version and update time change with every update
+func NeedsRestart(old entity.Sensor, updated entity.Sensor) bool {
+	old.Alias, updated.Alias = "", ""
+	old.Faults, updated.Faults = entity.FaultProfile{}, entity.FaultProfile{}
+	old.UpdatedAt, updated.UpdatedAt = 0, 0
+	old.Version, updated.Version = 0, 0
+
+	return !reflect.DeepEqual(old, updated)
+}
+
+// This function replaces the settings of a running sensor which do not need a restart (see
+// NeedsRestart). Settings older than the running ones are ignored
+func (m *Manager) Update(sensor entity.Sensor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sim, exists := m.simulators[sensor.ID]
+	if !exists || sim.sensor.Version > sensor.Version {
+		return
+	}
+
+	sim.faults.setProfile(sensor.Faults)
+	sim.sensor.Alias = sensor.Alias
+	sim.sensor.Faults = sensor.Faults
+	sim.sensor.UpdatedAt = sensor.UpdatedAt
+	sim.sensor.Version = sensor.Version
+	m.setSensor(sim.sensor)
+	log.Infof("sensor with ID %s has been updated", sensor.ID)
+}
+
+// This function returns the settings of a running sensor. It does not wait for the sensors being
+// started or stopped
+func (m *Manager) Sensor(id string) (entity.Sensor, bool) {
+	m.sensorsMu.RLock()
+	defer m.sensorsMu.RUnlock()
+
+	sensor, exists := m.sensors[id]
+	return sensor, exists
+}
+
+// It must be called holding the lock
+func (m *Manager) setSensor(sensor entity.Sensor) {
+	m.sensorsMu.Lock()
+	defer m.sensorsMu.Unlock()
+
+	m.sensors[sensor.ID] = sensor
+}
+
+// This function makes the running sensors match the given list. Missing sensors are started,
+// sensors whose version differs from the running one are replaced and the rest of running sensors
+// are stopped. Simulations are built without holding the lock, since replays load their datasets
+func (m *Manager) Sync(sensors []*entity.Sensor) {
+	var changed []*entity.Sensor
+	m.mu.Lock()
+	for _, sensor := range sensors {
+		if sim, exists := m.simulators[sensor.ID]; !exists || sim.sensor.Version != sensor.Version {
+			changed = append(changed, sensor)
+		}
+	}
+	m.mu.Unlock()
+
+	sims := make([]*simulation, 0, len(changed))
+	for _, sensor := range changed {
+		sim, err := m.newSimulation(*sensor)
+		if err != nil {
+			log.Errorf("sensor with ID %s cannot be started: %v", sensor.ID, err)
+			continue
+		}
+		sims = append(sims, sim)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, sim := range sims {
+		// The sensor may have been started with these settings in the meantime
+		if running, exists := m.simulators[sim.sensor.ID]; exists && running.sensor.Version == sim.sensor.Version {
+			continue
+		}
+		m.start(sim)
+	}
+
+	wanted := make(map[string]bool, len(sensors))
+	for _, sensor := range sensors {
+		wanted[sensor.ID] = true
+	}
+	for id := range m.simulators {
+		if !wanted[id] {
+			m.stop(id)
 		}
 	}
 }
 
-// This function generates a random value for every type of sensor
-func (m *Manager) generateValue(typ string) (float32, string) {
-	switch typ {
-	case "temperature":
-		// Range of temperature: [-30, 60)
-		value := rand.Float32()*(float32(60)-float32(-30)) + float32(-30)
-		return value, "celsius"
-	case "pressure":
-		// Range of pressure: [700, 820)
-		value := rand.Float32()*(float32(820)-float32(700)) + float32(700)
-		return value, "mmHg"
-	case "humidity":
-		// Range of humidity: [-10, 120)
-		value := rand.Float32()*(float32(120)-float32(-10)) + float32(-10)
-		return value, "percentage"
-	default:
-		return float32(0), ""
+// This function sends the due sample of a sensor. It returns when the next sample is due, or false
+// if there are no more samples. Samples are stamped with the simulator clock
+func (m *Manager) tick(sim *simulation) (time.Time, bool) {
+	id := sim.sensor.ID
+	due := sim.due
+
+	value, unit, wait, more := sim.source.next(due)
+	sample := sim.faults.apply(due, value)
+
+	var data []byte
+	if sample.garbage {
+		data = sim.faults.garbage(id, due)
+	} else {
+		data, _ = json.Marshal(entity.Metric{
+			SensorID:  id,
+			Value:     sample.value,
+			Unit:      unit,
+			Timestamp: due.UnixMilli(),
+		})
 	}
+
+	// Every message is identified by the sensor and its next number, so the stream drops it if the
+	// publisher sends it twice. Duplicated copies have their own number
+	for range sample.copies {
+		msgID := fmt.Sprintf("%s-%d", id, sim.sequence.Add(1))
+		if err := m.publisher.Publish(sim.subject, msgID, data); err != nil {
+			log.Errorf("error sending data to NATS: %v", err)
+		}
+	}
+
+	if !more {
+		log.Infof("sensor %s has no more samples", id)
+		return time.Time{}, false
+	}
+
+	return due.Add(wait), true
 }
@@ -0,0 +1,391 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/config"
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+func TestNeedsRestart(t *testing.T) {
+	stored := entity.Sensor{
+		ID:           "8cf3030f-2206-4fcb-8c42-d0eb70e197ab",
+		Type:         "temperature",
+		Alias:        "Kitchen",
+		MaxThreshold: 30,
+		MinThreshold: 10,
+		UpdatedAt:    1700000000,
+		Version:      3,
+	}
+
+	tests := []struct {
+		name   string
+		change func(sensor *entity.Sensor)
+		want   bool
+	}{
+		{name: "only version and update time", change: func(sensor *entity.Sensor) {}, want: false},
+		{name: "alias", change: func(sensor *entity.Sensor) { sensor.Alias = "Living room" }, want: false},
+		{name: "faults", change: func(sensor *entity.Sensor) { sensor.Faults.Dropout = &entity.Fault{Enabled: true, Probability: 0.5} }, want: false},
+		{name: "thresholds", change: func(sensor *entity.Sensor) { sensor.MaxThreshold = 40 }, want: true},
+		{name: "generator", change: func(sensor *entity.Sensor) { sensor.Generator.Type = SINE_GENERATOR }, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := stored
+			updated.UpdatedAt++
+			updated.Version++
+			tt.change(&updated)
+
+			if got := NeedsRestart(stored, updated); got != tt.want {
+				t.Errorf("NeedsRestart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaleVersionsAreIgnored(t *testing.T) {
+	subjects, _ := NewSubjectTemplate(DEFAULT_SUBJECT_TEMPLATE)
+	m := NewManager(discardPublisher{}, subjects, config.SimulatorConfig{Workers: 1}, &realClock{}, nil)
+	defer m.Close()
+
+	sensor := entity.Sensor{
+		ID:        "8cf3030f-2206-4fcb-8c42-d0eb70e197ab",
+		Type:      "temperature",
+		Alias:     "Kitchen",
+		Rate:      time.Hour,
+		Generator: entity.Generator{Type: UNIFORM_GENERATOR},
+		Version:   3,
+	}
+	m.Start(sensor)
+
+	tests := []struct {
+		name    string
+		apply   func(sensor entity.Sensor)
+		alias   string
+		version int64
+		want    string
+	}{
+		{name: "older start", apply: m.Start, alias: "Stale", version: 2, want: "Kitchen"},
+		{name: "older update", apply: m.Update, alias: "Stale", version: 1, want: "Kitchen"},
+		{name: "newer update", apply: m.Update, alias: "Living room", version: 4, want: "Living room"},
+		{name: "newer start", apply: m.Start, alias: "Bedroom", version: 5, want: "Bedroom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update := sensor
+			update.Alias = tt.alias
+			update.Version = tt.version
+			tt.apply(update)
+
+			if got, _ := m.Sensor(sensor.ID); got.Alias != tt.want {
+				t.Errorf("running alias = %s, want %s", got.Alias, tt.want)
+			}
+		})
+	}
+}
+
+// recordingPublisher keeps the IDs of the published messages
+type recordingPublisher struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (p *recordingPublisher) Publish(subject string, msgID string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ids = append(p.ids, msgID)
+	return nil
+}
+
+func (p *recordingPublisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Clone(p.ids)
+}
+
+func TestMessageIDs(t *testing.T) {
+	publisher := &recordingPublisher{}
+	subjects, _ := NewSubjectTemplate(DEFAULT_SUBJECT_TEMPLATE)
+	m := NewManager(publisher, subjects, config.SimulatorConfig{Workers: 1, Seed: 1}, &realClock{}, nil)
+	defer m.Close()
+
+	// Every start sends a sample at once, at the same instant for a seeded sensor with the fast
+	// clock. A duplicated sample is sent twice
+	sensor := entity.Sensor{
+		ID:        "8cf3030f-2206-4fcb-8c42-d0eb70e197ab",
+		Type:      "temperature",
+		Rate:      time.Hour,
+		Generator: entity.Generator{Type: UNIFORM_GENERATOR},
+		Version:   1,
+	}
+	duplicated := sensor
+	duplicated.Version = 2
+	duplicated.Faults.Duplicate = &entity.Fault{Enabled: true, Probability: 1}
+
+	steps := []struct {
+		apply func()
+		// Messages sent by the sensor so far
+		want int
+	}{
+		{apply: func() { m.Start(sensor) }, want: 1},
+		{apply: func() { m.Start(duplicated) }, want: 3},
+		{apply: func() { m.Stop(sensor.ID) }, want: 3},
+		{apply: func() { m.Start(sensor) }, want: 4},
+	}
+	for _, step := range steps {
+		step.apply()
+		waitFor(t, func() bool { return len(publisher.published()) == step.want })
+	}
+
+	ids := publisher.published()
+	base := m.sequenceBase
+	for i, id := range ids {
+		if wantID := fmt.Sprintf("%s-%d", sensor.ID, base+uint64(i)+1); id != wantID {
+			t.Errorf("message %d has ID %s, want %s", i, id, wantID)
+		}
+	}
+}
+
+// This function waits until cond is true
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met after 1s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSyncComparesVersions(t *testing.T) {
+	publisher := &recordingPublisher{}
+	subjects, _ := NewSubjectTemplate(DEFAULT_SUBJECT_TEMPLATE)
+	m := NewManager(publisher, subjects, config.SimulatorConfig{Workers: 1}, &realClock{}, nil)
+	defer m.Close()
+
+	// Every start sends a sample at once. Updates in the same second have the same update time
+	sensor := entity.Sensor{
+		ID:        "8cf3030f-2206-4fcb-8c42-d0eb70e197ab",
+		Type:      "temperature",
+		Alias:     "Kitchen",
+		Rate:      time.Hour,
+		Generator: entity.Generator{Type: UNIFORM_GENERATOR},
+		UpdatedAt: 1700000000,
+		Version:   1,
+	}
+	edited := sensor
+	edited.Alias = "Living room"
+	edited.Version = 2
+	faulty := edited
+	faulty.Faults.Dropout = &entity.Fault{Enabled: true, Probability: 0.1}
+	faulty.Version = 3
+
+	steps := []struct {
+		name  string
+		apply func()
+		want  entity.Sensor
+		// Samples sent so far, one per start
+		samples int
+	}{
+		{name: "start", apply: func() { m.Sync([]*entity.Sensor{&sensor}) }, want: sensor, samples: 1},
+		{name: "edit in the same second", apply: func() { m.Sync([]*entity.Sensor{&edited}) }, want: edited, samples: 2},
+		{name: "same version", apply: func() { m.Sync([]*entity.Sensor{&edited}) }, want: edited, samples: 2},
+		{name: "faults", apply: func() { m.SetFaults(faulty.ID, faulty.Faults, faulty.UpdatedAt, faulty.Version) }, want: faulty, samples: 2},
+		{name: "faults already applied", apply: func() { m.Sync([]*entity.Sensor{&faulty}) }, want: faulty, samples: 2},
+		{name: "older faults", apply: func() { m.SetFaults(faulty.ID, entity.FaultProfile{}, faulty.UpdatedAt, 2) }, want: faulty, samples: 2},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			step.apply()
+
+			got, ok := m.Sensor(sensor.ID)
+			if !ok || got.Version != step.want.Version || got.Alias != step.want.Alias || (got.Faults.Dropout == nil) != (step.want.Faults.Dropout == nil) {
+				t.Errorf("running sensor = %+v, %v, want %+v", got, ok, step.want)
+			}
+
+			time.Sleep(20 * time.Millisecond)
+			if n := len(publisher.published()); n != step.samples {
+				t.Errorf("samples sent = %d, want %d", n, step.samples)
+			}
+		})
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	subjects, _ := NewSubjectTemplate(DEFAULT_SUBJECT_TEMPLATE)
+	m := NewManager(discardPublisher{}, subjects, config.SimulatorConfig{Workers: 1}, &realClock{}, nil)
+
+	m.Close()
+	m.Close()
+}
+
+// blockingDatasets holds every dataset load until it is released
+type blockingDatasets struct {
+	loading chan struct{}
+	release chan struct{}
+}
+
+func (d *blockingDatasets) GetDatasetContent(ctx context.Context, id string) (string, []byte, error) {
+	d.loading <- struct{}{}
+	<-d.release
+	return CSV_FORMAT, []byte("timestamp,value\n0,1\n1,2\n"), nil
+}
+
+func TestSyncLoadsDatasetsWithoutLock(t *testing.T) {
+	datasets := &blockingDatasets{loading: make(chan struct{}), release: make(chan struct{})}
+	subjects, _ := NewSubjectTemplate(DEFAULT_SUBJECT_TEMPLATE)
+	m := NewManager(discardPublisher{}, subjects, config.SimulatorConfig{Workers: 1}, &realClock{}, datasets)
+	defer m.Close()
+
+	running := entity.Sensor{
+		ID:        "3f1e4b52-9d0a-4c1b-a6f1-0d2c8e7b5a90",
+		Type:      "temperature",
+		Rate:      time.Second,
+		Generator: entity.Generator{Type: UNIFORM_GENERATOR},
+		UpdatedAt: 1,
+	}
+	replay := entity.Sensor{
+		ID:        "8cf3030f-2206-4fcb-8c42-d0eb70e197ab",
+		Type:      "temperature",
+		Replay:    &entity.Replay{DatasetID: "c0a80121-7ac0-4e1c-9a7f-2c3e4d5f6a7b", Loop: true},
+		UpdatedAt: 1,
+	}
+	m.Start(running)
+
+	synced := make(chan struct{})
+	go func() {
+		m.Sync([]*entity.Sensor{&running, &replay})
+		close(synced)
+	}()
+	<-datasets.loading
+
+	// The manager is not locked while the dataset is loaded
+	update := running
+	update.Alias = "Kitchen"
+	updated := make(chan struct{})
+	go func() {
+		m.Update(update)
+		close(updated)
+	}()
+	select {
+	case <-updated:
+	case <-time.After(time.Second):
+		t.Fatal("Update() waited for the dataset to be loaded")
+	}
+
+	close(datasets.release)
+	<-synced
+	for _, sensor := range []entity.Sensor{update, replay} {
+		if got, ok := m.Sensor(sensor.ID); !ok || got.Alias != sensor.Alias {
+			t.Errorf("Sensor(%s) = %+v, %v, want it running", sensor.ID, got, ok)
+		}
+	}
+}
+
+// payloadPublisher keeps the payloads of the published messages in order
+type payloadPublisher struct {
+	payloads [][]byte
+}
+
+func (p *payloadPublisher) Publish(subject string, msgID string, data []byte) error {
+	p.payloads = append(p.payloads, data)
+	return nil
+}
+
+// This function runs the simulation of a sensor without the scheduler and returns the payloads of
+// its first samples
+func simulatePayloads(t *testing.T, conf config.SimulatorConfig, sensor entity.Sensor, samples int) [][]byte {
+	t.Helper()
+
+	publisher := &payloadPublisher{}
+	subjects, _ := NewSubjectTemplate(DEFAULT_SUBJECT_TEMPLATE)
+	m := NewManager(publisher, subjects, conf, &realClock{}, nil)
+	defer m.Close()
+
+	sim, err := m.newSimulation(sensor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.sequence = &atomic.Uint64{}
+
+	due := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for range samples {
+		sim.due = due
+		next, more := m.tick(sim)
+		if !more {
+			break
+		}
+		due = next
+	}
+
+	return publisher.payloads
+}
+
+func TestSeededSimulationsAreReproducible(t *testing.T) {
+	crossingRate := 0.2
+	seed := int64(42)
+	fault := func(magnitude float64) *entity.Fault {
+		return &entity.Fault{Enabled: true, Probability: 0.05, Duration: 2, Magnitude: magnitude}
+	}
+	faults := entity.FaultProfile{
+		Dropout:   fault(0),
+		StuckAt:   fault(0),
+		Spike:     fault(10),
+		Drift:     fault(0.5),
+		Garbage:   fault(0),
+		Duplicate: fault(0),
+	}
+
+	sensors := []entity.Sensor{
+		{Type: "temperature", Generator: entity.Generator{Type: UNIFORM_GENERATOR}, MinThreshold: 0, MaxThreshold: 30, ThresholdCrossingRate: &crossingRate},
+		{Type: "humidity", Generator: entity.Generator{Type: RANDOM_WALK_GENERATOR}, Faults: faults},
+		{Type: "pressure", Generator: entity.Generator{Type: GAUSSIAN_GENERATOR}, Faults: faults},
+		{Type: "temperature", Generator: entity.Generator{Type: SINE_GENERATOR}, Faults: faults, Seed: &seed},
+	}
+
+	for i, sensor := range sensors {
+		sensor.ID = fmt.Sprintf("00000000-0000-4000-8000-%012d", i)
+		sensor.Rate = time.Second
+		sensor.Jitter = 100 * time.Millisecond
+
+		t.Run(sensor.Type+" "+sensor.Generator.Type, func(t *testing.T) {
+			conf := config.SimulatorConfig{Workers: 1, Seed: 7}
+			first := simulatePayloads(t, conf, sensor, 2000)
+			second := simulatePayloads(t, conf, sensor, 2000)
+
+			if len(first) != len(second) {
+				t.Fatalf("runs sent %d and %d messages", len(first), len(second))
+			}
+			for j := range first {
+				if !bytes.Equal(first[j], second[j]) {
+					t.Fatalf("message %d differs between runs: %s and %s", j, first[j], second[j])
+				}
+			}
+
+			// The seed is what makes them equal
+			conf.Seed = 8
+			if sensor.Seed != nil {
+				other := *sensor.Seed + 1
+				sensor.Seed = &other
+			}
+			third := simulatePayloads(t, conf, sensor, 2000)
+			if slices.EqualFunc(first, third, bytes.Equal) {
+				t.Errorf("runs with different seeds sent the same messages")
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+// Subject where sensors publish if no template is configured
+const DEFAULT_SUBJECT_TEMPLATE = "sensors.{type}.{id}"
+
+// SubjectTemplate builds the NATS subject of every sensor. The {type} and {id} placeholders are
+// replaced with the values of the sensor. Each of them is a whole token of the subject
+type SubjectTemplate struct {
+	template string
+}
+
+// NewSubjectTemplate checks that a template always gives valid subjects to publish in
+func NewSubjectTemplate(template string) (*SubjectTemplate, error) {
+	if template == "" {
+		template = DEFAULT_SUBJECT_TEMPLATE
+	}
+
+	// Placeholders must be whole tokens, so the filter only matches the subjects of sensors
+	for _, token := range strings.Split(template, ".") {
+		if token != "{type}" && token != "{id}" && (strings.Contains(token, "{type}") || strings.Contains(token, "{id}")) {
+			return nil, fmt.Errorf("subject template %s has placeholders sharing a token with other text", template)
+		}
+	}
+
+	t := &SubjectTemplate{template: template}
+	sample := t.Subject(entity.Sensor{ID: "8cf3030f-2206-4fcb-8c42-d0eb70e197ab", Type: "temperature"})
+
+	for _, token := range strings.Split(sample, ".") {
+		if token == "" {
+			return nil, fmt.Errorf("subject template %s has empty tokens", template)
+		}
+		if strings.ContainsAny(token, "*> \t\r\n{}") {
+			return nil, fmt.Errorf("subject template %s has invalid characters", template)
+		}
+	}
+
+	return t, nil
+}
+
+// This function returns the subject filter which matches the subjects of every sensor
+func (t *SubjectTemplate) Filter() string {
+	return strings.NewReplacer("{type}", "*", "{id}", "*").Replace(t.template)
+}
+
+// This function returns the subject of a sensor
+func (t *SubjectTemplate) Subject(sensor entity.Sensor) string {
+	return strings.NewReplacer("{type}", sensor.Type, "{id}", sensor.ID).Replace(t.template)
+}
@@ -0,0 +1,52 @@
+package simulator
+
+import (
+	"testing"
+
+	"github.com/AntonioBR9998/go-nats-simulator/gan/domain/entity"
+)
+
+func TestSubjectTemplate(t *testing.T) {
+	sensor := entity.Sensor{ID: "8cf3030f-2206-4fcb-8c42-d0eb70e197ab", Type: "humidity"}
+
+	tests := []struct {
+		template string
+		subject  string
+		filter   string
+		wantErr  bool
+	}{
+		{template: "", subject: "sensors.humidity.8cf3030f-2206-4fcb-8c42-d0eb70e197ab", filter: "sensors.*.*"},
+		{template: "plant1.{id}.{type}", subject: "plant1.8cf3030f-2206-4fcb-8c42-d0eb70e197ab.humidity", filter: "plant1.*.*"},
+		{template: "devices.{id}", subject: "devices.8cf3030f-2206-4fcb-8c42-d0eb70e197ab", filter: "devices.*"},
+		{template: "sensors.{type}-{id}", wantErr: true},
+		{template: "sensors.{type}.id-{id}", wantErr: true},
+		{template: "sensors.{type}s.{id}", wantErr: true},
+		{template: "sensors..{id}", wantErr: true},
+		{template: "sensors.{type}.>", wantErr: true},
+		{template: "sensors.*.{id}", wantErr: true},
+		{template: "sensors.{kind}.{id}", wantErr: true},
+		{template: "sensors {type}.{id}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			template, err := NewSubjectTemplate(tt.template)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewSubjectTemplate(%q) accepted an invalid template", tt.template)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewSubjectTemplate(%q) error = %v", tt.template, err)
+			}
+
+			if got := template.Subject(sensor); got != tt.subject {
+				t.Errorf("Subject() = %q, want %q", got, tt.subject)
+			}
+			if got := template.Filter(); got != tt.filter {
+				t.Errorf("Filter() = %q, want %q", got, tt.filter)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nats-io/nats.go/jetstream"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AntonioBR9998/go-nats-simulator/nta/config"
+)
+
+// Columns written for every sample
+const METRICS_COLUMNS = "sensor_id, value, unit, timestamp, out_of_range"
+
+// It is implemented by database connections and pools
+type beginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// batcher buffers the messages of the sensors stream and writes them in TimescaleDB in batches.
+// A batch is written when it reaches its size or when its oldest message has waited the timeout
+type batcher struct {
+	db      *sql.DB
+	dlq     *deadLetterQueue
+	devices *deviceCache
+	size    int
+	timeout time.Duration
+	backoff backoff
+	// Deliveries of a message rejected by the database before it goes to the dead letter queue
+	maxDeliver int
+	msgs       chan jetstream.Msg
+	quit       chan struct{}
+	done       chan struct{}
+}
+
+func newBatcher(db *sql.DB, dlq *deadLetterQueue, devices *deviceCache, cfg *config.Config) *batcher {
+	return &batcher{
+		db:         db,
+		dlq:        dlq,
+		devices:    devices,
+		size:       cfg.Batch.Size,
+		timeout:    time.Duration(cfg.Batch.Timeout * float64(time.Second)),
+		backoff:    newBackoff(cfg.Retry),
+		maxDeliver: cfg.Nats.MaxDeliver,
+		msgs:       make(chan jetstream.Msg, cfg.Batch.Size),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// This function queues a message. Messages received after stop are left unacknowledged, so they
+// are delivered again
+func (b *batcher) add(msg jetstream.Msg) {
+	select {
+	case b.msgs <- msg:
+	case <-b.quit:
+	}
+}
+
+// This function writes the buffered messages and waits until the batcher ends
+func (b *batcher) stop() {
+	close(b.quit)
+	<-b.done
+}
+
+// Batcher go rutine
+func (b *batcher) run() {
+	defer close(b.done)
+
+	b.collect(b.flush)
+}
+
+// This function groups the queued messages in batches and hands every batch to write, until the
+// batcher is stopped. The batch is reused once write returns
+func (b *batcher) collect(write func(batch []jetstream.Msg)) {
+	batch := make([]jetstream.Msg, 0, b.size)
+	timer := time.NewTimer(b.timeout)
+	timer.Stop()
+
+	for {
+		select {
+		case msg := <-b.msgs:
+			if len(batch) == 0 {
+				timer.Reset(b.timeout)
+			}
+			batch = append(batch, msg)
+			if len(batch) < b.size {
+				continue
+			}
+			timer.Stop()
+		case <-timer.C:
+		case <-b.quit:
+			// Writing the messages already queued
+			for len(b.msgs) > 0 {
+				batch = append(batch, <-b.msgs)
+			}
+			write(batch)
+			return
+		}
+
+		write(batch)
+		batch = batch[:0]
+	}
+}
+
+// This function writes a batch in TimescaleDB. Messages are acknowledged once the batch is
+// committed and delivered again later if it cannot be written. Messages which are not samples and
+// samples rejected by the device policies go to the dead letter queue, as well as rows rejected by
+// the database in every delivery
+func (b *batcher) flush(batch []jetstream.Msg) {
+	if len(batch) == 0 {
+		return
+	}
+
+	samples := make([]Sample, 0, len(batch))
+	valid := make([]jetstream.Msg, 0, len(batch))
+	for _, msg := range batch {
+		var event Sample
+		if err := json.Unmarshal(msg.Data(), &event); err != nil {
+			b.deadLetter(msg, fmt.Sprintf("event is not processable: %v", err))
+			continue
+		}
+
+		verdict, reason := b.devices.classify(event)
+		if verdict == rejectSample {
+			b.deadLetter(msg, reason)
+			continue
+		}
+		event.OutOfRange = verdict == flagSample
+
+		samples = append(samples, event)
+		valid = append(valid, msg)
+	}
+
+	err := copyMetrics(context.Background(), b.db, "metrics", samples)
+	if err == nil {
+		sampleCounters.Add("written", int64(len(samples)))
+		for _, msg := range valid {
+			b.ack(msg)
+		}
+		return
+	}
+	log.Errorf("error writing %d samples in database: %v", len(samples), err)
+
+	// Some rows are not valid. They are found by writing the samples one by one
+	if isDataError(err) {
+		for i, msg := range valid {
+			b.write(msg, samples[i])
+		}
+		return
+	}
+
+	for _, msg := range valid {
+		b.retry(msg)
+	}
+}
+
+// This function writes a single sample
+func (b *batcher) write(msg jetstream.Msg, sample Sample) {
+	err := copyMetrics(context.Background(), b.db, "metrics", []Sample{sample})
+	switch {
+	case err == nil:
+		sampleCounters.Add("written", 1)
+		b.ack(msg)
+	case isDataError(err):
+		b.reject(msg, err)
+	default:
+		b.retry(msg)
+	}
+}
+
+func (b *batcher) ack(msg jetstream.Msg) {
+	if err := msg.Ack(); err != nil {
+		log.Errorf("error acknowledging message: %v", err)
+	}
+}
+
+// This function delivers a message again later. The failure is not caused by the message (e.g. the
+// database is not available), so it is never moved to the dead letter queue, however long it takes
+func (b *batcher) retry(msg jetstream.Msg) {
+	if err := msg.NakWithDelay(b.retryDelay(msg)); err != nil {
+		log.Errorf("error rejecting message: %v", err)
+	}
+}
+
+// This function handles a sample rejected by the database. It may be accepted later (e.g. its
+// sensor is being created), so it is delivered again until it has been delivered maxDeliver times,
+// and then it goes to the dead letter queue. Deliveries which failed for other reasons count too,
+// so a sample rejected after a long outage may go at once
+func (b *batcher) reject(msg jetstream.Msg, err error) {
+	metadata, metaErr := msg.Metadata()
+	if metaErr != nil || b.maxDeliver <= 0 || metadata.NumDelivered >= uint64(b.maxDeliver) {
+		b.deadLetter(msg, fmt.Sprintf("sample rejected by database: %v", err))
+		return
+	}
+
+	b.retry(msg)
+}
+
+// This function moves a message to the dead letter queue. The message is terminated once the
+// dead letter is stored, or delivered again later if it cannot be stored
+func (b *batcher) deadLetter(msg jetstream.Msg, reason string) {
+	if err := b.dlq.publish(msg, reason); err != nil {
+		log.Errorf("error sending message to dead letter queue: %v", err)
+		if err := msg.NakWithDelay(b.retryDelay(msg)); err != nil {
+			log.Errorf("error rejecting message: %v", err)
+		}
+		return
+	}
+
+	sampleCounters.Add("deadLetters", 1)
+	if err := msg.TermWithReason(reason); err != nil {
+		log.Errorf("error terminating message: %v", err)
+	}
+}
+
+// Data exceptions (class 22) and integrity constraint violations (class 23) are caused by the
+// rows, so writing them again fails again
+func isDataError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	class := pqErr.Code.Class()
+	return class == "22" || class == "23"
+}
+
+// This function writes samples in a table with COPY, in a single transaction
+func copyMetrics(ctx context.Context, db beginner, table string, samples []Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("COPY %s (%s) FROM STDIN", table, METRICS_COLUMNS))
+	if err != nil {
+		return err
+	}
+
+	for _, sample := range samples {
+		if _, err := stmt.ExecContext(ctx, sample.SensorID, sample.Value, sample.Unit, sample.Timestamp, sample.OutOfRange); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+
+	// Executing without arguments sends the buffered rows
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// The delay grows with every delivery of the message
+func (b *batcher) retryDelay(msg jetstream.Msg) time.Duration {
+	metadata, err := msg.Metadata()
+	if err != nil {
+		return b.backoff.delay(0)
+	}
+
+	return b.backoff.delay(metadata.NumDelivered)
+}
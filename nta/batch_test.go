@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Message of the sensors stream. The batcher only groups them
+type fakeMsg struct {
+	jetstream.Msg
+	id int
+}
+
+// This function starts a batcher which hands its batches to the returned channel
+func startBatcher(size int, timeout time.Duration) (*batcher, <-chan []int) {
+	b := &batcher{
+		size:    size,
+		timeout: timeout,
+		msgs:    make(chan jetstream.Msg, size),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	batches := make(chan []int, 100)
+
+	go func() {
+		defer close(b.done)
+		defer close(batches)
+
+		b.collect(func(batch []jetstream.Msg) {
+			ids := make([]int, 0, len(batch))
+			for _, msg := range batch {
+				ids = append(ids, msg.(fakeMsg).id)
+			}
+			batches <- ids
+		})
+	}()
+
+	return b, batches
+}
+
+func TestBatchSplitting(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		msgs    int
+		timeout time.Duration
+		// Stopping the batcher right after the messages are added
+		stop bool
+		want [][]int
+	}{
+		{name: "full batches", size: 3, msgs: 6, timeout: time.Hour, want: [][]int{{0, 1, 2}, {3, 4, 5}}},
+		{name: "rest after the timeout", size: 3, msgs: 7, timeout: 50 * time.Millisecond, want: [][]int{{0, 1, 2}, {3, 4, 5}, {6}}},
+		{name: "single message after the timeout", size: 1000, msgs: 1, timeout: 50 * time.Millisecond, want: [][]int{{0}}},
+		{name: "rest when stopped", size: 3, msgs: 5, timeout: time.Hour, stop: true, want: [][]int{{0, 1, 2}, {3, 4}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, batches := startBatcher(tt.size, tt.timeout)
+			start := time.Now()
+			for i := range tt.msgs {
+				b.add(fakeMsg{id: i})
+			}
+			if tt.stop {
+				b.stop()
+			}
+
+			for i, want := range tt.want {
+				select {
+				case got := <-batches:
+					if !slices.Equal(got, want) {
+						t.Errorf("batch %d = %v, want %v", i, got, want)
+					}
+					// Incomplete batches wait for the timeout
+					if len(got) < tt.size && !tt.stop && time.Since(start) < tt.timeout {
+						t.Errorf("batch %d written after %v, before the timeout", i, time.Since(start))
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("batch %d was not written", i)
+				}
+			}
+
+			if !tt.stop {
+				b.stop()
+			}
+			if extra, ok := <-batches; ok && len(extra) > 0 {
+				t.Errorf("unexpected batch %v", extra)
+			}
+		})
+	}
+}
+
+func TestIsDataError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "numeric value out of range", err: &pq.Error{Code: "22003"}, want: true},
+		{name: "invalid text representation", err: &pq.Error{Code: "22P02"}, want: true},
+		{name: "not null violation", err: &pq.Error{Code: "23502"}, want: true},
+		{name: "wrapped", err: fmt.Errorf("copy: %w", &pq.Error{Code: "23514"}), want: true},
+		{name: "connection failure", err: &pq.Error{Code: "08006"}, want: false},
+		{name: "serialization failure", err: &pq.Error{Code: "40001"}, want: false},
+		{name: "undefined table", err: &pq.Error{Code: "42P01"}, want: false},
+		{name: "not a database error", err: errors.New("connection reset by peer"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDataError(tt.err); got != tt.want {
+				t.Errorf("isDataError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// Message of the sensors stream which records how it is settled
+type settledMsg struct {
+	jetstream.Msg
+	delivered uint64
+	naks      int
+	terms     int
+}
+
+func (m *settledMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumDelivered: m.delivered}, nil
+}
+
+func (m *settledMsg) NakWithDelay(delay time.Duration) error {
+	m.naks++
+	return nil
+}
+
+func (m *settledMsg) TermWithReason(reason string) error {
+	m.terms++
+	return nil
+}
+
+func (m *settledMsg) Subject() string {
+	return "sensors.temperature.8cf3030f-2206-4fcb-8c42-d0eb70e197ab"
+}
+
+func (m *settledMsg) Data() []byte {
+	return []byte(`{}`)
+}
+
+func (m *settledMsg) Headers() nats.Header {
+	return nats.Header{}
+}
+
+// JetStream context which stores the published messages
+type fakeJetStream struct {
+	jetstream.JetStream
+	published []*nats.Msg
+}
+
+func (js *fakeJetStream) PublishMsg(ctx context.Context, msg *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	js.published = append(js.published, msg)
+	return &jetstream.PubAck{}, nil
+}
+
+func TestFailedWrites(t *testing.T) {
+	js := &fakeJetStream{}
+	b := &batcher{
+		dlq:        &deadLetterQueue{js: js, prefix: "dlq"},
+		backoff:    backoff{initial: time.Second, max: time.Minute},
+		maxDeliver: 10,
+	}
+	rejected := func(msg jetstream.Msg) { b.reject(msg, &pq.Error{Code: "23503"}) }
+
+	tests := []struct {
+		name      string
+		delivered uint64
+		settle    func(msg jetstream.Msg)
+		dead      bool
+	}{
+		{name: "outage", delivered: 1, settle: b.retry},
+		// Longer than the deliveries allowed to rows rejected by the database
+		{name: "long outage", delivered: 1000, settle: b.retry},
+		{name: "rejected row", delivered: 1, settle: rejected},
+		{name: "rejected row before max deliver", delivered: 9, settle: rejected},
+		{name: "rejected row at max deliver", delivered: 10, settle: rejected, dead: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js.published = nil
+			msg := &settledMsg{delivered: tt.delivered}
+			tt.settle(msg)
+
+			if tt.dead {
+				if msg.terms != 1 || msg.naks != 0 || len(js.published) != 1 {
+					t.Errorf("message terminated %d times, rejected %d times and %d dead letters, want it moved to the dead letter queue",
+						msg.terms, msg.naks, len(js.published))
+				}
+				return
+			}
+			if msg.naks != 1 || msg.terms != 0 || len(js.published) != 0 {
+				t.Errorf("message rejected %d times, terminated %d times and %d dead letters, want it delivered again",
+					msg.naks, msg.terms, len(js.published))
+			}
+		})
+	}
+}
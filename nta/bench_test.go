@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"testing"
+	"time"
+)
+
+// Connection string of a database where the benchmarks may create their table, like
+// "host=localhost user=admin password=admin dbname=sensors_test sslmode=disable". It must have the
+// metrics table of GAN. The benchmarks are skipped without it
+const BENCH_DATABASE_ENV = "NTA_BENCH_DATABASE_URL"
+
+// Table where the benchmarks write, so the metrics table is not modified
+const BENCH_TABLE = "nta_bench_metrics"
+
+// This function connects to the benchmark database and creates the benchmark table, with the same
+// columns as the metrics hypertable. The table is dropped when the benchmark ends
+func benchDB(b *testing.B) *sql.DB {
+	dsn := os.Getenv(BENCH_DATABASE_ENV)
+	if dsn == "" {
+		b.Skipf("%s is not set", BENCH_DATABASE_ENV)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS " + BENCH_TABLE,
+		"CREATE TABLE " + BENCH_TABLE + " (LIKE metrics INCLUDING ALL)",
+		"SELECT create_hypertable('" + BENCH_TABLE + "', 'timestamp', chunk_time_interval => 86400000)",
+	} {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.Cleanup(func() { db.ExecContext(ctx, "DROP TABLE IF EXISTS "+BENCH_TABLE) })
+
+	return db
+}
+
+// Samples of a fleet of 1000 sensors publishing every 100ms
+func benchSamples(n int) []Sample {
+	start := time.Now().UnixMilli()
+	samples := make([]Sample, n)
+	for i := range samples {
+		samples[i] = Sample{
+			SensorID:  fmt.Sprintf("00000000-0000-4000-8000-%012d", i%1000),
+			Value:     rand.Float32() * 100,
+			Unit:      "celsius",
+			Timestamp: start + int64(i/1000)*100,
+		}
+	}
+	return samples
+}
+
+func reportSamplesPerSecond(b *testing.B) {
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "samples/s")
+}
+
+// BenchmarkInsert writes one sample per insert, as NTA did before batching. Every operation is a
+// sample
+func BenchmarkInsert(b *testing.B) {
+	db := benchDB(b)
+	samples := benchSamples(b.N)
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1, $2, $3, $4, $5)", BENCH_TABLE, METRICS_COLUMNS)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for _, sample := range samples {
+		if _, err := db.ExecContext(ctx, query, sample.SensorID, sample.Value, sample.Unit, sample.Timestamp,
+			sample.OutOfRange); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	reportSamplesPerSecond(b)
+}
+
+// BenchmarkCopy writes COPY batches of several sizes. Every operation is a sample, so the
+// instances a fleet needs are its samples per second divided by the reported samples/s of the
+// configured batch.size
+func BenchmarkCopy(b *testing.B) {
+	db := benchDB(b)
+	ctx := context.Background()
+
+	for _, size := range []int{100, 1000, 5000, 10000} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			samples := benchSamples(b.N)
+
+			b.ResetTimer()
+			for i := 0; i < len(samples); i += size {
+				if err := copyMetrics(ctx, db, BENCH_TABLE, samples[i:min(i+size, len(samples))]); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			reportSamplesPerSecond(b)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/AntonioBR9998/go-common/config"
+	"github.com/AntonioBR9998/go-nats-simulator/deadletter"
+)
+
+// Config represents the adapter configuration
+type Config struct {
+	config.BaseConfig `mapstructure:",squash"`
+
+	Nats        NatsConfig              `json:"nats"`
+	TimescaleDB config.PostgreSQLConfig `json:"timescaleDB"`
+	Batch       BatchConfig             `json:"batch"`
+	Retry       RetryConfig             `json:"retry"`
+	Validation  ValidationConfig        `json:"validation"`
+	Metrics     MetricsConfig           `json:"metrics"`
+}
+
+type NatsConfig struct {
+	Host string `json:"host"`
+	Port string `json:"port"`
+	// Subjects consumed. sensors.> by default
+	Subject string `json:"subject"`
+	// Stream created by GAN. SENSORS by default
+	Stream string `json:"stream"`
+	// Durable consumer which keeps the position of NTA in the stream. nta by default
+	Durable string `json:"durable"`
+	// Seconds a message can be processed before it is delivered again. 30 by default
+	AckWait float64 `json:"ackWait"`
+	// Deliveries of a sample rejected by the database before it goes to the dead letter queue.
+	// Samples which cannot be written for other reasons, like a database outage, are delivered
+	// again until they are written. 10 by default
+	MaxDeliver int `json:"maxDeliver"`
+	// Stream of the dead letter queue. It is created at startup if GAN has not created it.
+	// SENSORS_DLQ by default
+	DeadLetterStream string `json:"deadLetterStream"`
+	// Prefix of the subjects of the dead letter queue, followed by the original subject of every
+	// message. dlq by default
+	DeadLetterPrefix string `json:"deadLetterPrefix"`
+}
+
+type BatchConfig struct {
+	// Samples are written when a batch is full or when its oldest sample has waited the timeout.
+	// 1000 samples and 0.5 seconds by default
+	Size    int     `json:"size"`
+	Timeout float64 `json:"timeout"`
+}
+
+// RetryConfig is the backoff used while NATS, TimescaleDB or the stream are not available at
+// startup, and before delivering again the samples which could not be written
+type RetryConfig struct {
+	// Connection attempts at startup before giving up. 0 means forever
+	Attempts int `json:"attempts"`
+	// Seconds of the first delay, which doubles up to the max. 1 and 60 by default
+	InitialDelay float64 `json:"initialDelay"`
+	MaxDelay     float64 `json:"maxDelay"`
+}
+
+// ValidationConfig describes what is done with the samples which are out of the thresholds of
+// their sensor, or whose sensor is not in the devices table. Rejected samples go to the dead
+// letter queue
+type ValidationConfig struct {
+	// accept, flag (default, they are written with the out_of_range column set) or reject
+	OutOfRange string `json:"outOfRange"`
+	// accept or reject (default)
+	UnknownSensor string `json:"unknownSensor"`
+	// Seconds between reloads of the devices table, besides the reloads notified by the table.
+	// It bounds the staleness while notifications are not received. 10 by default
+	RefreshInterval float64 `json:"refreshInterval"`
+}
+
+type MetricsConfig struct {
+	// Address where the counters of the samples are served in /debug/vars. Empty disables it
+	Address string `json:"address"`
+}
+
+// This function fills the settings which are not configured
+func (c *Config) SetDefaults() {
+	if c.Nats.Subject == "" {
+		c.Nats.Subject = "sensors.>"
+	}
+	if c.Nats.Stream == "" {
+		c.Nats.Stream = "SENSORS"
+	}
+	if c.Nats.Durable == "" {
+		c.Nats.Durable = "nta"
+	}
+	if c.Nats.AckWait <= 0 {
+		c.Nats.AckWait = 30
+	}
+	if c.Nats.MaxDeliver <= 0 {
+		c.Nats.MaxDeliver = 10
+	}
+	if c.Nats.DeadLetterStream == "" {
+		c.Nats.DeadLetterStream = deadletter.DEFAULT_STREAM
+	}
+	if c.Nats.DeadLetterPrefix == "" {
+		c.Nats.DeadLetterPrefix = deadletter.DEFAULT_PREFIX
+	}
+	if c.Batch.Size <= 0 {
+		c.Batch.Size = 1000
+	}
+	if c.Batch.Timeout <= 0 {
+		c.Batch.Timeout = 0.5
+	}
+	if c.Retry.InitialDelay <= 0 {
+		c.Retry.InitialDelay = 1
+	}
+	if c.Retry.MaxDelay < c.Retry.InitialDelay {
+		c.Retry.MaxDelay = max(60, c.Retry.InitialDelay)
+	}
+	if c.Validation.OutOfRange == "" {
+		c.Validation.OutOfRange = "flag"
+	}
+	if c.Validation.UnknownSensor == "" {
+		c.Validation.UnknownSensor = "reject"
+	}
+	if c.Validation.RefreshInterval <= 0 {
+		c.Validation.RefreshInterval = 10
+	}
+}
+
+// This function checks the settings which cannot be fixed with defaults
+func (c *Config) Validate() error {
+	switch c.Validation.OutOfRange {
+	case "accept", "flag", "reject":
+	default:
+		return fmt.Errorf("validation.outOfRange must be accept, flag or reject")
+	}
+
+	switch c.Validation.UnknownSensor {
+	case "accept", "reject":
+	default:
+		return fmt.Errorf("validation.unknownSensor must be accept or reject")
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AntonioBR9998/go-nats-simulator/deadletter"
+	"github.com/AntonioBR9998/go-nats-simulator/nta/config"
+)
+
+// deadLetterQueue keeps the messages which cannot be written in TimescaleDB, so they can be
+// inspected and re-driven. They are published under the prefix followed by their original subject
+type deadLetterQueue struct {
+	js     jetstream.JetStream
+	prefix string
+}
+
+// This function checks that the dead letter stream stores the subjects of the dead letter prefix,
+// creating it if GAN has not done it yet. GAN updates its settings when it starts. Otherwise the
+// messages which cannot be written would be lost, so NTA must not start
+func newDeadLetterQueue(ctx context.Context, js jetstream.JetStream, conf config.NatsConfig) (*deadLetterQueue, error) {
+	subjects := deadletter.Subjects(conf.DeadLetterPrefix)
+
+	stream, err := js.Stream(ctx, conf.DeadLetterStream)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		log.Infof("creating dead letter stream %s", conf.DeadLetterStream)
+		stream, err = js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:     conf.DeadLetterStream,
+			Subjects: []string{subjects},
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting dead letter stream %s: %w", conf.DeadLetterStream, err)
+	}
+
+	if !slices.Contains(stream.CachedInfo().Config.Subjects, subjects) {
+		return nil, fmt.Errorf("dead letter stream %s does not store the subjects %s", conf.DeadLetterStream, subjects)
+	}
+
+	return &deadLetterQueue{js: js, prefix: conf.DeadLetterPrefix}, nil
+}
+
+// This function publishes a message in the dead letter queue with the reason of the failure, its
+// original subject and the times it was delivered
+func (q *deadLetterQueue) publish(msg jetstream.Msg, reason string) error {
+	dead := nats.NewMsg(deadletter.Subject(q.prefix, msg.Subject()))
+	dead.Data = msg.Data()
+	for key, values := range msg.Headers() {
+		dead.Header[key] = values
+	}
+	dead.Header.Set(deadletter.REASON_HEADER, reason)
+	dead.Header.Set(deadletter.SUBJECT_HEADER, msg.Subject())
+
+	var msgID string
+	if metadata, err := msg.Metadata(); err == nil {
+		dead.Header.Set(deadletter.ATTEMPTS_HEADER, strconv.FormatUint(metadata.NumDelivered, 10))
+		dead.Header.Set(deadletter.STREAM_HEADER, metadata.Stream)
+		dead.Header.Set(deadletter.SEQUENCE_HEADER, strconv.FormatUint(metadata.Sequence.Stream, 10))
+		// A message sent twice to the queue is stored once
+		msgID = fmt.Sprintf("%s-%d", metadata.Stream, metadata.Sequence.Stream)
+	}
+
+	var opts []jetstream.PublishOpt
+	if msgID != "" {
+		opts = append(opts, jetstream.WithMsgID(msgID))
+	}
+	_, err := q.js.PublishMsg(context.Background(), dead, opts...)
+
+	if err != nil {
+		return err
+	}
+
+	log.Warnf("message %s moved to dead letter queue: %s", msg.Subject(), reason)
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AntonioBR9998/go-nats-simulator/nta/config"
+)
+
+// Policies of the samples which are out of the thresholds of their sensor or whose sensor is
+// not in the devices table
+const (
+	ACCEPT_POLICY = "accept"
+	FLAG_POLICY   = "flag"
+	REJECT_POLICY = "reject"
+)
+
+// Shortest time between reloads of the devices table caused by unknown sensors
+const MIN_DEVICES_RELOAD = time.Second
+
+// Channel notified by the trigger of the devices table when it changes
+const DEVICES_CHANNEL = "devices_changed"
+
+// Delays between reconnections of the listener of the devices channel
+const (
+	MIN_LISTENER_RECONNECT = time.Second
+	MAX_LISTENER_RECONNECT = time.Minute
+)
+
+// Counters of the classified samples, published in /debug/vars
+var sampleCounters = expvar.NewMap("samples")
+
+// What is done with a sample
+type verdict int
+
+const (
+	acceptSample verdict = iota
+	flagSample
+	rejectSample
+)
+
+// Thresholds of a sensor
+type device struct {
+	typ          string
+	maxThreshold float32
+	minThreshold float32
+}
+
+// deviceCache keeps the sensors of the devices table. It is reloaded when the table notifies a
+// change, so modified thresholds apply at once, and when a sample of an unknown sensor arrives.
+// Notifications sent while the listener is disconnected are lost, so it is also reloaded
+// periodically and after every reconnection. Those changes are applied within the refresh interval
+type deviceCache struct {
+	db         *sql.DB
+	dsn        string
+	conf       config.ValidationConfig
+	devices    map[string]device
+	lastReload time.Time
+	mu         sync.Mutex
+	// Reads the devices table. It is replaced in the tests
+	load func() (map[string]device, error)
+}
+
+func newDeviceCache(db *sql.DB, dsn string, conf config.ValidationConfig) *deviceCache {
+	c := &deviceCache{db: db, dsn: dsn, conf: conf, devices: make(map[string]device)}
+	c.load = c.query
+	return c
+}
+
+// This function reloads the devices table when it changes and every refresh interval until stop
+// is closed
+func (c *deviceCache) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(c.conf.RefreshInterval * float64(time.Second)))
+	defer ticker.Stop()
+
+	listener := pq.NewListener(c.dsn, MIN_LISTENER_RECONNECT, MAX_LISTENER_RECONNECT,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Warnf("error listening to %s, devices are reloaded every %v seconds: %v",
+					DEVICES_CHANNEL, c.conf.RefreshInterval, err)
+			}
+		})
+	defer listener.Close()
+	// Listen waits while the database is not available, and polling must not wait for it
+	go func() {
+		if err := listener.Listen(DEVICES_CHANNEL); err != nil {
+			log.Warnf("error listening to %s: %v", DEVICES_CHANNEL, err)
+		}
+	}()
+
+	c.watch(stop, ticker.C, listener.Notify)
+}
+
+// This function reloads the devices table at once, on every tick and on every notification until
+// stop is closed
+func (c *deviceCache) watch(stop <-chan struct{}, tick <-chan time.Time, notify <-chan *pq.Notification) {
+	for {
+		if err := c.reload(); err != nil {
+			log.Errorf("error loading devices: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-tick:
+		// A nil notification means that the listener has reconnected and changes may be lost
+		case <-notify:
+			// Changes notified in the meantime are covered by the same reload
+			for len(notify) > 0 {
+				<-notify
+			}
+		}
+	}
+}
+
+func (c *deviceCache) reload() error {
+	devices, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.devices = devices
+	c.lastReload = time.Now()
+	log.Debugf("%d devices loaded", len(devices))
+
+	return nil
+}
+
+// This function reads the thresholds of every sensor of the devices table
+func (c *deviceCache) query() (map[string]device, error) {
+	rows, err := c.db.QueryContext(context.Background(), "SELECT id, type, max_threshold, min_threshold FROM devices")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := make(map[string]device)
+	for rows.Next() {
+		var id string
+		var d device
+		if err := rows.Scan(&id, &d.typ, &d.maxThreshold, &d.minThreshold); err != nil {
+			return nil, err
+		}
+		devices[id] = d
+	}
+
+	return devices, rows.Err()
+}
+
+// This function returns the sensor of a sample. Unknown sensors cause a reload, at most once
+// every MIN_DEVICES_RELOAD
+func (c *deviceCache) get(id string) (device, bool) {
+	c.mu.Lock()
+	d, ok := c.devices[id]
+	stale := time.Since(c.lastReload) >= MIN_DEVICES_RELOAD
+	// Concurrent lookups of unknown sensors do not reload the table again
+	if !ok && stale {
+		c.lastReload = time.Now()
+	}
+	c.mu.Unlock()
+
+	if ok || !stale {
+		return d, ok
+	}
+
+	if err := c.reload(); err != nil {
+		log.Errorf("error loading devices: %v", err)
+		return d, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	d, ok = c.devices[id]
+	return d, ok
+}
+
+// This function decides what is done with a sample according to the configured policies. It
+// returns the reason of flagged and rejected samples
+func (c *deviceCache) classify(sample Sample) (verdict, string) {
+	d, ok := c.get(sample.SensorID)
+	if !ok {
+		if c.conf.UnknownSensor == ACCEPT_POLICY {
+			sampleCounters.Add("unknownAccepted", 1)
+			return acceptSample, ""
+		}
+		sampleCounters.Add("unknownRejected", 1)
+		return rejectSample, "unknown sensor " + sample.SensorID
+	}
+
+	if sample.Value >= d.minThreshold && sample.Value <= d.maxThreshold {
+		sampleCounters.Add("accepted", 1)
+		return acceptSample, ""
+	}
+
+	reason := "value out of the thresholds of the sensor"
+	switch c.conf.OutOfRange {
+	case ACCEPT_POLICY:
+		sampleCounters.Add("accepted", 1)
+		return acceptSample, ""
+	case REJECT_POLICY:
+		sampleCounters.Add("outOfRangeRejected", 1)
+		return rejectSample, reason
+	default:
+		sampleCounters.Add("outOfRangeFlagged", 1)
+		return flagSample, reason
+	}
+}
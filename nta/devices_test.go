@@ -0,0 +1,184 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/AntonioBR9998/go-nats-simulator/nta/config"
+)
+
+const (
+	KNOWN_SENSOR   = "8cf3030f-2206-4fcb-8c42-d0eb70e197ab"
+	UNKNOWN_SENSOR = "2a1d7b55-93a4-4c1e-9d0f-3c8f4a6e5b21"
+)
+
+// testTable is a devices table in memory which counts how many times it is loaded
+type testTable struct {
+	mu      sync.Mutex
+	devices map[string]device
+	reloads int
+}
+
+func (t *testTable) load() (map[string]device, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.reloads++
+	loaded := make(map[string]device, len(t.devices))
+	for id, d := range t.devices {
+		loaded[id] = d
+	}
+	return loaded, nil
+}
+
+func (t *testTable) set(id string, d device) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.devices[id] = d
+}
+
+func (t *testTable) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.reloads
+}
+
+// This function returns a cache of a table with the given sensors
+func newTestDeviceCache(conf config.ValidationConfig, devices map[string]device) (*deviceCache, *testTable) {
+	table := &testTable{devices: devices}
+	c := &deviceCache{conf: conf, devices: make(map[string]device), load: table.load}
+
+	return c, table
+}
+
+func TestClassify(t *testing.T) {
+	devices := map[string]device{KNOWN_SENSOR: {typ: "temperature", minThreshold: 10, maxThreshold: 30}}
+
+	tests := []struct {
+		name   string
+		conf   config.ValidationConfig
+		sample Sample
+		want   verdict
+	}{
+		{name: "within the thresholds", sample: Sample{SensorID: KNOWN_SENSOR, Value: 20}, want: acceptSample},
+		{name: "at the minimum threshold", sample: Sample{SensorID: KNOWN_SENSOR, Value: 10}, want: acceptSample},
+		{name: "at the maximum threshold", sample: Sample{SensorID: KNOWN_SENSOR, Value: 30}, want: acceptSample},
+		{name: "out of range flagged by default", sample: Sample{SensorID: KNOWN_SENSOR, Value: 31}, want: flagSample},
+		{name: "out of range flagged", conf: config.ValidationConfig{OutOfRange: FLAG_POLICY},
+			sample: Sample{SensorID: KNOWN_SENSOR, Value: 9}, want: flagSample},
+		{name: "out of range accepted", conf: config.ValidationConfig{OutOfRange: ACCEPT_POLICY},
+			sample: Sample{SensorID: KNOWN_SENSOR, Value: 31}, want: acceptSample},
+		{name: "out of range rejected", conf: config.ValidationConfig{OutOfRange: REJECT_POLICY},
+			sample: Sample{SensorID: KNOWN_SENSOR, Value: 9}, want: rejectSample},
+		{name: "unknown sensor rejected by default", sample: Sample{SensorID: UNKNOWN_SENSOR, Value: 20}, want: rejectSample},
+		{name: "unknown sensor rejected", conf: config.ValidationConfig{UnknownSensor: REJECT_POLICY},
+			sample: Sample{SensorID: UNKNOWN_SENSOR, Value: 20}, want: rejectSample},
+		{name: "unknown sensor accepted", conf: config.ValidationConfig{UnknownSensor: ACCEPT_POLICY},
+			sample: Sample{SensorID: UNKNOWN_SENSOR, Value: 20}, want: acceptSample},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestDeviceCache(tt.conf, devices)
+
+			got, reason := c.classify(tt.sample)
+			if got != tt.want {
+				t.Errorf("classify() = %v, want %v", got, tt.want)
+			}
+			// Flagged and rejected samples explain why
+			if (got == acceptSample) != (reason == "") {
+				t.Errorf("classify() reason = %q for verdict %v", reason, got)
+			}
+		})
+	}
+}
+
+func TestUnknownSensorsReloadAtMostOncePerSecond(t *testing.T) {
+	c, table := newTestDeviceCache(config.ValidationConfig{},
+		map[string]device{KNOWN_SENSOR: {typ: "temperature", maxThreshold: 30}})
+
+	// The first unknown sensor loads the table, and the sensors which are still unknown wait
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.get(UNKNOWN_SENSOR)
+		}()
+	}
+	wg.Wait()
+	if got := table.count(); got != 1 {
+		t.Fatalf("reloads = %d, want 1", got)
+	}
+
+	// Known sensors never reload the table
+	if _, ok := c.get(KNOWN_SENSOR); !ok {
+		t.Errorf("get(%s) not found after the reload", KNOWN_SENSOR)
+	}
+	if got := table.count(); got != 1 {
+		t.Errorf("reloads = %d after a known sensor, want 1", got)
+	}
+
+	// The table is loaded again once MIN_DEVICES_RELOAD has passed
+	c.mu.Lock()
+	c.lastReload = time.Now().Add(-MIN_DEVICES_RELOAD)
+	c.mu.Unlock()
+	c.get(UNKNOWN_SENSOR)
+	c.get(UNKNOWN_SENSOR)
+	if got := table.count(); got != 2 {
+		t.Errorf("reloads = %d after %v, want 2", got, MIN_DEVICES_RELOAD)
+	}
+}
+
+func TestNotificationsReloadDevices(t *testing.T) {
+	devices := map[string]device{KNOWN_SENSOR: {typ: "temperature", minThreshold: 10, maxThreshold: 30}}
+	c, table := newTestDeviceCache(config.ValidationConfig{}, devices)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	notify := make(chan *pq.Notification, 10)
+	go func() {
+		defer close(done)
+		c.watch(stop, nil, notify)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	sample := Sample{SensorID: KNOWN_SENSOR, Value: 35}
+
+	// The table is loaded as soon as the cache starts
+	waitForVerdict(t, c, sample, flagSample)
+
+	// The sensor is known from now on, so only the notifications reload the table.
+	// The trigger notifies a change of the thresholds
+	table.set(KNOWN_SENSOR, device{typ: "temperature", minThreshold: 10, maxThreshold: 40})
+	notify <- &pq.Notification{Channel: DEVICES_CHANNEL}
+	waitForVerdict(t, c, sample, acceptSample)
+
+	// A reconnection of the listener reloads the table too
+	table.set(KNOWN_SENSOR, device{typ: "temperature", minThreshold: 10, maxThreshold: 30})
+	notify <- nil
+	waitForVerdict(t, c, sample, flagSample)
+}
+
+// This function waits until the cache gives a sample the wanted verdict
+func waitForVerdict(t *testing.T, c *deviceCache, sample Sample, want verdict) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	got, _ := c.classify(sample)
+	for got != want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		got, _ = c.classify(sample)
+	}
+	if got != want {
+		t.Fatalf("classify(%v) = %v, want %v", sample.Value, got, want)
+	}
+}
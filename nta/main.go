@@ -4,26 +4,32 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	commonConfig "github.com/AntonioBR9998/go-common/config"
 	_ "github.com/lib/pq"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+
+	"github.com/AntonioBR9998/go-nats-simulator/nta/config"
 )
 
 const (
-	NATS_URL = "nats://nats:4222"
-	HOST     = "timescale-db"
-	PORT     = 5432
-	USER     = "admin"
-	PASS     = "admin"
-	DBNAME   = "sensors"
-	SSLMODE  = "disable"
+	explainedName = "{N}ATS {T}imescaleDB {A}dapter"
+)
+
+var (
+	Version = "dev"
 )
 
 type Sample struct {
@@ -31,55 +37,194 @@ type Sample struct {
 	Value     float32
 	Unit      string
 	Timestamp int64
+	// The value is out of the thresholds of the sensor
+	OutOfRange bool `json:"-"`
+}
+
+// This function returns the flags of NTA. The flags and their environment variables override the
+// configuration file
+func newFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:      "config",
+			Required:  true,
+			TakesFile: true,
+			Aliases:   []string{"c"},
+			Usage:     "load configuration from `FILE`",
+			EnvVars:   []string{"NTA_CONFIG_FILE"},
+		},
+		&cli.StringFlag{Name: "nats-host", Usage: "override nats.host", EnvVars: []string{"NTA_NATS_HOST"}},
+		&cli.StringFlag{Name: "nats-port", Usage: "override nats.port", EnvVars: []string{"NTA_NATS_PORT"}},
+		&cli.StringFlag{Name: "db-host", Usage: "override timescaleDB.host", EnvVars: []string{"NTA_DB_HOST"}},
+		&cli.IntFlag{Name: "db-port", Usage: "override timescaleDB.port", EnvVars: []string{"NTA_DB_PORT"}},
+		&cli.StringFlag{Name: "db-user", Usage: "override timescaleDB.user", EnvVars: []string{"NTA_DB_USER"}},
+		&cli.StringFlag{Name: "db-password", Usage: "override timescaleDB.password", EnvVars: []string{"NTA_DB_PASSWORD"}},
+		&cli.StringFlag{Name: "db-name", Usage: "override timescaleDB.dbName", EnvVars: []string{"NTA_DB_NAME"}},
+		&cli.StringFlag{Name: "db-sslmode", Usage: "override timescaleDB.sslMode", EnvVars: []string{"NTA_DB_SSLMODE"}},
+	}
 }
 
 func main() {
-	log.Print("starting NTA (NATS TimescaleDB Adapter)")
+	app := cli.App{
+		Name:        "nta",
+		Usage:       explainedName,
+		Description: "NTA writes the samples published by the sensors in TimescaleDB",
+		Action:      startNtaService,
+		Version:     Version,
+		Flags:       newFlags(),
+	}
 
-	// Connecting TimescaleDB
-	log.Print("connecting to timescaleDB")
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// This function loads the configuration file and applies the flags and environment variables
+// which override it
+func loadConfig(ctx *cli.Context) (*config.Config, error) {
+	configFilePath := ctx.String("config")
+	log.Infof("loading configuration from file '%s'", configFilePath)
+	cfg := commonConfig.New(
+		&config.Config{},
+		func(cfg *config.Config) {
+			cfg.ConfigPath = configFilePath
+		},
+	)
+
+	overrideConfig(ctx, cfg)
+	cfg.SetDefaults()
+
+	return cfg, cfg.Validate()
+}
+
+// This function applies the flags and environment variables which are set over the configuration
+// file. Flags take precedence over their environment variables
+func overrideConfig(ctx *cli.Context, cfg *config.Config) {
+	if ctx.IsSet("nats-host") {
+		cfg.Nats.Host = ctx.String("nats-host")
+	}
+	if ctx.IsSet("nats-port") {
+		cfg.Nats.Port = ctx.String("nats-port")
+	}
+	if ctx.IsSet("db-host") {
+		cfg.TimescaleDB.Host = ctx.String("db-host")
+	}
+	if ctx.IsSet("db-port") {
+		cfg.TimescaleDB.Port = ctx.Int("db-port")
+	}
+	if ctx.IsSet("db-user") {
+		cfg.TimescaleDB.User = ctx.String("db-user")
+	}
+	if ctx.IsSet("db-password") {
+		cfg.TimescaleDB.Password = ctx.String("db-password")
+	}
+	if ctx.IsSet("db-name") {
+		cfg.TimescaleDB.DBName = ctx.String("db-name")
+	}
+	if ctx.IsSet("db-sslmode") {
+		cfg.TimescaleDB.SSLMode = ctx.String("db-sslmode")
+	}
+}
+
+// This function publishes the counters of the samples in /debug/vars
+func serveMetrics(address string) {
+	log.Infof("serving counters in http://%s/debug/vars", address)
+	if err := http.ListenAndServe(address, nil); err != nil {
+		log.Errorf("error serving counters: %v", err)
+	}
+}
+
+// This function returns the connection string of TimescaleDB
+func dataSourceName(cfg *config.Config) string {
+	conf := cfg.TimescaleDB
+	return fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s sslmode=%s",
+		conf.Host, conf.Port, conf.User, conf.DBName, conf.Password, conf.SSLMode)
+}
+
+// This function connects to TimescaleDB, retrying while it is not available
+func connectDB(cfg *config.Config) (*sql.DB, error) {
+	log.Info("connecting to timescaleDB")
+
+	db, err := sql.Open("postgres", dataSourceName(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	err = retry("timescaleDB", cfg.Retry, func() error {
+		return db.PingContext(context.Background())
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
 
-	psqlSetup := fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s sslmode=%s", HOST, PORT, USER, DBNAME, PASS, SSLMODE)
-	db, err := sql.Open("postgres", psqlSetup)
+func startNtaService(ctx *cli.Context) error {
+	log.Infoln("starting " + explainedName)
+
+	cfg, err := loadConfig(ctx)
 	if err != nil {
-		log.Printf("there is an error while connecting to the database: %v", err)
+		return err
 	}
 
+	// Connecting TimescaleDB
+	db, err := connectDB(cfg)
+	if err != nil {
+		return err
+	}
 	defer db.Close()
 
 	// Connecting NATS
-	log.Print("connecting to NATS")
+	log.Info("connecting to NATS")
 
-	natsClient, err := nats.Connect(NATS_URL)
+	var natsClient *nats.Conn
+	err = retry("NATS", cfg.Retry, func() error {
+		natsClient, err = nats.Connect(cfg.Nats.Host + ":" + cfg.Nats.Port)
+		return err
+	})
 	if err != nil {
-		log.Printf("error connecting to NATS: %v", err)
+		return err
 	}
 	defer natsClient.Close()
 
-	// Subscribing to sensors topic
-	log.Print("subscribing to sensors topic")
-	sub, err := natsClient.Subscribe("sensors", func(msg *nats.Msg) {
-		var event Sample
-		if err := json.Unmarshal(msg.Data, &event); err != nil {
-			log.Printf("event is not processable: %v", err)
-			return
-		}
+	// Consuming from sensors stream
+	log.Infof("consuming %s topics from stream %s", cfg.Nats.Subject, cfg.Nats.Stream)
+	js, err := jetstream.New(natsClient)
+	if err != nil {
+		return err
+	}
 
-		// Inserting event in TimescaleDB
-		query := `INSERT INTO metrics (sensor_id, value, unit, timestamp) VALUES ($1, $2, $3, $4)`
-
-		if _, err := db.Exec(
-			query,
-			event.SensorID,
-			event.Value,
-			event.Unit,
-			event.Timestamp); err != nil {
-			log.Printf("error writing in database: %v", err)
-			return
-		}
-	})
+	consumer, err := createConsumer(js, cfg)
+	if err != nil {
+		return fmt.Errorf("error creating consumer: %w", err)
+	}
+
+	dlq, err := newDeadLetterQueue(context.Background(), js, cfg.Nats)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	devices := newDeviceCache(db, dataSourceName(cfg), cfg.Validation)
+	go devices.run(stop)
+
+	if cfg.Metrics.Address != "" {
+		go serveMetrics(cfg.Metrics.Address)
+	}
+
+	batcher := newBatcher(db, dlq, devices, cfg)
+	go batcher.run()
+
+	consumeCtx, err := consumer.Consume(batcher.add, jetstream.PullMaxMessages(2*cfg.Batch.Size),
+		jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+			log.Errorf("error consuming sensors stream: %v", err)
+		}))
 	if err != nil {
-		log.Printf("error subscribing sensors topic: %v", err)
+		return fmt.Errorf("error consuming sensors stream: %w", err)
 	}
 
 	// Waiting for interrupt
@@ -87,7 +232,37 @@ func main() {
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	<-sigCh
 
-	fmt.Print("consumer stopped")
+	consumeCtx.Stop()
+	batcher.stop()
+
+	log.Info("consumer stopped")
+
+	return nil
+}
+
+// This function creates the durable pull consumer of NTA, which keeps its position in the stream
+// across restarts. It waits until GAN has created the stream
+func createConsumer(js jetstream.JetStream, cfg *config.Config) (jetstream.Consumer, error) {
+	var consumer jetstream.Consumer
+	var createErr error
+	err := retry("stream "+cfg.Nats.Stream, cfg.Retry, func() error {
+		consumer, createErr = js.CreateOrUpdateConsumer(context.Background(), cfg.Nats.Stream, jetstream.ConsumerConfig{
+			Durable:       cfg.Nats.Durable,
+			FilterSubject: cfg.Nats.Subject,
+			AckPolicy:     jetstream.AckExplicitPolicy,
+			AckWait:       time.Duration(cfg.Nats.AckWait * float64(time.Second)),
+			MaxAckPending: 4 * cfg.Batch.Size,
+			DeliverPolicy: jetstream.DeliverAllPolicy,
+		})
+		// Only a missing stream is solved by waiting
+		if errors.Is(createErr, jetstream.ErrStreamNotFound) {
+			return createErr
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	defer sub.Unsubscribe()
+	return consumer, createErr
 }
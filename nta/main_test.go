@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	commonConfig "github.com/AntonioBR9998/go-common/config"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/urfave/cli/v2"
+
+	"github.com/AntonioBR9998/go-nats-simulator/nta/config"
+)
+
+// fakeConsumers creates the consumer once the stream exists. The rest of JetStream is not
+// implemented
+type fakeConsumers struct {
+	jetstream.JetStream
+	// Errors of the first attempts
+	errs     []error
+	attempts int
+	stream   string
+	config   jetstream.ConsumerConfig
+}
+
+func (js *fakeConsumers) CreateOrUpdateConsumer(ctx context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	js.attempts++
+	if js.attempts <= len(js.errs) {
+		return nil, js.errs[js.attempts-1]
+	}
+
+	js.stream, js.config = stream, cfg
+	return nil, nil
+}
+
+func TestCreateConsumer(t *testing.T) {
+	tests := []struct {
+		name         string
+		errs         []error
+		attempts     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "stream exists", wantAttempts: 1},
+		{name: "waits for the stream", errs: []error{jetstream.ErrStreamNotFound, jetstream.ErrStreamNotFound}, wantAttempts: 3},
+		{name: "stream never created", errs: []error{jetstream.ErrStreamNotFound, jetstream.ErrStreamNotFound},
+			attempts: 2, wantAttempts: 2, wantErr: true},
+		// Other errors are not solved by waiting
+		{name: "invalid consumer", errs: []error{errors.New("consumer name in subject does not match durable name")},
+			wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Retry: config.RetryConfig{Attempts: tt.attempts, InitialDelay: 0.001, MaxDelay: 0.001}}
+			cfg.SetDefaults()
+			js := &fakeConsumers{errs: tt.errs}
+
+			_, err := createConsumer(js, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createConsumer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if js.attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", js.attempts, tt.wantAttempts)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// The durable consumer acknowledges every sample and keeps its position across restarts
+			want := jetstream.ConsumerConfig{
+				Durable:       "nta",
+				FilterSubject: "sensors.>",
+				AckPolicy:     jetstream.AckExplicitPolicy,
+				AckWait:       30 * time.Second,
+				MaxAckPending: 4000,
+				DeliverPolicy: jetstream.DeliverAllPolicy,
+			}
+			if js.stream != "SENSORS" || js.config.Durable != want.Durable || js.config.FilterSubject != want.FilterSubject ||
+				js.config.AckPolicy != want.AckPolicy || js.config.AckWait != want.AckWait ||
+				js.config.MaxAckPending != want.MaxAckPending || js.config.DeliverPolicy != want.DeliverPolicy {
+				t.Errorf("consumer of %s = %+v, want %+v", js.stream, js.config, want)
+			}
+		})
+	}
+}
+
+// This function returns the settings which flags and environment variables override
+func overridable(cfg config.Config) []string {
+	db := cfg.TimescaleDB
+	return []string{cfg.Nats.Host, cfg.Nats.Port, db.Host, strconv.Itoa(db.Port), db.User, db.Password, db.DBName, db.SSLMode}
+}
+
+func TestOverrideConfig(t *testing.T) {
+	file := config.Config{
+		Nats: config.NatsConfig{Host: "nats", Port: "4222"},
+		TimescaleDB: commonConfig.PostgreSQLConfig{Host: "timescaledb", Port: 5432, User: "nta",
+			Password: "secret", DBName: "sensors", SSLMode: "disable"},
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want func(cfg *config.Config)
+	}{
+		{name: "configuration file", want: func(cfg *config.Config) {}},
+		{name: "environment variables",
+			env: map[string]string{"NTA_NATS_HOST": "nats.env", "NTA_DB_PORT": "6432", "NTA_DB_PASSWORD": "env"},
+			want: func(cfg *config.Config) {
+				cfg.Nats.Host, cfg.TimescaleDB.Port, cfg.TimescaleDB.Password = "nats.env", 6432, "env"
+			}},
+		{name: "flags",
+			args: []string{"--nats-port", "4223", "--db-host", "db.flag", "--db-sslmode", "require"},
+			want: func(cfg *config.Config) {
+				cfg.Nats.Port, cfg.TimescaleDB.Host, cfg.TimescaleDB.SSLMode = "4223", "db.flag", "require"
+			}},
+		{name: "flags over environment variables",
+			env:  map[string]string{"NTA_NATS_HOST": "nats.env", "NTA_DB_USER": "env", "NTA_DB_NAME": "env"},
+			args: []string{"--nats-host", "nats.flag", "--db-user", "flag"},
+			want: func(cfg *config.Config) {
+				cfg.Nats.Host, cfg.TimescaleDB.User, cfg.TimescaleDB.DBName = "nats.flag", "flag", "env"
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			got := file
+			app := cli.App{
+				Flags: newFlags(),
+				Action: func(ctx *cli.Context) error {
+					overrideConfig(ctx, &got)
+					return nil
+				},
+			}
+			if err := app.Run(append([]string{"nta", "--config", "config.json"}, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+
+			want := file
+			tt.want(&want)
+			if !slices.Equal(overridable(got), overridable(want)) {
+				t.Errorf("overrideConfig() = %q, want %q", overridable(got), overridable(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AntonioBR9998/go-nats-simulator/nta/config"
+)
+
+// backoff gives the delays between attempts, which double from the initial delay up to the max
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+}
+
+func newBackoff(conf config.RetryConfig) backoff {
+	return backoff{
+		initial: time.Duration(conf.InitialDelay * float64(time.Second)),
+		max:     time.Duration(conf.MaxDelay * float64(time.Second)),
+	}
+}
+
+// This function returns the delay after a number of failed attempts
+func (b backoff) delay(attempts uint64) time.Duration {
+	if attempts == 0 {
+		return b.initial
+	}
+
+	delay := b.initial << min(attempts-1, 20)
+	return min(delay, b.max)
+}
+
+// This function calls connect until it succeeds or the configured attempts run out
+func retry(name string, conf config.RetryConfig, connect func() error) error {
+	b := newBackoff(conf)
+
+	for attempt := 1; ; attempt++ {
+		err := connect()
+		if err == nil {
+			return nil
+		}
+
+		if conf.Attempts > 0 && attempt >= conf.Attempts {
+			return fmt.Errorf("%s is not available after %d attempts: %w", name, attempt, err)
+		}
+
+		delay := b.delay(uint64(attempt))
+		log.Warnf("%s is not available, retrying in %v: %v", name, delay, err)
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AntonioBR9998/go-nats-simulator/nta/config"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := newBackoff(config.RetryConfig{InitialDelay: 0.5, MaxDelay: 10})
+
+	tests := []struct {
+		attempts uint64
+		want     time.Duration
+	}{
+		{attempts: 0, want: 500 * time.Millisecond},
+		{attempts: 1, want: 500 * time.Millisecond},
+		{attempts: 2, want: time.Second},
+		{attempts: 3, want: 2 * time.Second},
+		{attempts: 5, want: 8 * time.Second},
+		{attempts: 6, want: 10 * time.Second},
+		{attempts: 100, want: 10 * time.Second},
+		// Redeliveries of a sample which keeps failing never overflow
+		{attempts: 1 << 62, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := b.delay(tt.attempts); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	unavailable := errors.New("connection refused")
+
+	tests := []struct {
+		name         string
+		attempts     int
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "available", attempts: 3, wantAttempts: 1},
+		{name: "available after some attempts", attempts: 3, failures: 2, wantAttempts: 3},
+		{name: "attempts run out", attempts: 3, failures: 5, wantAttempts: 3, wantErr: true},
+		{name: "forever", attempts: 0, failures: 20, wantAttempts: 21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := config.RetryConfig{Attempts: tt.attempts, InitialDelay: 0.0001, MaxDelay: 0.001}
+
+			attempts := 0
+			err := retry("TimescaleDB", conf, func() error {
+				attempts++
+				if attempts <= tt.failures {
+					return unavailable
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("retry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, unavailable) {
+				t.Errorf("retry() error = %v, want it to wrap %v", err, unavailable)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
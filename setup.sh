@@ -9,32 +9,10 @@ until docker exec -it timescale-db pg_isready -U admin > /dev/null 2>&1; do
   sleep 3
 done
 
-echo "timescaleDB is ready. Creating timestaleDB extension"
-docker exec -i timescale-db psql -U admin -d sensors -c "CREATE EXTENSION IF NOT EXISTS timescaledb CASCADE;"
+echo "timescaleDB is ready. Applying database migrations"
+docker compose run --rm --no-deps api migrate up
 
-echo "creating devices table"
-docker exec -i timescale-db psql -U admin -d sensors -c "
-CREATE TYPE device_type AS ENUM ('humidity', 'temperature', 'pressure');"
-docker exec -i timescale-db psql -U admin -d sensors -c "
-CREATE TABLE IF NOT EXISTS devices (
-    id UUID PRIMARY KEY,
-    type device_type NOT NULL,
-    alias TEXT NOT NULL,
-    rate INTEGER NOT NULL,
-    max_threshold INTEGER NOT NULL,
-    min_threshold INTEGER NOT NULL,
-    updated_at BIGINT NOT NULL
-);"
-
-echo "creating metrics table"
-docker exec -i timescale-db psql -U admin -d sensors -c "
-CREATE TABLE IF NOT EXISTS metrics (
-    sensor_id UUID NOT NULL,
-    value REAL NOT NULL,
-    unit TEXT NOT NULL,
-    timestamp BIGINT NOT NULL
-);"
-docker exec -i timescale-db psql -U admin -d sensors -c "
-SELECT create_hypertable('metrics', 'timestamp', if_not_exists => TRUE);"
+echo "restarting GAN with the migrated schema"
+docker compose restart api
 
 echo "the architecture is ready"